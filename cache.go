@@ -1,7 +1,9 @@
 package jet
 
 import (
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // Cache is the interface Jet uses to store and retrieve parsed templates.
@@ -14,13 +16,54 @@ type Cache interface {
 	Put(templatePath string, t *Template)
 }
 
+// CacheDeleter is a Cache that can remove templates. Caches should implement it so that
+// templates can be dropped from them.
+type CacheDeleter interface {
+	Cache
+
+	// Delete removes the template at templatePath from the cache.
+	Delete(templatePath string)
+}
+
+// CacheLen is a Cache that can report how many templates it holds.
+type CacheLen interface {
+	Cache
+
+	// Len returns the number of templates in the cache.
+	Len() int
+}
+
+// CachePurger is a Cache that can remove all templates at once.
+type CachePurger interface {
+	Cache
+
+	// Purge removes all templates from the cache.
+	Purge()
+}
+
+// CacheNotifier is a Cache that removes templates on its own, like caches bounded in size. A Set using it
+// forgets the dependencies of the templates removed from the cache, see Set.Dependents.
+type CacheNotifier interface {
+	Cache
+
+	// NotifyRemoved registers fn to be called with every template removed from the cache, except templates
+	// replaced by Put. A template cached at several paths is only reported once it's no longer cached at any
+	// of them. fn is called without holding locks of the cache.
+	NotifyRemoved(fn func(templatePath string, t *Template))
+}
+
 // cache is the cache used by default in a new Set.
 type cache struct {
 	m sync.Map
 }
 
-// compile-time check that cache implements Cache
-var _ Cache = (*cache)(nil)
+// compile-time check that cache implements Cache, CacheDeleter, CacheLen and CachePurger
+var (
+	_ Cache        = (*cache)(nil)
+	_ CacheDeleter = (*cache)(nil)
+	_ CacheLen     = (*cache)(nil)
+	_ CachePurger  = (*cache)(nil)
+)
 
 func (c *cache) Get(templatePath string) *Template {
 	_t, ok := c.m.Load(templatePath)
@@ -33,3 +76,152 @@ func (c *cache) Get(templatePath string) *Template {
 func (c *cache) Put(templatePath string, t *Template) {
 	c.m.Store(templatePath, t)
 }
+
+func (c *cache) Delete(templatePath string) {
+	c.m.Delete(templatePath)
+}
+
+func (c *cache) Purge() {
+	c.m.Range(func(templatePath, _ interface{}) bool {
+		c.m.Delete(templatePath)
+		return true
+	})
+}
+
+func (c *cache) Len() int {
+	n := 0
+	c.m.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// nodeSize is the estimated size of a node of a template in bytes.
+const nodeSize = 128
+
+// Size returns the approximate size of the template in memory in bytes: the size of its source and an
+// estimate for every node of its tree. It doesn't include the templates it extends or imports. Caches can
+// use it to bound their memory usage.
+func (t *Template) Size() int64 {
+	size := int64(len(t.text))
+	Inspect(t.Root, func(Node) {
+		size += nodeSize
+	})
+	return size
+}
+
+// Invalidate removes the template at templatePath from the cache of the Set, together with every cached
+// template extending or importing it, directly or through other templates, so that they are loaded and
+// parsed again the next time they're needed. Templates including it don't have to be invalidated, since
+// includes are looked up at runtime. Invalidate needs a cache implementing CacheDeleter; the default
+// cache does.
+func (s *Set) Invalidate(templatePath string) {
+	s.invalidate(resolveSibling(templatePath, "/"), map[string]bool{})
+}
+
+// invalidate removes the template at templatePath and its dependents from the cache; done holds the
+// paths already invalidated.
+func (s *Set) invalidate(templatePath string, done map[string]bool) {
+	if done[templatePath] {
+		return
+	}
+	done[templatePath] = true
+	atomic.AddUint64(&s.invalidations, 1)
+
+	s.lookups.forget(templatePath, s.extensions)
+	keys := s.cacheKeys(templatePath)
+	if c, ok := s.cache.(CacheDeleter); ok {
+		for key := range keys {
+			c.Delete(key)
+		}
+	}
+
+	s.graphMx.Lock()
+	var dependents []string
+	for from, t := range s.graph {
+		if keys[from] {
+			delete(s.graph, from)
+			continue
+		}
+		for _, d := range t.dependencies {
+			if d.Kind != DependencyInclude && keys[d.target] {
+				dependents = append(dependents, from)
+				break
+			}
+		}
+	}
+	s.graphMx.Unlock()
+
+	for _, dependent := range dependents {
+		s.invalidate(dependent, done)
+	}
+}
+
+// cacheKeys returns the paths the template at templatePath can be cached at: with and without each of the
+// extensions of the Set.
+func (s *Set) cacheKeys(templatePath string) map[string]bool {
+	bases := []string{templatePath}
+	for _, extension := range s.extensions {
+		if extension != "" && strings.HasSuffix(templatePath, extension) {
+			bases = append(bases, strings.TrimSuffix(templatePath, extension))
+		}
+	}
+	keys := map[string]bool{}
+	for _, base := range bases {
+		for _, extension := range s.extensions {
+			keys[base+extension] = true
+		}
+	}
+	return keys
+}
+
+// Purge removes all templates from the cache of the Set and forgets their dependencies. It needs a cache
+// implementing CachePurger or CacheDeleter; the default cache does.
+func (s *Set) Purge() {
+	atomic.AddUint64(&s.invalidations, 1)
+	s.graphMx.Lock()
+	graph := s.graph
+	s.graph = nil
+	s.graphMx.Unlock()
+	s.lookups.purge()
+
+	switch c := s.cache.(type) {
+	case CachePurger:
+		c.Purge()
+	case CacheDeleter:
+		for templatePath := range graph {
+			for key := range s.cacheKeys(templatePath) {
+				c.Delete(key)
+			}
+		}
+	}
+}
+
+// invalidatedSince reports whether templates were invalidated since t was loaded, so that t may be stale and
+// must not be cached.
+func (s *Set) invalidatedSince(t *Template) bool {
+	return t.compiled == nil && atomic.LoadUint64(&s.invalidations) != t.invalidations
+}
+
+// syncLoader invalidates the templates changed in a VersionedLoader since the last call.
+func (s *Set) syncLoader() {
+	l, ok := s.loader.(VersionedLoader)
+	if !ok {
+		return
+	}
+	version := l.Version()
+	if atomic.LoadUint64(&s.loaderVersion) == version {
+		return
+	}
+	s.loaderMx.Lock()
+	defer s.loaderMx.Unlock()
+	if s.loaderVersion == version {
+		return
+	}
+	done := map[string]bool{}
+	for _, templatePath := range l.ChangedSince(s.loaderVersion) {
+		s.invalidate(templatePath, done)
+	}
+	atomic.StoreUint64(&s.loaderVersion, version)
+}
@@ -0,0 +1,308 @@
+// Package lru implements a jet.Cache bounded in size. It evicts the least recently used templates when it
+// holds more templates or, approximately, more bytes than allowed, and templates cached longer than a TTL:
+//
+//	views := jet.NewSet(loader, jet.WithCache(lru.New(lru.MaxEntries(1000), lru.MaxBytes(64<<20), lru.TTL(time.Hour))))
+//
+// A Cache without options holds templates forever, like the default cache of a Set.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+var (
+	_ jet.Cache         = (*Cache)(nil)
+	_ jet.CacheDeleter  = (*Cache)(nil)
+	_ jet.CacheLen      = (*Cache)(nil)
+	_ jet.CachePurger   = (*Cache)(nil)
+	_ jet.CacheNotifier = (*Cache)(nil)
+)
+
+// EvictReason is the reason a template was evicted from the cache.
+type EvictReason int
+
+const (
+	Capacity EvictReason = iota // the cache held more templates or bytes than allowed
+	Expired                     // the template was cached longer than the TTL
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case Capacity:
+		return "capacity"
+	case Expired:
+		return "expired"
+	}
+	return "unknown"
+}
+
+// Stats are the statistics of a Cache.
+type Stats struct {
+	Hits      uint64 // calls of Get finding a template
+	Misses    uint64 // calls of Get not finding a template, including expired ones
+	Evictions uint64 // templates evicted because the cache was full
+	Expired   uint64 // templates evicted because they expired
+	Len       int    // number of templates in the cache
+	Bytes     int64  // approximate size of the templates in the cache
+}
+
+// Cache is a jet.Cache evicting the least recently used templates. It's safe for concurrent use.
+type Cache struct {
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	onEvict    func(templatePath string, t *jet.Template, reason EvictReason)
+	size       func(t *jet.Template) int64
+	now        func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List            // of *entry, most recently used first
+	byExpiry *list.List            // of *entry with a TTL, in the order they were put, which is the order they expire in
+	refs     map[*jet.Template]int // number of entries caching each template
+	bytes    int64
+	stats    Stats
+	removed  []func(templatePath string, t *jet.Template) // see NotifyRemoved
+}
+
+type entry struct {
+	path    string
+	t       *jet.Template
+	size    int64
+	expires time.Time
+	expiry  *list.Element // element of the entry in byExpiry
+	last    bool          // whether no other entry caches t since the entry was removed
+}
+
+type eviction struct {
+	entry  *entry
+	reason EvictReason
+}
+
+// Option configures a Cache.
+type Option func(*Cache)
+
+// MaxEntries bounds the number of templates in the cache.
+func MaxEntries(n int) Option {
+	return func(c *Cache) {
+		c.maxEntries = n
+	}
+}
+
+// MaxBytes bounds the approximate size of the templates in the cache, see jet.Template.Size. A template
+// larger than n is evicted as soon as another one is cached.
+func MaxBytes(n int64) Option {
+	return func(c *Cache) {
+		c.maxBytes = n
+	}
+}
+
+// TTL evicts templates cached longer than d, so that they are parsed again.
+func TTL(d time.Duration) Option {
+	return func(c *Cache) {
+		c.ttl = d
+	}
+}
+
+// OnEvict sets a function called with every evicted template, after it was removed from the cache.
+// It's not called for templates replaced by Put or removed by Delete or Purge.
+func OnEvict(fn func(templatePath string, t *jet.Template, reason EvictReason)) Option {
+	return func(c *Cache) {
+		c.onEvict = fn
+	}
+}
+
+// WithSize sets the function estimating the size of templates for MaxBytes, jet.Template.Size by default.
+func WithSize(fn func(t *jet.Template) int64) Option {
+	return func(c *Cache) {
+		c.size = fn
+	}
+}
+
+// New returns a Cache configured by opts.
+func New(opts ...Option) *Cache {
+	c := &Cache{
+		size:     (*jet.Template).Size,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		refs:     make(map[*jet.Template]int),
+		order:    list.New(),
+		byExpiry: list.New(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Get returns the template cached at templatePath, or nil if there is none or it expired.
+func (c *Cache) Get(templatePath string) *jet.Template {
+	c.mu.Lock()
+	el, ok := c.entries[templatePath]
+	if !ok {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return nil
+	}
+	e := el.Value.(*entry)
+	if c.ttl > 0 && !c.now().Before(e.expires) {
+		c.remove(el)
+		c.stats.Misses++
+		c.stats.Expired++
+		removed := c.removed
+		c.mu.Unlock()
+		c.evicted(removed, []eviction{{e, Expired}})
+		return nil
+	}
+	c.order.MoveToFront(el)
+	c.stats.Hits++
+	c.mu.Unlock()
+	return e.t
+}
+
+// NotifyRemoved registers fn to be called with every template evicted, deleted or purged from the cache.
+// A template cached at several paths, like "/index" and "/index.jet", is only reported once it's removed
+// at the last of them. A Set using the cache registers a function forgetting the dependencies of these
+// templates.
+func (c *Cache) NotifyRemoved(fn func(templatePath string, t *jet.Template)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removed = append(c.removed, fn)
+}
+
+// Put caches t at templatePath, evicting expired and least recently used templates if the cache is full.
+func (c *Cache) Put(templatePath string, t *jet.Template) {
+	e := &entry{path: templatePath, t: t}
+	if c.maxBytes > 0 {
+		e.size = c.size(t)
+	}
+	now := c.now()
+	if c.ttl > 0 {
+		e.expires = now.Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	if el, ok := c.entries[templatePath]; ok {
+		c.remove(el)
+	}
+	c.entries[templatePath] = c.order.PushFront(e)
+	c.refs[t]++
+	c.bytes += e.size
+
+	var evictions []eviction
+	if c.ttl > 0 {
+		e.expiry = c.byExpiry.PushBack(e)
+		for el := c.byExpiry.Front(); el != nil; el = c.byExpiry.Front() {
+			expired := el.Value.(*entry)
+			if now.Before(expired.expires) {
+				break
+			}
+			c.remove(c.entries[expired.path])
+			c.stats.Expired++
+			evictions = append(evictions, eviction{expired, Expired})
+		}
+	}
+	for c.order.Len() > 1 && c.full() {
+		el := c.order.Back()
+		c.remove(el)
+		c.stats.Evictions++
+		evictions = append(evictions, eviction{el.Value.(*entry), Capacity})
+	}
+	removed := c.removed
+	c.mu.Unlock()
+	c.evicted(removed, evictions)
+}
+
+// Delete removes the template at templatePath from the cache.
+func (c *Cache) Delete(templatePath string) {
+	c.mu.Lock()
+	el, ok := c.entries[templatePath]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	c.remove(el)
+	removed := c.removed
+	c.mu.Unlock()
+	notify(removed, el.Value.(*entry))
+}
+
+// Purge removes all templates from the cache.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	var entries []*entry
+	removed := c.removed
+	if len(removed) > 0 {
+		for el := c.order.Front(); el != nil; el = el.Next() {
+			e := el.Value.(*entry)
+			e.last = c.refs[e.t] == 1
+			c.refs[e.t]--
+			entries = append(entries, e)
+		}
+	}
+	c.entries = make(map[string]*list.Element)
+	c.refs = make(map[*jet.Template]int)
+	c.order.Init()
+	c.byExpiry.Init()
+	c.bytes = 0
+	c.mu.Unlock()
+	notify(removed, entries...)
+}
+
+// Len returns the number of templates in the cache, including expired ones not evicted yet.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Stats returns the statistics of the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Len, stats.Bytes = c.order.Len(), c.bytes
+	return stats
+}
+
+func (c *Cache) full() bool {
+	return (c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*entry)
+	if e.expiry != nil {
+		c.byExpiry.Remove(e.expiry)
+	}
+	delete(c.entries, e.path)
+	c.bytes -= e.size
+	if c.refs[e.t]--; c.refs[e.t] == 0 {
+		delete(c.refs, e.t)
+		e.last = true
+	}
+}
+
+func (c *Cache) evicted(removed []func(string, *jet.Template), evictions []eviction) {
+	for _, ev := range evictions {
+		if c.onEvict != nil {
+			c.onEvict(ev.entry.path, ev.entry.t, ev.reason)
+		}
+		notify(removed, ev.entry)
+	}
+}
+
+// notify calls the functions registered by NotifyRemoved with the removed entries whose template isn't
+// cached by other entries.
+func notify(removed []func(string, *jet.Template), entries ...*entry) {
+	for _, fn := range removed {
+		for _, e := range entries {
+			if e.last {
+				fn(e.path, e.t)
+			}
+		}
+	}
+}
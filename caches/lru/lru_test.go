@@ -0,0 +1,214 @@
+package lru
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func parse(t *testing.T, set *jet.Set, path, content string) *jet.Template {
+	tt, err := set.Parse(path, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tt
+}
+
+type recorder struct {
+	evicted []string
+}
+
+func (r *recorder) onEvict(templatePath string, _ *jet.Template, reason EvictReason) {
+	r.evicted = append(r.evicted, fmt.Sprintf("%s %s", templatePath, reason))
+}
+
+func TestMaxEntries(t *testing.T) {
+	set := jet.NewSet(jet.NewInMemLoader())
+	var r recorder
+	c := New(MaxEntries(2), OnEvict(r.onEvict))
+	a, b, d := parse(t, set, "/a.jet", "a"), parse(t, set, "/b.jet", "b"), parse(t, set, "/d.jet", "d")
+
+	c.Put("/a.jet", a)
+	c.Put("/b.jet", b)
+	if c.Get("/a.jet") != a {
+		t.Fatal("expected /a.jet to be cached")
+	}
+	c.Put("/d.jet", d) // evicts /b.jet, the least recently used
+	if c.Get("/b.jet") != nil || c.Get("/a.jet") != a || c.Get("/d.jet") != d {
+		t.Errorf("expected /b.jet to be evicted")
+	}
+	c.Put("/d.jet", d) // replacing doesn't evict
+	c.Delete("/a.jet")
+	if c.Len() != 1 {
+		t.Errorf("expected 1 template, got %d", c.Len())
+	}
+
+	if evicted := strings.Join(r.evicted, ", "); evicted != "/b.jet capacity" {
+		t.Errorf("unexpected evictions %s", evicted)
+	}
+	expected := Stats{Hits: 3, Misses: 1, Evictions: 1, Len: 1}
+	if stats := c.Stats(); stats != expected {
+		t.Errorf("expected stats %+v, got %+v", expected, stats)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	set := jet.NewSet(jet.NewInMemLoader())
+	a := parse(t, set, "/a.jet", "{{ range items }}{{ . }}{{ end }}")
+	b := parse(t, set, "/b.jet", strings.Repeat("b", 100))
+	c := New(MaxBytes(a.Size() + b.Size()))
+
+	c.Put("/a.jet", a)
+	c.Put("/b.jet", b)
+	if stats := c.Stats(); stats.Len != 2 || stats.Bytes != a.Size()+b.Size() {
+		t.Errorf("expected both templates to be cached, got %+v", stats)
+	}
+	c.Put("/c.jet", parse(t, set, "/c.jet", "c"))
+	if c.Get("/a.jet") != nil || c.Get("/b.jet") != b {
+		t.Errorf("expected /a.jet to be evicted")
+	}
+
+	c.Purge()
+	if stats := c.Stats(); stats.Len != 0 || stats.Bytes != 0 {
+		t.Errorf("expected an empty cache, got %+v", stats)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	set := jet.NewSet(jet.NewInMemLoader())
+	var r recorder
+	c := New(TTL(time.Minute), OnEvict(r.onEvict))
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	a, b := parse(t, set, "/a.jet", "a"), parse(t, set, "/b.jet", "b")
+	c.Put("/a.jet", a)
+	now = now.Add(30 * time.Second)
+	c.Put("/b.jet", b)
+	if c.Get("/a.jet") != a {
+		t.Fatal("expected /a.jet to be cached")
+	}
+
+	now = now.Add(30 * time.Second)
+	if c.Get("/a.jet") != nil || c.Get("/b.jet") != b {
+		t.Errorf("expected /a.jet to expire")
+	}
+	now = now.Add(time.Minute)
+	c.Put("/a.jet", a) // evicts /b.jet
+	if c.Len() != 1 {
+		t.Errorf("expected 1 template, got %d", c.Len())
+	}
+
+	if evicted := strings.Join(r.evicted, ", "); evicted != "/a.jet expired, /b.jet expired" {
+		t.Errorf("unexpected evictions %s", evicted)
+	}
+	if stats := c.Stats(); stats.Expired != 2 || stats.Misses != 1 || stats.Hits != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestTTLExpiryOrder(t *testing.T) {
+	set := jet.NewSet(jet.NewInMemLoader())
+	var r recorder
+	c := New(TTL(time.Minute), OnEvict(r.onEvict))
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	put := func(after time.Duration, templatePath string) {
+		now = now.Add(after)
+		c.Put(templatePath, parse(t, set, templatePath, templatePath))
+	}
+	put(0, "/a.jet")
+	put(10*time.Second, "/b.jet")
+	put(10*time.Second, "/c.jet")
+	put(10*time.Second, "/b.jet") // expires a minute after being replaced
+	put(35*time.Second, "/d.jet") // evicts /a.jet only
+	if c.Len() != 3 {
+		t.Errorf("expected 3 templates, got %d", c.Len())
+	}
+	put(20*time.Second, "/e.jet") // evicts /c.jet, but not /b.jet
+	if c.Len() != 3 || c.Get("/b.jet") == nil {
+		t.Errorf("expected /b.jet, /d.jet and /e.jet to be cached, got %d templates", c.Len())
+	}
+
+	if evicted := strings.Join(r.evicted, ", "); evicted != "/a.jet expired, /c.jet expired" {
+		t.Errorf("unexpected evictions %s", evicted)
+	}
+}
+
+func TestSet(t *testing.T) {
+	l := jet.NewInMemLoader()
+	l.Set("/index.jet", "Hello")
+	c := New(MaxEntries(10))
+	set := jet.NewSet(l, jet.WithCache(c))
+	for i := 0; i < 2; i++ {
+		if _, err := set.GetTemplate("/index.jet"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := c.Stats(); stats.Len != 1 || stats.Hits == 0 {
+		t.Errorf("expected the Set to use the cache, got %+v", stats)
+	}
+}
+
+func TestSetDependents(t *testing.T) {
+	l := jet.NewInMemLoader()
+	l.Set("/layout.jet", "{{ yield body() }}")
+	l.Set("/a.jet", `{{ extends "layout" }}`)
+	l.Set("/b.jet", `{{ extends "layout" }}`)
+	var r recorder
+	c := New(MaxEntries(2), OnEvict(r.onEvict))
+	set := jet.NewSet(l, jet.WithCache(c))
+
+	dependents := func() (paths []string) {
+		for _, d := range set.Dependents("/layout.jet") {
+			paths = append(paths, d.From)
+		}
+		return paths
+	}
+	if _, err := set.GetTemplate("/a.jet"); err != nil {
+		t.Fatal(err)
+	}
+	if paths := dependents(); len(paths) != 1 || paths[0] != "/a.jet" {
+		t.Fatalf("expected /a.jet to depend on /layout.jet, got %v", paths)
+	}
+	if _, err := set.GetTemplate("/b.jet"); err != nil { // evicts /a.jet
+		t.Fatal(err)
+	}
+	if paths := dependents(); len(paths) != 1 || paths[0] != "/b.jet" {
+		t.Errorf("expected the dependencies of the evicted /a.jet to be forgotten, got %v", paths)
+	}
+	if evicted := strings.Join(r.evicted, ", "); evicted != "/a.jet capacity" {
+		t.Errorf("unexpected evictions %s", evicted)
+	}
+	c.Delete("/b.jet")
+	if paths := dependents(); len(paths) != 0 {
+		t.Errorf("expected the dependencies of the deleted /b.jet to be forgotten, got %v", paths)
+	}
+}
+
+func TestNotifyRemovedSharedTemplate(t *testing.T) {
+	set := jet.NewSet(jet.NewInMemLoader())
+	a, b := parse(t, set, "/a.jet", "a"), parse(t, set, "/b.jet", "b")
+	var removed []string
+	c := New(MaxEntries(2))
+	c.NotifyRemoved(func(templatePath string, _ *jet.Template) {
+		removed = append(removed, templatePath)
+	})
+
+	c.Put("/a", a)
+	c.Put("/a.jet", a)
+	c.Put("/b.jet", b) // evicts /a, while a is still cached at /a.jet
+	if len(removed) != 0 {
+		t.Errorf("expected no template to be reported while cached at another path, got %v", removed)
+	}
+	c.Delete("/a.jet")
+	c.Put("/b", b)
+	c.Purge()
+	if got := strings.Join(removed, ", "); got != "/a.jet, /b.jet" {
+		t.Errorf("expected a and b to be reported once each, got %s", got)
+	}
+}
@@ -0,0 +1,711 @@
+package jet
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+// TypeEnv declares the types of the context and the variables of a template for Set.Check.
+// Templates can declare them as well, in comments like {* @context *models.Page *} and {* @var user *models.User *};
+// those declarations take precedence over the TypeEnv.
+type TypeEnv struct {
+	// Context is the type of the context the template is executed with, nil if unknown.
+	Context reflect.Type
+	// Vars holds the types of the variables passed to the template.
+	Vars map[string]reflect.Type
+	// IgnoreUnknownTypes makes the checker treat type names of declarations that weren't registered
+	// with WithTypes as unknown types, instead of reporting them.
+	IgnoreUnknownTypes bool
+}
+
+// WithTypes returns an option function registering the types of the example values for the type declarations
+// of templates. Types are registered under the names reflect gives them, like "models.Page"; for pointer types,
+// the element type is registered as well. Pass nil pointers, like (*models.Page)(nil), to register struct types.
+func WithTypes(examples ...interface{}) Option {
+	return func(s *Set) {
+		if s.types == nil {
+			s.types = map[string]reflect.Type{}
+		}
+		for _, example := range examples {
+			typ := reflect.TypeOf(example)
+			if typ == nil {
+				continue
+			}
+			s.types[typ.String()] = typ
+			if typ.Kind() == reflect.Ptr {
+				s.types[typ.Elem().String()] = typ.Elem()
+			}
+		}
+	}
+}
+
+// CheckErrors lists all problems found by Set.Check.
+type CheckErrors []errors.Error
+
+func (e CheckErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Check loads the template at templatePath and checks it statically against the declared types,
+// following includes. It reports unknown fields and methods, calls with the wrong number of arguments
+// and ranges over values that are not rangeable. Values of unknown type, like variables not declared
+// in env or in the template, or values of type interface{}, are not checked.
+//
+// Check returns the error of loading the template, or CheckErrors listing all problems found.
+func (s *Set) Check(templatePath string, env TypeEnv) error {
+	t, err := s.GetTemplate(templatePath)
+	if err != nil {
+		return err
+	}
+	c := &checker{set: s, env: env, visited: map[checkedTemplate]bool{}}
+	c.scope = &typeScope{vars: map[string]reflect.Type{}}
+	for name, typ := range env.Vars {
+		c.scope.vars[name] = typ
+	}
+	c.template(t, env.Context)
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+	return nil
+}
+
+var typeDeclaration = regexp.MustCompile(`(?s)\{\*\s*@(context|var)\s(.*?)\*\}`)
+
+type checkedTemplate struct {
+	path    string
+	context reflect.Type
+}
+
+type typeScope struct {
+	parent *typeScope
+	vars   map[string]reflect.Type
+}
+
+type checker struct {
+	set     *Set
+	env     TypeEnv
+	errs    CheckErrors
+	scope   *typeScope
+	context reflect.Type
+	visited map[checkedTemplate]bool
+
+	statement Node // the statement being checked
+}
+
+func (c *checker) report(err errors.Error) {
+	if err.Position().L == 0 && c.statement != nil {
+		// some expression nodes don't record their line
+		err = err.WithLine(c.statement.line())
+	}
+	c.errs = append(c.errs, err)
+}
+
+func (c *checker) pushScope() {
+	c.scope = &typeScope{parent: c.scope, vars: map[string]reflect.Type{}}
+}
+
+func (c *checker) popScope() {
+	c.scope = c.scope.parent
+}
+
+// lookup returns the type of the variable name, nil if it is unknown.
+func (c *checker) lookup(name string) reflect.Type {
+	if name == "." {
+		return c.context
+	}
+	for sc := c.scope; sc != nil; sc = sc.parent {
+		if typ, ok := sc.vars[name]; ok {
+			return typ
+		}
+	}
+	c.set.gmx.RLock()
+	v, ok := c.set.globals[name]
+	c.set.gmx.RUnlock()
+	if !ok {
+		v, ok = defaultVariables[name]
+	}
+	if ok {
+		return valueType(indirectEface(v))
+	}
+	return nil
+}
+
+// valueType returns the type of v, nil for invalid values and empty interfaces.
+func valueType(v reflect.Value) reflect.Type {
+	if !v.IsValid() {
+		return nil
+	}
+	return known(v.Type())
+}
+
+// known returns typ, or nil if values of typ can be of any type.
+func known(typ reflect.Type) reflect.Type {
+	if typ == nil || (typ.Kind() == reflect.Interface && typ.NumMethod() == 0) {
+		return nil
+	}
+	return typ
+}
+
+// template checks t and the templates it extends and imports, using the type declarations of t.
+func (c *checker) template(t *Template, context reflect.Type) {
+	key := checkedTemplate{t.Name, context}
+	if c.visited[key] {
+		return
+	}
+	c.visited[key] = true
+
+	c.pushScope()
+	defer c.popScope()
+	saved := c.context
+	defer func() { c.context = saved }()
+	c.context = context
+
+	for _, m := range typeDeclaration.FindAllStringSubmatchIndex(t.text, -1) {
+		kind, decl := t.text[m[2]:m[3]], strings.TrimSpace(t.text[m[4]:m[5]])
+		line := 1 + strings.Count(t.text[:m[0]], "\n")
+		pos := &NodeBase{TemplatePath: t.Name, Line: line}
+		name := ""
+		if kind == "var" {
+			fields := strings.Fields(decl)
+			if len(fields) != 2 {
+				c.report(pos.error(errors.UnknownTypeReason, fmt.Sprintf("malformed declaration %q, expected @var name type", decl)))
+				continue
+			}
+			name, decl = fields[0], fields[1]
+		}
+		typ, ok := c.set.parseType(decl)
+		if !ok && !c.env.IgnoreUnknownTypes {
+			c.report(pos.error(errors.UnknownTypeReason, fmt.Sprintf("unknown type %q in @%s declaration, register it with jet.WithTypes()", decl, kind)))
+		}
+		if kind == "context" {
+			c.context = known(typ)
+		} else {
+			c.scope.vars[name] = known(typ)
+		}
+	}
+
+	c.list(t.Root)
+	for _, imported := range t.imports {
+		c.template(imported, c.context)
+	}
+	if t.extends != nil {
+		c.template(t.extends, c.context)
+	}
+}
+
+// parseType resolves a type name of a declaration, like "*models.Page" or "map[string][]int".
+func (s *Set) parseType(name string) (reflect.Type, bool) {
+	switch {
+	case strings.HasPrefix(name, "*"):
+		elem, ok := s.parseType(name[1:])
+		if !ok {
+			return nil, false
+		}
+		return reflect.PtrTo(elem), true
+	case strings.HasPrefix(name, "[]"):
+		elem, ok := s.parseType(name[2:])
+		if !ok {
+			return nil, false
+		}
+		return reflect.SliceOf(elem), true
+	case strings.HasPrefix(name, "map["):
+		depth := 0
+		for i := 3; i < len(name); i++ {
+			switch name[i] {
+			case '[':
+				depth++
+			case ']':
+				depth--
+			}
+			if depth == 0 {
+				key, ok := s.parseType(name[4:i])
+				if !ok {
+					return nil, false
+				}
+				elem, ok := s.parseType(name[i+1:])
+				if !ok {
+					return nil, false
+				}
+				return reflect.MapOf(key, elem), true
+			}
+		}
+	}
+	if typ, ok := s.types[name]; ok {
+		return typ, true
+	}
+	typ, ok := builtinTypes[name]
+	return typ, ok
+}
+
+var builtinTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, v := range []interface{}{
+		"", false, int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), float32(0), float64(0),
+	} {
+		builtinTypes[reflect.TypeOf(v).String()] = reflect.TypeOf(v)
+	}
+	builtinTypes["byte"] = builtinTypes["uint8"]
+	builtinTypes["rune"] = builtinTypes["int32"]
+	builtinTypes["interface{}"] = reflect.TypeOf((*interface{})(nil)).Elem()
+	builtinTypes["any"] = builtinTypes["interface{}"]
+}
+
+func (c *checker) list(list *ListNode) {
+	if list == nil {
+		return
+	}
+	c.pushScope()
+	defer c.popScope()
+	for _, node := range list.Nodes {
+		c.node(node)
+	}
+}
+
+func (c *checker) node(node Node) {
+	saved := c.statement
+	defer func() { c.statement = saved }()
+	c.statement = node
+	switch node := node.(type) {
+	case *ActionNode:
+		if node.Set != nil {
+			c.setNode(node.Set)
+		}
+		if node.Pipe != nil {
+			c.pipeline(node.Pipe)
+		}
+	case *IfNode:
+		c.pushScope()
+		if node.Set != nil {
+			c.setNode(node.Set)
+		}
+		c.expression(node.Expression)
+		c.list(node.List)
+		c.list(node.ElseList)
+		c.popScope()
+	case *RangeNode:
+		c.rangeNode(node)
+	case *TryNode:
+		c.list(node.List)
+		if node.Catch != nil {
+			c.pushScope()
+			if node.Catch.Err != nil {
+				c.scope.vars[node.Catch.Err.Ident] = nil
+			}
+			c.list(node.Catch.List)
+			c.popScope()
+		}
+	case *ReturnNode:
+		c.expression(node.Value)
+	case *TranslationNode:
+		c.expression(node.Key)
+		c.pushScope()
+		if node.Count != nil {
+			c.scope.vars["count"] = c.expression(node.Count)
+		}
+		for _, p := range node.Parameters {
+			c.scope.vars[p.Identifier] = c.expression(p.Expression)
+		}
+		c.list(node.List)
+		c.popScope()
+	case *BlockNode:
+		c.block(node.Parameters, node.Expression, node.List)
+		c.list(node.Content)
+	case *YieldNode:
+		if node.Parameters != nil {
+			for _, p := range node.Parameters.List {
+				if p.Expression != nil {
+					c.expression(p.Expression)
+				}
+			}
+		}
+		if node.Expression != nil {
+			c.expression(node.Expression)
+		}
+		c.list(node.Content)
+	case *IncludeNode:
+		c.include(node)
+	}
+}
+
+// block checks the list of a block in the context it's declared in.
+func (c *checker) block(params *BlockParameterList, context Expression, list *ListNode) {
+	c.pushScope()
+	defer c.popScope()
+	if params != nil {
+		for _, p := range params.List {
+			var typ reflect.Type
+			if p.Expression != nil {
+				typ = c.expression(p.Expression)
+			}
+			c.scope.vars[p.Identifier] = typ
+		}
+	}
+	if context != nil {
+		saved := c.context
+		defer func() { c.context = saved }()
+		c.context = c.expression(context)
+	}
+	c.list(list)
+}
+
+func (c *checker) include(node *IncludeNode) {
+	c.expression(node.Name)
+	context := c.context
+	if node.Context != nil {
+		context = c.expression(node.Context)
+	}
+	name, ok := node.Name.(*StringNode)
+	if !ok {
+		return
+	}
+	t, err := c.set.getSiblingTemplate(name.Text, node.TemplatePath, true)
+	if err != nil {
+		c.report(node.error(errors.NotFoundTemplateReason, err.Error()))
+		return
+	}
+	c.template(t, context)
+}
+
+func (c *checker) setNode(set *SetNode) {
+	if set.IndexExprGetLookup {
+		typ := c.expression(set.Right[0])
+		c.assign(set, set.Left[0], typ)
+		c.assign(set, set.Left[1], reflect.TypeOf(false))
+		return
+	}
+	for i, left := range set.Left {
+		c.assign(set, left, c.expression(set.Right[i]))
+	}
+}
+
+func (c *checker) assign(set *SetNode, left Expression, typ reflect.Type) {
+	switch left.Type() {
+	case NodeUnderscore:
+	case NodeIdentifier:
+		name := left.(*IdentifierNode).Ident
+		if set.Let {
+			c.scope.vars[name] = typ
+			return
+		}
+		// an assignment keeps the variable's declared type, unless it's unknown
+		for sc := c.scope; sc != nil; sc = sc.parent {
+			if declared, ok := sc.vars[name]; ok {
+				if declared == nil {
+					sc.vars[name] = typ
+				}
+				return
+			}
+		}
+	default:
+		c.expression(left)
+	}
+}
+
+func (c *checker) rangeNode(node *RangeNode) {
+	c.pushScope()
+	defer c.popScope()
+	saved := c.context
+	defer func() { c.context = saved }()
+
+	expression := node.Expression
+	if node.Set != nil {
+		expression = node.Set.Right[0]
+	}
+	typ := c.expression(expression)
+	keyType, valueType, providesIndex, ok := rangeTypes(typ)
+	if !ok {
+		c.report(expression.error(errors.NotRangeableReason, fmt.Sprintf("%s (type %s) is not rangeable", expression, typ)))
+	}
+
+	if node.Set == nil {
+		c.context = valueType
+	} else if len(node.Set.Left) > 1 {
+		if ok && !providesIndex {
+			c.report(node.error(errors.NotRangeableReason, fmt.Sprintf("two-var range over %s, which does not provide an index", typ)))
+		}
+		c.rangeVar(node.Set, node.Set.Left[0], keyType)
+		c.rangeVar(node.Set, node.Set.Left[1], valueType)
+	} else if providesIndex {
+		c.rangeVar(node.Set, node.Set.Left[0], keyType)
+		c.context = valueType
+	} else {
+		c.rangeVar(node.Set, node.Set.Left[0], valueType)
+	}
+	c.list(node.List)
+	c.context = saved
+	c.list(node.ElseList)
+}
+
+func (c *checker) rangeVar(set *SetNode, left Expression, typ reflect.Type) {
+	if set.Let {
+		if left.Type() == NodeIdentifier {
+			c.scope.vars[left.(*IdentifierNode).Ident] = typ
+		}
+		return
+	}
+	c.assign(set, left, typ)
+}
+
+// rangeTypes returns the types of the keys and values of ranging over typ. providesIndex is true
+// if typ may provide keys. ok is false if typ is known not to be rangeable.
+func rangeTypes(typ reflect.Type) (keyType, valueType reflect.Type, providesIndex, ok bool) {
+	if typ == nil || typ.Implements(rangerType) || typ.Kind() == reflect.Interface {
+		return nil, nil, true, true
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array:
+		return reflect.TypeOf(0), known(typ.Elem()), true, true
+	case reflect.Map:
+		return known(typ.Key()), known(typ.Elem()), true, true
+	case reflect.Chan:
+		return nil, known(typ.Elem()), false, true
+	}
+	return nil, nil, false, false
+}
+
+func (c *checker) pipeline(pipe *PipeNode) reflect.Type {
+	var typ reflect.Type
+	for i, cmd := range pipe.Cmds {
+		term := c.expression(cmd.BaseExpr)
+		args := c.expressions(cmd.Exprs)
+		switch {
+		case i > 0:
+			if !cmd.HasPipeSlot {
+				args++
+			}
+			typ = c.call(cmd.BaseExpr, term, args)
+		case cmd.Exprs != nil:
+			typ = c.call(cmd.BaseExpr, term, args)
+		default:
+			typ = term
+		}
+	}
+	return typ
+}
+
+func (c *checker) expressions(exprs []Expression) int {
+	for _, expr := range exprs {
+		c.expression(expr)
+	}
+	return len(exprs)
+}
+
+// call checks a call of fn, of type typ, with args arguments and returns the type of the result.
+func (c *checker) call(fn Node, typ reflect.Type, args int) reflect.Type {
+	if typ == nil || typ == funcType || typ == errFuncType || typ == safeWriterType {
+		return nil
+	}
+	if typ.Kind() != reflect.Func {
+		c.report(fn.error(errors.UnexpectedExpressionTypeReason, fmt.Sprintf("%s (type %s) is not a function", fn, typ)))
+		return nil
+	}
+	required := typ.NumIn()
+	if typ.IsVariadic() {
+		required--
+		if args < required {
+			c.report(fn.error(errors.InvalidNumberOfArgumentsReason, fmt.Sprintf("%s needs at least %d arguments, but has %d", fn, required, args)))
+		}
+	} else if args != required {
+		c.report(fn.error(errors.InvalidNumberOfArgumentsReason, fmt.Sprintf("%s needs %d arguments, but has %d", fn, required, args)))
+	}
+	if typ.NumOut() == 0 || typ.Out(0) == errorType {
+		return nil
+	}
+	return known(typ.Out(0))
+}
+
+// member returns the type of the field, method or map value name of typ, reporting unknown fields and methods.
+func (c *checker) member(node Node, typ reflect.Type, name string, lax bool) reflect.Type {
+	if typ == nil {
+		return nil
+	}
+	if method, ok := methodType(typ, name); ok {
+		return method
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Interface:
+		return nil
+	case reflect.Map:
+		if typ.Key().Kind() == reflect.String {
+			return known(typ.Elem())
+		}
+	case reflect.Struct:
+		if index, ok := structFieldIndex(typ)[name]; ok {
+			return known(typ.FieldByIndex(index).Type)
+		}
+		if field, ok := typ.FieldByName(name); ok {
+			if field.PkgPath != "" {
+				c.report(node.error(errors.InvalidIndexReason, fmt.Sprintf("%s is an unexported field of struct type %s", name, typ)))
+				return nil
+			}
+			return known(field.Type)
+		}
+	}
+	if !lax {
+		c.report(node.error(errors.NotFoundFieldOrMethodReason, fmt.Sprintf("there is no field or method '%s' in %s", name, typ)))
+	}
+	return nil
+}
+
+// methodType returns the type of the method value name of typ, which includes the methods of *typ.
+func methodType(typ reflect.Type, name string) (reflect.Type, bool) {
+	if typ.Kind() == reflect.Interface {
+		method, ok := typ.MethodByName(name)
+		return method.Type, ok
+	}
+	if typ.Kind() != reflect.Ptr {
+		typ = reflect.PtrTo(typ)
+	}
+	method, ok := typ.MethodByName(name)
+	if !ok {
+		return nil, false
+	}
+	// drop the receiver
+	in := make([]reflect.Type, method.Type.NumIn()-1)
+	for i := range in {
+		in[i] = method.Type.In(i + 1)
+	}
+	out := make([]reflect.Type, method.Type.NumOut())
+	for i := range out {
+		out[i] = method.Type.Out(i)
+	}
+	return reflect.FuncOf(in, out, method.Type.IsVariadic()), true
+}
+
+// expression checks expr and returns its type, nil if it's unknown.
+func (c *checker) expression(expr Expression) reflect.Type {
+	switch expr := expr.(type) {
+	case *StringNode:
+		return reflect.TypeOf("")
+	case *BoolNode:
+		return reflect.TypeOf(false)
+	case *NumberNode:
+		switch {
+		case expr.IsFloat:
+			return reflect.TypeOf(float64(0))
+		case expr.IsInt:
+			return reflect.TypeOf(int64(0))
+		case expr.IsUint:
+			return reflect.TypeOf(uint64(0))
+		}
+	case *IdentifierNode:
+		return c.lookup(expr.Ident)
+	case *FieldNode:
+		typ := c.context
+		for _, id := range expr.Idents {
+			typ = c.member(expr, typ, id.name, id.lax)
+		}
+		return typ
+	case *ChainNode:
+		var typ reflect.Type
+		switch base := expr.Node.(type) {
+		case *PipeNode:
+			typ = c.pipeline(base)
+		case Expression:
+			typ = c.expression(base)
+		}
+		for i, id := range expr.Idents {
+			errs := len(c.errs)
+			typ = c.member(expr, typ, id.name, id.lax)
+			if len(c.errs) > errs {
+				last := c.errs[len(c.errs)-1]
+				c.errs[len(c.errs)-1] = expr.errorField(last.Reason(), last.Message(), i)
+			}
+		}
+		return typ
+	case *PipeNode:
+		return c.pipeline(expr)
+	case *AdditiveExprNode:
+		left := c.optional(expr.Left)
+		c.expression(expr.Right)
+		if left != nil && left.Kind() == reflect.String {
+			return left
+		}
+	case *MultiplicativeExprNode:
+		c.expression(expr.Left)
+		c.expression(expr.Right)
+	case *ComparativeExprNode, *NumericComparativeExprNode, *LogicalExprNode:
+		var node *binaryExprNode
+		switch expr := expr.(type) {
+		case *ComparativeExprNode:
+			node = &expr.binaryExprNode
+		case *NumericComparativeExprNode:
+			node = &expr.binaryExprNode
+		case *LogicalExprNode:
+			node = &expr.binaryExprNode
+		}
+		c.expression(node.Left)
+		c.expression(node.Right)
+		return reflect.TypeOf(false)
+	case *NotExprNode:
+		c.expression(expr.Expr)
+		return reflect.TypeOf(false)
+	case *TernaryExprNode:
+		c.expression(expr.Boolean)
+		left, right := c.expression(expr.Left), c.expression(expr.Right)
+		if left == right {
+			return left
+		}
+	case *CallExprNode:
+		if isIsset(expr.BaseExpr) {
+			return reflect.TypeOf(false)
+		}
+		return c.call(expr.BaseExpr, c.expression(expr.BaseExpr), c.expressions(expr.Exprs))
+	case *IndexExprNode:
+		base := c.expression(expr.Base)
+		index := c.expression(expr.Index)
+		if str, ok := expr.Index.(*StringNode); ok {
+			return c.member(expr, base, str.Text, expr.Lax)
+		}
+		return indexType(base, index)
+	case *SliceExprNode:
+		base := c.expression(expr.Base)
+		c.optional(expr.Index)
+		c.optional(expr.EndIndex)
+		if base != nil && base.Kind() == reflect.Array {
+			return reflect.SliceOf(base.Elem())
+		}
+		return base
+	}
+	return nil
+}
+
+func (c *checker) optional(expr Expression) reflect.Type {
+	if expr == nil {
+		return nil
+	}
+	return c.expression(expr)
+}
+
+// indexType returns the type of base[index].
+func indexType(base, index reflect.Type) reflect.Type {
+	if base == nil {
+		return nil
+	}
+	for base.Kind() == reflect.Ptr {
+		base = base.Elem()
+	}
+	switch base.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return known(base.Elem())
+	case reflect.String:
+		return reflect.TypeOf(uint8(0))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package jet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+type checkPage struct {
+	Title string
+	User  *User
+	Users []*User
+	Tags  map[string]int
+	Count int
+	Data  interface{}
+}
+
+func TestCheck(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l, WithTypes((*checkPage)(nil), (*User)(nil)))
+	set.AddGlobal("greet", func(name string, times int) string { return "" })
+
+	tests := []struct {
+		name, content string
+		env           TypeEnv
+		errors        []string // substrings of the expected errors, in order
+	}{
+		{"valid", `{* @context *jet.checkPage *}{{ .Title }}{{ .User.Name }}{{ .User.Format("%s") }}{{ range i, u := .Users }}{{ i }}{{ u.GetName() }}{{ end }}{{ range k, v := .Tags }}{{ k }}{{ v }}{{ end }}{{ .Data.Anything }}{{ greet(.Title, 2) }}`, TypeEnv{}, nil},
+		{"fieldTypo", `{* @context *jet.checkPage *}{{ .Usre.Name }}{{ .User.Nmae }}`, TypeEnv{}, []string{"no field or method 'Usre' in jet.checkPage", "no field or method 'Nmae' in jet.User"}},
+		{"envContext", `{{ .Title }}{{ .Titel }}`, TypeEnv{Context: reflect.TypeOf(checkPage{})}, []string{"no field or method 'Titel'"}},
+		{"varDeclaration", `{* @var user *jet.User *}{{ user.Email }}{{ user.Mail }}`, TypeEnv{}, []string{"no field or method 'Mail' in jet.User"}},
+		{"envVars", `{{ u.Email }}{{ u?.Mail }}{{ unknown.Anything }}{{ u.Mail }}`, TypeEnv{Vars: map[string]reflect.Type{"u": reflect.TypeOf(&User{})}}, []string{"no field or method 'Mail'"}},
+		{"arguments", `{* @context *jet.checkPage *}{{ greet(.Title) }}{{ .User.Format() }}{{ .Title | greet: 1, 2 }}{{ .Title | greet: 1 }}`, TypeEnv{}, []string{"greet needs 2 arguments, but has 1", "needs 1 arguments, but has 0", "greet needs 2 arguments, but has 3"}},
+		{"range", `{* @context *jet.checkPage *}{{ range .Count }}{{ end }}{{ range .Users }}{{ .Nme }}{{ end }}`, TypeEnv{}, []string{"is not rangeable", "no field or method 'Nme'"}},
+		{"scopes", `{* @context *jet.checkPage *}{{ u := .User }}{{ u.Name }}{{ if v := .Users[0]; v }}{{ v.Mail }}{{ end }}{{ u.Mail }}`, TypeEnv{}, []string{"'Mail' in jet.User", "'Mail' in jet.User"}},
+		{"include", `{* @context *jet.checkPage *}{{ include "/partial" .User }}{{ include "/missing" }}`, TypeEnv{}, []string{"/partial:1:", "template /missing could not be found"}},
+		{"unknownType", `{* @context *models.Page *}{{ .Anything }}`, TypeEnv{}, []string{`unknown type "*models.Page" in @context declaration`}},
+	}
+	l.Set("/partial", `{{ .Name }}{{ .Nmae }}`)
+	for _, test := range tests {
+		l.Set(test.name, test.content)
+		err := set.Check(test.name, test.env)
+		if len(test.errors) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		checkErrs, ok := err.(CheckErrors)
+		if !ok || len(checkErrs) != len(test.errors) {
+			t.Errorf("%s: expected %d errors, got %v", test.name, len(test.errors), err)
+			continue
+		}
+		for i, expected := range test.errors {
+			if !strings.Contains(checkErrs[i].Error(), expected) {
+				t.Errorf("%s: expected error %d to contain %q, got %q", test.name, i, expected, checkErrs[i])
+			}
+		}
+	}
+}
+
+func TestCheckPositionAndReason(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l)
+	l.Set("chain", "\n{{ u.Email.Nope }}")
+	err := set.Check("chain", TypeEnv{Vars: map[string]reflect.Type{"u": reflect.TypeOf(User{})}})
+	checkErrs, ok := err.(CheckErrors)
+	if !ok || len(checkErrs) != 1 {
+		t.Fatalf("expected one error, got %v", err)
+	}
+	if checkErrs[0].Reason() != errors.NotFoundFieldOrMethodReason || checkErrs[0].Position().L != 2 {
+		t.Errorf("unexpected error %v", checkErrs[0])
+	}
+
+	l.Set("unknownType", `{* @context *models.Page *}{{ .Anything }}`)
+	if err := set.Check("unknownType", TypeEnv{IgnoreUnknownTypes: true}); err != nil {
+		t.Errorf("expected no error with IgnoreUnknownTypes, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func ast(args []string) error {
+	fs := flag.NewFlagSet("ast", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directory of the templates")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jet ast [-dir dir] template")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	set := jet.NewSet(jet.NewOSFileSystemLoader(*dir))
+	t, err := set.GetTemplate(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	dumpNode(os.Stdout, "", "", t.Root)
+	return nil
+}
+
+var nodeType = reflect.TypeOf((*jet.Node)(nil)).Elem()
+
+// dumpNode prints node and, indented below it, the nodes it contains, found by reflection on the exported fields.
+func dumpNode(w io.Writer, indent, label string, node jet.Node) {
+	v := reflect.ValueOf(node).Elem()
+	fmt.Fprintf(w, "%s%s%s", indent, label, strings.TrimPrefix(v.Type().Name(), "jet."))
+	if line := v.FieldByName("Line"); line.IsValid() && line.Int() > 0 {
+		fmt.Fprintf(w, " line %d", line.Int())
+	}
+
+	var children []func()
+	var attributes []string
+	collectFields(v, indent+"  ", "", w, &children, &attributes)
+	switch {
+	case len(attributes) > 0:
+		fmt.Fprintf(w, " %s", strings.Join(attributes, " "))
+	case len(children) == 0:
+		if s := summary(node); s != "" {
+			fmt.Fprintf(w, " %s", s)
+		}
+	}
+	fmt.Fprintln(w)
+	for _, child := range children {
+		child()
+	}
+}
+
+func collectFields(v reflect.Value, indent, prefix string, w io.Writer, children *[]func(), attributes *[]string) {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if field.Name == "NodeBase" || field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && value.Kind() == reflect.Struct {
+			collectFields(value, indent, prefix, w, children, attributes)
+			continue
+		}
+		collectValue(value, indent, prefix+field.Name, w, children, attributes)
+	}
+}
+
+func collectValue(value reflect.Value, indent, label string, w io.Writer, children *[]func(), attributes *[]string) {
+	if value.Type().Implements(nodeType) || value.Type() == nodeType {
+		if (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && value.IsNil() {
+			return
+		}
+		node := value.Interface().(jet.Node)
+		*children = append(*children, func() { dumpNode(w, indent, label+": ", node) })
+		return
+	}
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() && value.Elem().Kind() == reflect.Struct {
+			collectFields(value.Elem(), indent, label+".", w, children, attributes)
+		}
+	case reflect.Struct:
+		collectFields(value, indent, label+".", w, children, attributes)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < value.Len(); i++ {
+			collectValue(value.Index(i), indent, fmt.Sprintf("%s[%d]", label, i), w, children, attributes)
+		}
+	case reflect.String:
+		if value.String() != "" {
+			*attributes = append(*attributes, fmt.Sprintf("%s=%q", label, value.String()))
+		}
+	case reflect.Bool:
+		if value.Bool() {
+			*attributes = append(*attributes, label)
+		}
+	}
+}
+
+// summary returns the source of leaf nodes, shortened for long text.
+func summary(node jet.Node) string {
+	if text, ok := node.(*jet.TextNode); ok {
+		s := string(text.Text)
+		if len(s) > 40 {
+			s = s[:37] + "..."
+		}
+		return fmt.Sprintf("%q", s)
+	}
+	return node.String()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func check(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	strict := fs.Bool("strict", false, "report type declarations naming Go types (the command only knows the predeclared ones)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jet check [-strict] dir")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	set := jet.NewSet(jet.NewOSFileSystemLoader(fs.Arg(0)))
+	failed := false
+	err := walkTemplates(fs.Arg(0), func(path string) error {
+		err := set.Check(path, jet.TypeEnv{IgnoreUnknownTypes: !*strict})
+		if err != nil {
+			failed = true
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed {
+		return errors.New("check failed")
+	}
+	return nil
+}
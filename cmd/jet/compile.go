@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func compile(args []string) error {
+	fs := flag.NewFlagSet("compile", flag.ExitOnError)
+	pkg := fs.String("pkg", "templates", "package name of the generated file")
+	varName := fs.String("var", "Templates", "name of the generated map of templates")
+	out := fs.String("o", "", "output file (default standard output)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jet compile [-pkg name] [-var name] [-o file] dir")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := fs.Arg(0)
+
+	set := jet.NewSet(jet.NewOSFileSystemLoader(dir))
+	c := jet.NewCompiler(*pkg)
+	c.Var = *varName
+	err := walkTemplates(dir, func(path string) error {
+		t, err := set.GetTemplate(path)
+		if err != nil {
+			return err
+		}
+		if err := c.Add(t); err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %v\n", t.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if c.Len() == 0 {
+		return errors.New("no template could be compiled")
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(*out, buf.Bytes(), 0644)
+}
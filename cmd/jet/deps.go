@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func deps(args []string) error {
+	fs := flag.NewFlagSet("deps", flag.ExitOnError)
+	dot := fs.Bool("dot", false, "print the graph in the Graphviz dot language")
+	unused := fs.Bool("unused", false, "only print the templates no other template depends on")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jet deps [-dot | -unused] dir")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	set := jet.NewSet(jet.NewOSFileSystemLoader(fs.Arg(0)))
+	var templates []string
+	graph := map[string][]jet.Dependency{}
+	failed := false
+	err := walkTemplates(fs.Arg(0), func(path string) error {
+		dependencies, err := set.Dependencies(path)
+		if err != nil {
+			failed = true
+			fmt.Fprintln(os.Stderr, err)
+			return nil
+		}
+		templates = append(templates, path)
+		graph[path] = dependencies
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *unused:
+		for _, path := range templates {
+			if len(set.Dependents(path)) == 0 {
+				fmt.Println(path)
+			}
+		}
+	case *dot:
+		fmt.Println("digraph templates {")
+		for _, path := range templates {
+			fmt.Printf("\t%q;\n", path)
+			for _, d := range graph[path] {
+				if d.Path == "" {
+					fmt.Printf("\t%q -> %q [label=%q, style=dashed];\n", path, d.Name, d.Kind)
+				} else {
+					fmt.Printf("\t%q -> %q [label=%q];\n", path, d.Path, d.Kind)
+				}
+			}
+		}
+		fmt.Println("}")
+	default:
+		for _, path := range templates {
+			fmt.Println(path)
+			for _, d := range graph[path] {
+				switch {
+				case d.Dynamic:
+					fmt.Printf("\t%s %s (dynamic, line %d)\n", d.Kind, d.Name, d.Line)
+				case d.Path == "":
+					fmt.Printf("\t%s %s (not found, line %d)\n", d.Kind, d.Name, d.Line)
+				default:
+					fmt.Printf("\t%s %s (line %d)\n", d.Kind, d.Path, d.Line)
+				}
+			}
+		}
+	}
+	if failed {
+		return errors.New("some templates could not be loaded")
+	}
+	return nil
+}
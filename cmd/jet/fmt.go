@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func formatTemplates(args []string) error {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	list := fs.Bool("l", false, "list files whose formatting differs from jet fmt's")
+	write := fs.Bool("w", false, "write the result to the file instead of stdout")
+	reindent := fs.Bool("reindent", false, "indent lines by the nesting level of statements")
+	indent := fs.String("indent", "\t", "indentation of one nesting level with -reindent")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jet fmt [-l] [-w] [-reindent [-indent str]] [path ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	f := formatter{list: *list, write: *write, opts: jet.FormatOptions{Reindent: *reindent, Indent: *indent}}
+
+	if fs.NArg() == 0 {
+		if f.write {
+			return errors.New("cannot use -w with stdin")
+		}
+		return f.file("<stdin>")
+	}
+
+	failed := false
+	for _, root := range fs.Args() {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// files named on the command line are formatted whatever their extension
+			if info.IsDir() || path != root && !isTemplate(path) {
+				return nil
+			}
+			if err := f.file(path); err != nil {
+				failed = true
+				fmt.Fprintln(os.Stderr, err)
+			}
+			return nil
+		})
+		if err != nil {
+			failed = true
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if failed {
+		return errors.New("some templates could not be formatted")
+	}
+	return nil
+}
+
+// formatter formats template files with jet.Format, like the jetfmt command.
+type formatter struct {
+	list, write bool
+	opts        jet.FormatOptions
+}
+
+func (f formatter) file(path string) error {
+	var src []byte
+	var err error
+	if path == "<stdin>" {
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	out, err := jet.Format(string(src), f.opts)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	changed := !bytes.Equal(src, []byte(out))
+
+	if f.list && changed {
+		fmt.Println(path)
+	}
+	if f.write {
+		if changed {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(path, []byte(out), info.Mode().Perm())
+		}
+		return nil
+	}
+	if !f.list {
+		fmt.Print(out)
+	}
+	return nil
+}
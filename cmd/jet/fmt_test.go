@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jet-fmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "index.jet")
+	if err := ioutil.WriteFile(file, []byte("{{if true}}\n<p>{{x}}</p>\n{{end}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := formatTemplates([]string{"-w", "-reindent", dir}); err != nil {
+		t.Fatal(err)
+	}
+	formatted, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{{ if true }}\n\t<p>{{ x }}</p>\n{{ end }}\n"; string(formatted) != expected {
+		t.Errorf("expected %q, got %q", expected, formatted)
+	}
+}
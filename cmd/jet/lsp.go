@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CloudyKit/jet/v6/lsp"
+)
+
+func serveLSP(args []string) error {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directory of the templates")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jet lsp [-dir dir]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return lsp.NewServer(*dir).Serve(os.Stdin, os.Stdout)
+}
@@ -0,0 +1,85 @@
+// Command jet works with Jet templates from the command line.
+//
+// Usage:
+//
+//	jet render [-dir dir] [-data file] [-vars file] [-format format] template
+//	jet check [-strict] dir
+//	jet fmt [-l] [-w] [-reindent [-indent str]] [path ...]
+//	jet deps [-dot | -unused] dir
+//	jet ast [-dir dir] template
+//	jet compile [-pkg name] [-var name] [-o file] dir
+//	jet lsp [-dir dir]
+//
+// render executes a template with the context and variables read from JSON or YAML files, or stdin.
+// check parses the templates found in dir and checks them against the types they declare, see jet.Set.Check.
+// fmt formats templates like the jetfmt command does, see jet.Format.
+// deps prints the templates each template found in dir extends, imports and includes, see jet.Set.Dependencies.
+// ast prints the parse tree of a template.
+// compile generates Go code rendering the templates found in dir, see jet.Compiler.
+// lsp runs a Language Server Protocol server for the templates in dir over stdio, see package lsp.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var commands = map[string]func(args []string) error{
+	"render":  render,
+	"check":   check,
+	"fmt":     formatTemplates,
+	"deps":    deps,
+	"ast":     ast,
+	"compile": compile,
+	"lsp":     serveLSP,
+}
+
+// templateExtensions are the file extensions of the templates the commands look for.
+var templateExtensions = []string{".jet", ".html.jet", ".jet.html"}
+
+// walkTemplates calls fn with the path of every template in dir, relative to dir.
+func walkTemplates(dir string, fn func(path string) error) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !isTemplate(path) {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return fn("/" + filepath.ToSlash(rel))
+	})
+}
+
+func isTemplate(name string) bool {
+	for _, ext := range templateExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: jet <command> [arguments]\n\ncommands:\n  render   execute a template with data from JSON or YAML files\n  check    check templates for parse and type errors\n  fmt      format templates\n  deps     print the dependencies of templates\n  ast      print the parse tree of a template\n  compile  generate Go code rendering templates\n  lsp      run a language server for editors")
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+	}
+	if err := cmd(flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "jet:", err)
+		os.Exit(1)
+	}
+}
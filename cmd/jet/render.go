@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+	"gopkg.in/yaml.v3"
+)
+
+func render(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directory of the templates")
+	data := fs.String("data", "", "JSON or YAML `file` with the context, - for stdin")
+	vars := fs.String("vars", "", "JSON or YAML `file` with an object holding the variables, - for stdin")
+	format := fs.String("format", "", "`format` of the data and vars files, json or yaml; by default, files ending in .yaml or .yml are YAML, everything else is JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jet render [-dir dir] [-data file] [-vars file] [-format format] template")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *data == "-" && *vars == "-" {
+		return errors.New("only one of -data and -vars can be read from stdin")
+	}
+	if *format != "" && *format != "json" && *format != "yaml" {
+		return fmt.Errorf("unknown format %q, use json or yaml", *format)
+	}
+
+	var context interface{}
+	if *data != "" {
+		if err := decodeFile(*data, *format, &context); err != nil {
+			return err
+		}
+	}
+	var variables jet.VarMap
+	if *vars != "" {
+		var values map[string]interface{}
+		if err := decodeFile(*vars, *format, &values); err != nil {
+			return err
+		}
+		variables = jet.VarMap{}
+		for name, value := range values {
+			variables.Set(name, value)
+		}
+	}
+
+	set := jet.NewSet(jet.NewOSFileSystemLoader(*dir))
+	t, err := set.GetTemplate(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return t.Execute(os.Stdout, variables, context)
+}
+
+// decodeFile decodes the file, or stdin for "-", into v. Unless format is given, files ending in .yaml or .yml
+// are decoded as YAML and everything else as JSON.
+func decodeFile(file, format string, v interface{}) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = "json"
+		if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+			format = "yaml"
+		}
+	}
+	if format == "yaml" {
+		err = yaml.Unmarshal(content, v)
+	} else {
+		err = json.Unmarshal(content, v)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jet-render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	expected := map[string]interface{}{"title": "Jet", "tags": []interface{}{"a", "b"}}
+	tests := []struct {
+		name, format, content string
+	}{
+		{"data.json", "", `{"title": "Jet", "tags": ["a", "b"]}`},
+		{"data.yaml", "", "title: Jet\ntags: [a, b]\n"},
+		{"data.YML", "", "title: Jet\ntags:\n  - a\n  - b\n"},
+		{"data.txt", "yaml", "title: Jet\ntags: [a, b]\n"},
+		{"data.yaml", "json", `{"title": "Jet", "tags": ["a", "b"]}`},
+	}
+	for _, test := range tests {
+		file := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(file, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var v map[string]interface{}
+		if err := decodeFile(file, test.format, &v); err != nil {
+			t.Errorf("%s (%q): %v", test.name, test.format, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("%s (%q): expected %v, got %v", test.name, test.format, expected, v)
+		}
+	}
+
+	file := filepath.Join(dir, "invalid.json")
+	if err := ioutil.WriteFile(file, []byte("title: Jet"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var v interface{}
+	if err := decodeFile(file, "", &v); err == nil {
+		t.Errorf("expected YAML in a .json file to fail")
+	}
+}
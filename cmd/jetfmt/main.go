@@ -0,0 +1,124 @@
+// Command jetfmt formats Jet templates, see jet.Format.
+//
+// Usage:
+//
+//	jetfmt [-l] [-w] [-reindent [-indent str]] [path ...]
+//
+// Without paths, jetfmt formats stdin to stdout. Directories are searched for templates ending in .jet,
+// .html.jet and .jet.html. By default, the formatted templates are printed to stdout.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+var (
+	list     = flag.Bool("l", false, "list files whose formatting differs from jetfmt's")
+	write    = flag.Bool("w", false, "write the result to the file instead of stdout")
+	reindent = flag.Bool("reindent", false, "indent lines by the nesting level of statements")
+	indent   = flag.String("indent", "\t", "indentation of one nesting level with -reindent")
+)
+
+var templateExtensions = []string{".jet", ".html.jet", ".jet.html"}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: jetfmt [-l] [-w] [-reindent [-indent str]] [path ...]")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	opts := jet.FormatOptions{Reindent: *reindent, Indent: *indent}
+
+	if flag.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "jetfmt: cannot use -w with stdin")
+			os.Exit(2)
+		}
+		if err := formatFile("<stdin>", opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	failed := false
+	for _, root := range flag.Args() {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// files named on the command line are formatted whatever their extension
+			if info.IsDir() || path != root && !isTemplate(path) {
+				return nil
+			}
+			if err := formatFile(path, opts); err != nil {
+				failed = true
+				fmt.Fprintln(os.Stderr, err)
+			}
+			return nil
+		})
+		if err != nil {
+			failed = true
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func formatFile(path string, opts jet.FormatOptions) error {
+	var src []byte
+	var err error
+	if path == "<stdin>" {
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	out, err := jet.Format(string(src), opts)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	changed := !bytes.Equal(src, []byte(out))
+
+	if *list && changed {
+		fmt.Println(path)
+	}
+	if *write {
+		if changed {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(path, []byte(out), info.Mode().Perm())
+		}
+		return nil
+	}
+	if !*list {
+		fmt.Print(out)
+	}
+	return nil
+}
+
+func isTemplate(name string) bool {
+	for _, ext := range templateExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
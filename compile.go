@@ -0,0 +1,696 @@
+package jet
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+// Compiler generates Go source code for templates, which then render without being loaded and parsed at runtime.
+// The generated file declares a map of CompiledTemplate by template path, to be passed to WithCompiledTemplates.
+//
+// The compiler supports text, actions, variables, if, range (including break and continue) and include.
+// Templates using other statements, like extends, import, block, yield, try, return, trans or msg,
+// are not compiled and keep being loaded and interpreted at runtime, as are all templates of Sets
+// using contextual escaping.
+//
+// The generated code writes text directly and evaluates literals and the operators applied to them with Go's
+// types and operators. Other values are reflect.Values: operators, comparisons, variables, fields and calls
+// are evaluated by methods of Runtime working on these values, with the same rules as in interpreted templates.
+type Compiler struct {
+	// Package is the package name of the generated file.
+	Package string
+	// Var is the name of the generated map variable, "Templates" by default.
+	Var string
+
+	templates []compiledTemplate
+}
+
+type compiledTemplate struct {
+	path    string
+	index   int
+	code    []byte
+	vars    []string
+	reflect bool   // whether the code uses the reflect package
+	hash    string // hash of the template source
+}
+
+// NewCompiler returns a new Compiler generating code for the package pkg.
+func NewCompiler(pkg string) *Compiler {
+	return &Compiler{Package: pkg, Var: "Templates"}
+}
+
+// Add generates the code for t. If t uses a statement the compiler doesn't support, Add returns an error
+// with reason errors.NotCompilableReason and t is left out of the generated file.
+func (c *Compiler) Add(t *Template) error {
+	if t.compiled != nil {
+		return fmt.Errorf("template %s is compiled already", t.Name)
+	}
+	if t.set.contextualEscaping {
+		return t.Root.error(errors.NotCompilableReason, "templates using contextual escaping can't be compiled")
+	}
+	if t.extends != nil || len(t.imports) > 0 {
+		return t.Root.error(errors.NotCompilableReason, "templates using extends or import can't be compiled")
+	}
+	g := &generator{index: len(c.templates), names: map[string]string{}}
+	g.printf("func render%d(rt *jet.Runtime) {\n", g.index)
+	if _, err := g.list(t.Root); err != nil {
+		return err
+	}
+	g.printf("}\n")
+	c.templates = append(c.templates, compiledTemplate{path: t.Name, index: g.index, code: g.buf.Bytes(), vars: g.vars, reflect: g.reflect, hash: sourceHash([]byte(t.text))})
+	return nil
+}
+
+// Len returns the number of templates added to the compiler.
+func (c *Compiler) Len() int {
+	return len(c.templates)
+}
+
+// WriteTo writes the generated, formatted source file to w.
+func (c *Compiler) WriteTo(w io.Writer) (int64, error) {
+	templates := append([]compiledTemplate(nil), c.templates...)
+	sort.Slice(templates, func(i, j int) bool { return templates[i].path < templates[j].path })
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by jet compile. DO NOT EDIT.\n\npackage %s\n\nimport (\n", c.Package)
+	var (
+		vars        []string
+		usesReflect bool
+	)
+	for _, t := range templates {
+		vars = append(vars, t.vars...)
+		usesReflect = usesReflect || t.reflect
+	}
+	if usesReflect {
+		buf.WriteString("\t\"reflect\"\n\n")
+	}
+	buf.WriteString("\t\"github.com/CloudyKit/jet/v6\"\n)\n\n")
+	fmt.Fprintf(&buf, "// %s holds the compiled templates, pass it to jet.WithCompiledTemplates.\n", c.Var)
+	fmt.Fprintf(&buf, "var %s = map[string]jet.CompiledTemplate{\n", c.Var)
+	for _, t := range templates {
+		fmt.Fprintf(&buf, "%s: {Render: render%d, Hash: %q},\n", strconv.Quote(t.path), t.index, t.hash)
+	}
+	buf.WriteString("}\n")
+	if len(vars) > 0 {
+		buf.WriteString("\nvar (\n")
+		for _, v := range vars {
+			buf.WriteString(v)
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(")\n")
+	}
+	for _, t := range templates {
+		fmt.Fprintf(&buf, "\n// %s\n", t.path)
+		buf.Write(t.code)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("formatting generated code: %v", err)
+	}
+	n, err := w.Write(src)
+	return int64(n), err
+}
+
+// generator generates the code of a single template.
+type generator struct {
+	index   int
+	buf     bytes.Buffer
+	vars    []string          // declarations of package level variables
+	names   map[string]string // names of the variables by value, to declare every value once
+	reflect bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// declare adds a package level variable and returns its name.
+func (g *generator) declare(prefix, value string) string {
+	if prefix == "value" {
+		g.reflect = true
+	}
+	if name, ok := g.names[value]; ok {
+		return name
+	}
+	name := fmt.Sprintf("%s%d_%d", prefix, g.index, len(g.vars))
+	g.vars = append(g.vars, name+" = "+value)
+	g.names[value] = name
+	return name
+}
+
+func (g *generator) at(node Node) {
+	col := 0
+	if n, ok := node.(interface{ column() int }); ok {
+		col = n.column()
+	}
+	g.printf("rt.At(%d, %d)\n", node.line(), col)
+}
+
+func unsupported(node Node, what string) errors.Error {
+	return node.error(errors.NotCompilableReason, fmt.Sprintf("%s can't be compiled", what))
+}
+
+// list generates the code of the nodes of list. It reports whether the list ends with a
+// break or continue, after which no code must follow.
+func (g *generator) list(list *ListNode) (terminated bool, err errors.Error) {
+	inNewScope := false
+	for _, node := range list.Nodes {
+		switch node.Type() {
+		case NodeText:
+			g.printf("rt.WriteRaw(%s)\n", g.declare("text", fmt.Sprintf("[]byte(%s)", strconv.Quote(string(node.(*TextNode).Text)))))
+		case NodeAction:
+			node := node.(*ActionNode)
+			g.at(node)
+			if node.Set != nil {
+				if node.Set.Let && !inNewScope {
+					inNewScope = true
+					g.printf("rt.EnterScope()\n")
+				}
+				if err := g.set(node.Set); err != nil {
+					return false, err
+				}
+			}
+			if node.Pipe != nil {
+				if err := g.pipeline(node.Pipe); err != nil {
+					return false, err
+				}
+			}
+		case NodeIf:
+			node := node.(*IfNode)
+			g.at(node)
+			if node.Set != nil {
+				if node.Set.Let {
+					g.printf("rt.EnterScope()\n")
+				}
+				if err := g.set(node.Set); err != nil {
+					return false, err
+				}
+			}
+			cond, err := g.typed(node.Expression)
+			if err != nil {
+				return false, err
+			}
+			g.printf("if %s {\n", g.condition(cond))
+			if _, err := g.list(node.List); err != nil {
+				return false, err
+			}
+			if node.ElseList != nil {
+				g.printf("} else {\n")
+				if _, err := g.list(node.ElseList); err != nil {
+					return false, err
+				}
+			}
+			g.printf("}\n")
+			if node.Set != nil && node.Set.Let {
+				g.printf("rt.LeaveScope()\n")
+			}
+		case NodeRange:
+			if err := g.rangeNode(node.(*RangeNode)); err != nil {
+				return false, err
+			}
+		case NodeInclude:
+			node := node.(*IncludeNode)
+			g.at(node)
+			name, err := g.expression(node.Name)
+			if err != nil {
+				return false, err
+			}
+			if node.Context == nil {
+				g.printf("rt.Include(%s)\n", name)
+				break
+			}
+			context, err := g.expression(node.Context)
+			if err != nil {
+				return false, err
+			}
+			g.printf("rt.Include(%s, %s)\n", name, context)
+		case NodeBreak:
+			g.printf("return false\n")
+			return true, nil
+		case NodeContinue:
+			g.printf("return true\n")
+			return true, nil
+		case NodeFlush:
+			g.at(node)
+			g.printf("rt.Flush()\n")
+		case NodeBlock:
+			return false, unsupported(node, "block")
+		case NodeYield:
+			return false, unsupported(node, "yield")
+		case NodeTry:
+			return false, unsupported(node, "try")
+		case NodeReturn:
+			return false, unsupported(node, "return")
+		case NodeTrans, NodeMsg:
+			return false, unsupported(node, "translation")
+		default:
+			return false, unsupported(node, fmt.Sprintf("%v", node))
+		}
+	}
+	if inNewScope {
+		g.printf("rt.LeaveScope()\n")
+	}
+	return false, nil
+}
+
+// identifiers returns the variable names assigned by set, "" for underscores.
+func identifiers(set *SetNode) ([]string, errors.Error) {
+	if set.IndexExprGetLookup {
+		return nil, unsupported(set, "index lookup with ok")
+	}
+	names := make([]string, len(set.Left))
+	for i, left := range set.Left {
+		switch left.Type() {
+		case NodeIdentifier:
+			names[i] = left.(*IdentifierNode).Ident
+		case NodeUnderscore:
+		default:
+			return nil, unsupported(left, "assignment to "+left.String())
+		}
+	}
+	return names, nil
+}
+
+func (g *generator) set(set *SetNode) errors.Error {
+	names, err := identifiers(set)
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		value, err := g.expression(set.Right[i])
+		if err != nil {
+			return err
+		}
+		switch {
+		case name == "":
+			g.printf("_ = %s\n", value)
+		case set.Let:
+			g.printf("rt.LetValue(%s, %s)\n", strconv.Quote(name), value)
+		default:
+			g.printf("rt.Assign(%s, %s)\n", strconv.Quote(name), value)
+		}
+	}
+	return nil
+}
+
+func (g *generator) rangeNode(node *RangeNode) errors.Error {
+	g.at(node)
+	method, expression, vars := "Range", node.Expression, ""
+	if node.Set != nil {
+		names, err := identifiers(node.Set)
+		if err != nil {
+			return err
+		}
+		method, expression = "RangeSet", node.Set.Right[0]
+		if node.Set.Let {
+			method = "RangeLet"
+		}
+		for _, name := range names {
+			if name == "" {
+				return unsupported(node, "range with underscore")
+			}
+			vars += ", " + strconv.Quote(name)
+		}
+	}
+	value, err := g.expression(expression)
+	if err != nil {
+		return err
+	}
+	if node.ElseList != nil {
+		g.printf("if !")
+	}
+	g.printf("rt.%s(%s, func() bool {\n", method, value)
+	terminated, err := g.list(node.List)
+	if err != nil {
+		return err
+	}
+	if !terminated {
+		g.printf("return true\n")
+	}
+	g.printf("}%s)", vars)
+	if node.ElseList != nil {
+		g.printf(" {\n")
+		if _, err := g.list(node.ElseList); err != nil {
+			return err
+		}
+		g.printf("}")
+	}
+	g.printf("\n")
+	return nil
+}
+
+func (g *generator) pipeline(pipe *PipeNode) errors.Error {
+	if cmd := pipe.Cmds[0]; len(pipe.Cmds) == 1 && cmd.Exprs == nil && !cmd.HasPipeSlot && !isIsset(cmd.BaseExpr) {
+		// a single value is printed directly
+		value, err := g.expression(cmd.BaseExpr)
+		if err != nil {
+			return err
+		}
+		g.printf("rt.Print(%s)\n", value)
+		return nil
+	}
+	g.printf("rt.Pipeline(")
+	for i, cmd := range pipe.Cmds {
+		if i > 0 {
+			g.printf(", ")
+		}
+		if cmd.HasPipeSlot {
+			return unsupported(cmd, "piped value slot")
+		}
+		if isIsset(cmd.BaseExpr) {
+			return unsupported(cmd, "isset")
+		}
+		term, err := g.expression(cmd.BaseExpr)
+		if err != nil {
+			return err
+		}
+		if cmd.Exprs == nil {
+			g.printf("jet.Command{Term: %s}", term)
+			continue
+		}
+		args, err := g.expressions(cmd.Exprs)
+		if err != nil {
+			return err
+		}
+		g.printf("jet.Command{Term: %s, Args: []reflect.Value{%s}, Call: true}", term, args)
+		g.reflect = true
+	}
+	g.printf(")\n")
+	return nil
+}
+
+func (g *generator) expressions(exprs []Expression) (string, errors.Error) {
+	args := make([]string, len(exprs))
+	for i, expr := range exprs {
+		arg, err := g.expression(expr)
+		if err != nil {
+			return "", err
+		}
+		args[i] = arg
+	}
+	return strings.Join(args, ", "), nil
+}
+
+// isIsset reports whether expr is the isset builtin, which inspects its arguments before evaluating them.
+func isIsset(expr Expression) bool {
+	id, ok := expr.(*IdentifierNode)
+	return ok && id.Ident == "isset"
+}
+
+// goType is the Go type of the code generated for an expression.
+type goType uint8
+
+const (
+	typeValue  goType = iota // reflect.Value
+	typeBool                 // bool
+	typeFloat                // float64, the type of number literals
+	typeString               // string
+)
+
+// goExpr is the Go code of an expression.
+type goExpr struct {
+	code     string
+	typ      goType
+	constant bool // whether code is a constant expression
+}
+
+// expression returns Go code evaluating expr to a reflect.Value.
+func (g *generator) expression(expr Expression) (string, errors.Error) {
+	e, err := g.typed(expr)
+	if err != nil {
+		return "", err
+	}
+	return g.value(e), nil
+}
+
+// value returns the code of e converted to a reflect.Value. Constants are declared once as package level variables.
+func (g *generator) value(e goExpr) string {
+	switch {
+	case e.typ == typeValue:
+		return e.code
+	case e.constant:
+		return g.declare("value", fmt.Sprintf("reflect.ValueOf(%s)", e.code))
+	}
+	g.reflect = true
+	return fmt.Sprintf("reflect.ValueOf(%s)", e.code)
+}
+
+// condition returns the code of e converted to a bool, following the rules of conditions in templates.
+func (g *generator) condition(e goExpr) string {
+	switch e.typ {
+	case typeBool:
+		return e.code
+	case typeFloat:
+		return fmt.Sprintf("(%s != 0)", e.code)
+	case typeString:
+		return fmt.Sprintf("(%s != \"\")", e.code)
+	}
+	return fmt.Sprintf("rt.Truth(%s)", e.code)
+}
+
+// typed returns Go code evaluating expr. Literals and the operators applied to them are evaluated with Go's
+// types and operators, comparisons and logical operators evaluate to bools, and everything else to reflect.Values.
+func (g *generator) typed(expr Expression) (goExpr, errors.Error) {
+	switch expr.Type() {
+	case NodeNil:
+		g.reflect = true
+		return goExpr{code: "reflect.Value{}"}, nil
+	case NodeBool:
+		return goExpr{code: strconv.FormatBool(expr.(*BoolNode).True), typ: typeBool, constant: true}, nil
+	case NodeString:
+		return goExpr{code: strconv.Quote(expr.(*StringNode).Text), typ: typeString, constant: true}, nil
+	case NodeNumber:
+		node := expr.(*NumberNode)
+		switch {
+		case node.IsFloat:
+			return goExpr{code: fmt.Sprintf("float64(%s)", strconv.FormatFloat(node.Float64, 'g', -1, 64)), typ: typeFloat, constant: true}, nil
+		case node.IsInt:
+			return goExpr{code: g.declare("value", fmt.Sprintf("reflect.ValueOf(int64(%d))", node.Int64))}, nil
+		case node.IsUint:
+			return goExpr{code: g.declare("value", fmt.Sprintf("reflect.ValueOf(uint64(%d))", node.Uint64))}, nil
+		}
+		return goExpr{}, unsupported(expr, "complex number")
+	case NodeAdditiveExpr, NodeMultiplicativeExpr, NodeComparativeExpr, NodeNumericComparativeExpr, NodeLogicalExpr:
+		var node *binaryExprNode
+		switch expr := expr.(type) {
+		case *AdditiveExprNode:
+			node = &expr.binaryExprNode
+		case *MultiplicativeExprNode:
+			node = &expr.binaryExprNode
+		case *ComparativeExprNode:
+			node = &expr.binaryExprNode
+		case *NumericComparativeExprNode:
+			node = &expr.binaryExprNode
+		case *LogicalExprNode:
+			node = &expr.binaryExprNode
+		}
+		right, err := g.typed(node.Right)
+		if err != nil {
+			return goExpr{}, err
+		}
+		if node.Left == nil {
+			return g.unary(node.Operator.kind, right), nil
+		}
+		left, err := g.typed(node.Left)
+		if err != nil {
+			return goExpr{}, err
+		}
+		return g.binary(node.Operator.kind, left, right), nil
+	case NodeNotExpr:
+		operand, err := g.typed(expr.(*NotExprNode).Expr)
+		if err != nil {
+			return goExpr{}, err
+		}
+		return goExpr{code: "!" + g.condition(operand), typ: typeBool, constant: operand.constant}, nil
+	case NodeTernaryExpr:
+		node := expr.(*TernaryExprNode)
+		cond, err := g.typed(node.Boolean)
+		if err != nil {
+			return goExpr{}, err
+		}
+		left, err := g.typed(node.Left)
+		if err != nil {
+			return goExpr{}, err
+		}
+		right, err := g.typed(node.Right)
+		if err != nil {
+			return goExpr{}, err
+		}
+		typ, name := left.typ, [...]string{"reflect.Value", "bool", "float64", "string"}[left.typ]
+		if left.typ != right.typ || (left.constant && right.constant) {
+			// constants are returned as the declared reflect.Values, which doesn't allocate
+			typ, name = typeValue, "reflect.Value"
+		}
+		if typ == typeValue {
+			g.reflect = true
+			left.code, right.code = g.value(left), g.value(right)
+		}
+		return goExpr{code: fmt.Sprintf("func() %s {\nif %s {\nreturn %s\n}\nreturn %s\n}()", name, g.condition(cond), left.code, right.code), typ: typ}, nil
+	}
+	code, err := g.valueExpression(expr)
+	return goExpr{code: code}, err
+}
+
+var comparisons = map[itemKind]string{
+	itemEquals:      "==",
+	itemNotEquals:   "!=",
+	itemGreat:       ">",
+	itemGreatEquals: ">=",
+	itemLess:        "<",
+	itemLessEquals:  "<=",
+}
+
+// runtimeOperators are the methods of Runtime evaluating the operators on reflect.Values.
+var runtimeOperators = map[itemKind]string{
+	itemAdd:         "Add",
+	itemMinus:       "Sub",
+	itemMul:         "Mul",
+	itemDiv:         "Div",
+	itemMod:         "Mod",
+	itemEquals:      "Equal",
+	itemNotEquals:   "Equal",
+	itemGreat:       "Greater",
+	itemGreatEquals: "GreaterEqual",
+	itemLess:        "Less",
+	itemLessEquals:  "LessEqual",
+	itemAnd:         "And",
+	itemOr:          "Or",
+}
+
+func (g *generator) unary(op itemKind, operand goExpr) goExpr {
+	switch {
+	case operand.typ == typeFloat && op == itemMinus:
+		return goExpr{code: "(-" + operand.code + ")", typ: typeFloat, constant: operand.constant}
+	case operand.typ == typeFloat:
+		return operand
+	case op == itemMinus:
+		return goExpr{code: fmt.Sprintf("rt.Neg(%s)", g.value(operand))}
+	}
+	return goExpr{code: fmt.Sprintf("rt.Unary(\"+\", %s)", g.value(operand))}
+}
+
+func (g *generator) binary(op itemKind, left, right goExpr) goExpr {
+	constant := left.constant && right.constant
+	switch op {
+	case itemAnd, itemOr:
+		// both operands are evaluated, so they're passed to a method instead of using Go's operators
+		return goExpr{code: fmt.Sprintf("rt.%s(%s, %s)", runtimeOperators[op], g.condition(left), g.condition(right)), typ: typeBool}
+	case itemEquals, itemNotEquals:
+		if left.typ == right.typ && left.typ != typeValue {
+			return goExpr{code: fmt.Sprintf("(%s %s %s)", left.code, comparisons[op], right.code), typ: typeBool, constant: constant}
+		}
+		code := fmt.Sprintf("rt.Equal(%s, %s)", g.value(left), g.value(right))
+		if op == itemNotEquals {
+			code = "!" + code
+		}
+		return goExpr{code: code, typ: typeBool}
+	case itemGreat, itemGreatEquals, itemLess, itemLessEquals:
+		if left.typ == typeFloat && right.typ == typeFloat {
+			return goExpr{code: fmt.Sprintf("(%s %s %s)", left.code, comparisons[op], right.code), typ: typeBool, constant: constant}
+		}
+		return goExpr{code: fmt.Sprintf("rt.%s(%s, %s)", runtimeOperators[op], g.value(left), g.value(right)), typ: typeBool}
+	}
+	if left.typ == typeFloat && right.typ == typeFloat {
+		switch op {
+		case itemAdd:
+			return goExpr{code: fmt.Sprintf("(%s + %s)", left.code, right.code), typ: typeFloat, constant: constant}
+		case itemMinus:
+			return goExpr{code: fmt.Sprintf("(%s - %s)", left.code, right.code), typ: typeFloat, constant: constant}
+		case itemMul:
+			return goExpr{code: fmt.Sprintf("(%s * %s)", left.code, right.code), typ: typeFloat, constant: constant}
+		case itemDiv:
+			// constant divisions by zero don't compile in Go
+			if !right.constant {
+				return goExpr{code: fmt.Sprintf("(%s / %s)", left.code, right.code), typ: typeFloat}
+			}
+		}
+	}
+	return goExpr{code: fmt.Sprintf("rt.%s(%s, %s)", runtimeOperators[op], g.value(left), g.value(right))}
+}
+
+// valueExpression returns Go code evaluating expr, which isn't a literal or an operator, to a reflect.Value.
+func (g *generator) valueExpression(expr Expression) (string, errors.Error) {
+	switch expr.Type() {
+	case NodeIdentifier:
+		return fmt.Sprintf("rt.Lookup(%s)", strconv.Quote(expr.(*IdentifierNode).Ident)), nil
+	case NodeField:
+		code := "rt.Context()"
+		for _, id := range expr.(*FieldNode).Idents {
+			code = fmt.Sprintf("rt.Field(%s, %s, %t)", code, strconv.Quote(id.name), id.lax)
+		}
+		return code, nil
+	case NodeChain:
+		node := expr.(*ChainNode)
+		base, ok := node.Node.(Expression)
+		if !ok || base.Type() == NodePipe {
+			return "", unsupported(expr, "pipeline in parentheses")
+		}
+		code, err := g.expression(base)
+		if err != nil {
+			return "", err
+		}
+		for i, id := range node.Idents {
+			code = fmt.Sprintf("rt.Member(%s, %s, %t, %t)", code, strconv.Quote(id.name), id.lax, i == len(node.Idents)-1)
+		}
+		return code, nil
+	case NodeCallExpr:
+		node := expr.(*CallExprNode)
+		if node.HasPipeSlot {
+			return "", unsupported(expr, "piped value slot")
+		}
+		if isIsset(node.BaseExpr) {
+			return "", unsupported(expr, "isset")
+		}
+		fn, err := g.expression(node.BaseExpr)
+		if err != nil {
+			return "", err
+		}
+		args, err := g.expressions(node.Exprs)
+		if err != nil {
+			return "", err
+		}
+		if args != "" {
+			args = ", " + args
+		}
+		return fmt.Sprintf("rt.Call(%s%s)", fn, args), nil
+	case NodeIndexExpr:
+		node := expr.(*IndexExprNode)
+		base, err := g.expression(node.Base)
+		if err != nil {
+			return "", err
+		}
+		index, err := g.expression(node.Index)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("rt.Index(%s, %s, %t)", base, index, node.Lax), nil
+	case NodeSliceExpr:
+		node := expr.(*SliceExprNode)
+		base, err := g.expression(node.Base)
+		if err != nil {
+			return "", err
+		}
+		index, end := "reflect.Value{}", "reflect.Value{}"
+		if node.Index != nil {
+			if index, err = g.expression(node.Index); err != nil {
+				return "", err
+			}
+		}
+		if node.EndIndex != nil {
+			if end, err = g.expression(node.EndIndex); err != nil {
+				return "", err
+			}
+		}
+		g.reflect = true
+		return fmt.Sprintf("rt.Slice(%s, %s, %s, %t, %t)", base, index, end, node.Index != nil, node.EndIndex != nil), nil
+	}
+	return "", unsupported(expr, expr.String())
+}
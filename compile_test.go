@@ -0,0 +1,90 @@
+package jet
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+var updateCompiled = flag.Bool("update-compiled", false, "regenerate compiled_gen_test.go")
+
+// TestCompiler generates the code for the templates in testData/compile and compares it to compiled_gen_test.go,
+// which is executed by the tests in compiled_test.go.
+func TestCompiler(t *testing.T) {
+	set := NewSet(NewOSFileSystemLoader("./testData/compile"))
+	c := NewCompiler("jet_test")
+	c.Var = "compiledTemplates"
+	for _, name := range []string{"/page.jet", "/partial.jet", "/list.jet"} {
+		tt, err := set.GetTemplate(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Add(tt); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	tt, err := set.GetTemplate("/block.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Add(tt)
+	if jetErr, ok := err.(errors.Error); !ok || jetErr.Reason() != errors.NotCompilableReason {
+		t.Errorf("expected an error with reason %s, got %v", errors.NotCompilableReason, err)
+	}
+	if c.Len() != 3 {
+		t.Errorf("expected 3 compiled templates, got %d", c.Len())
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if *updateCompiled {
+		if err := ioutil.WriteFile("compiled_gen_test.go", buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile("compiled_gen_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("generated code differs from compiled_gen_test.go, run go test -run TestCompiler -update-compiled")
+	}
+}
+
+func TestCompilerUnsupported(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l)
+	tests := []struct {
+		name, content string
+	}{
+		{"yield", `{{ block b() }}{{ end }}{{ yield b() }}`},
+		{"try", `{{ try }}{{ x }}{{ end }}`},
+		{"isset", `{{ isset(x) }}`},
+		{"pipeSlot", `{{ "a" | repeat(_, 2) }}`},
+		{"fieldAssignment", `{{ .x = 1 }}`},
+		{"trans", `{{ trans "key" }}`},
+	}
+	for _, test := range tests {
+		l.Set(test.name, test.content)
+		tt, err := set.GetTemplate(test.name)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		err = NewCompiler("views").Add(tt)
+		if jetErr, ok := err.(errors.Error); !ok || jetErr.Reason() != errors.NotCompilableReason {
+			t.Errorf("%s: expected an error with reason %s, got %v", test.name, errors.NotCompilableReason, err)
+		}
+	}
+
+	set = NewSet(l, WithContextualEscaping())
+	tt, _ := set.GetTemplate("try")
+	if err := NewCompiler("views").Add(tt); err == nil {
+		t.Error("expected an error for a Set using contextual escaping")
+	}
+}
@@ -0,0 +1,611 @@
+package jet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/CloudyKit/fastprinter"
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+// RenderFunc renders a template that was compiled to Go code ahead of time, see the jet compile command.
+//
+// Compiled code reports errors by panicking with an errors.Error; the methods of Runtime used by compiled
+// code (WriteRaw, Lookup, Pipeline, Range, ...) do so and are not meant to be called from other code.
+type RenderFunc func(rt *Runtime)
+
+// CompiledTemplate is a template compiled to Go code by jet compile.
+type CompiledTemplate struct {
+	Render RenderFunc
+	// Hash is the hex encoded SHA-256 hash of the template source the template was compiled from.
+	Hash string
+}
+
+// WithCompiledTemplates returns an option function registering templates compiled by jet compile.
+// The keys are template paths including the extension, like "/index.jet". Compiled templates are preferred
+// over the loader, except in development mode, and can be included, extended and imported like loaded ones.
+//
+// When the loader has a template at the path of a compiled template, the Set compares the hash of its source
+// to the hash recorded when compiling and loads the template instead of using the outdated compiled code
+// if they differ.
+func WithCompiledTemplates(templates map[string]CompiledTemplate) Option {
+	return func(s *Set) {
+		if s.compiled == nil {
+			s.compiled = make(map[string]CompiledTemplate, len(templates))
+		}
+		for path, t := range templates {
+			s.compiled[path] = t
+		}
+	}
+}
+
+// sourceHash returns the hash of a template source recorded in compiled templates.
+func sourceHash(source []byte) string {
+	sum := sha256.Sum256(source)
+	return hex.EncodeToString(sum[:])
+}
+
+// compiledUpToDate reports whether the template at canonicalPath was compiled from the source the loader has,
+// if it has one.
+func (s *Set) compiledUpToDate(canonicalPath, hash string) bool {
+	if hash == "" || !s.loader.Exists(canonicalPath) {
+		return true
+	}
+	f, err := s.loader.Open(canonicalPath)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	source, err := ioutil.ReadAll(f)
+	return err != nil || sourceHash(source) == hash
+}
+
+func (s *Set) getTemplateFromCompiled(templatePath string) (*Template, bool) {
+	if s.developmentMode || s.sandbox != nil {
+		return nil, false
+	}
+	for _, extension := range s.extensions {
+		canonicalPath := templatePath + extension
+		if c, ok := s.compiled[canonicalPath]; ok {
+			if !s.compiledUpToDate(canonicalPath, c.Hash) {
+				return nil, false
+			}
+			return &Template{
+				Name:            canonicalPath,
+				ParseName:       canonicalPath,
+				set:             s,
+				processedBlocks: map[string]*BlockNode{},
+				Root:            &ListNode{NodeBase: NodeBase{TemplatePath: canonicalPath, NodeType: NodeList}},
+				compiled:        c.Render,
+			}, true
+		}
+	}
+	return nil, false
+}
+
+// executeTemplate executes t, or the template at the root of its extends chain.
+func (rt *Runtime) executeTemplate(t *Template) (reflect.Value, errors.Error) {
+	for t.extends != nil {
+		t = t.extends
+	}
+	if t.compiled == nil {
+		return rt.executeList(t.Root)
+	}
+	return reflect.Value{}, rt.executeCompiled(t)
+}
+
+func (rt *Runtime) executeCompiled(t *Template) (err errors.Error) {
+	at, sc, context, trace, frames := rt.at, rt.scope, rt.context, rt.trace, len(rt.frames)
+	nodes, args := len(rt.callNodes), len(rt.callArgs)
+	defer func() {
+		rt.at = at
+		rt.mapOutput(&rt.at)
+		if recovered := recover(); recovered != nil {
+			var ok bool
+			if err, ok = recovered.(errors.Error); !ok {
+				panic(recovered)
+			}
+			rt.unwindTrace(trace, recovered)
+			rt.unwindFrames(frames, recovered)
+			rt.scope, rt.context = sc, context
+			rt.callNodes, rt.callArgs = rt.callNodes[:nodes], rt.callArgs[:args]
+		}
+	}()
+	rt.at = NodeBase{TemplatePath: t.Name, Line: 1}
+	rt.mapOutput(&rt.at)
+	t.compiled(rt)
+	return nil
+}
+
+// valueNode is an expression holding an already evaluated value. Compiled templates use it to pass arguments
+// to functions, which receive expressions, and to evaluate slices, pipelines of several commands and includes
+// and to report the errors of operators with the same code the interpreter uses.
+type valueNode struct {
+	NodeBase
+	value reflect.Value
+}
+
+func (v *valueNode) String() string {
+	if !v.value.IsValid() {
+		return "nil"
+	}
+	return fmt.Sprint(v.value)
+}
+
+func (rt *Runtime) node(typ NodeType) NodeBase {
+	n := rt.at
+	n.NodeType = typ
+	return n
+}
+
+func (rt *Runtime) value(v reflect.Value) *valueNode {
+	return &valueNode{NodeBase: rt.node(nodeValue), value: v}
+}
+
+func (rt *Runtime) values(vs []reflect.Value) []Expression {
+	exprs := make([]Expression, len(vs))
+	nodes := make([]valueNode, len(vs))
+	for i, v := range vs {
+		nodes[i] = valueNode{NodeBase: rt.node(nodeValue), value: v}
+		exprs[i] = &nodes[i]
+	}
+	return exprs
+}
+
+func (rt *Runtime) must(v reflect.Value, err errors.Error) reflect.Value {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// At records the position in the template source of the statement a compiled template executes next.
+// Errors are reported at this position.
+func (rt *Runtime) At(line, col int) {
+	rt.at.Line = line
+	rt.at.Item.col = col
+	rt.mapOutput(&rt.at)
+	if err := rt.step(&rt.at); err != nil {
+		panic(err)
+	}
+}
+
+// WriteRaw writes text of a compiled template to the output, unescaped.
+func (rt *Runtime) WriteRaw(text []byte) {
+	if _, err := rt.Writer.Write(text); err != nil {
+		panic(rt.at.error("", err.Error()))
+	}
+}
+
+// Flush flushes the output of a compiled template, see Flusher.
+func (rt *Runtime) Flush() {
+	if err := flushWriter(rt.Writer); err != nil {
+		panic(rt.at.error("", fmt.Sprintf("flush: %v", err)))
+	}
+}
+
+// Lookup resolves the variable name in the scope, the globals and the default variables.
+func (rt *Runtime) Lookup(name string) reflect.Value {
+	v, err := rt.resolve(name)
+	if err != nil {
+		panic(rt.at.error(err.Reason(), err.Message()))
+	}
+	return v
+}
+
+// Field returns the field, method or map value name of base, just like the .name expression on the context.
+func (rt *Runtime) Field(base reflect.Value, name string, lax bool) reflect.Value {
+	field, err := rt.resolveIndex(base, reflect.Value{}, name, lax)
+	if err != nil {
+		panic(rt.at.error(err.Reason(), err.Message()))
+	}
+	if !field.IsValid() {
+		panic(rt.at.error(errors.NotFoundFieldOrMethodReason, fmt.Sprintf("there is no field or method '%s' in %s", name, getTypeString(base))))
+	}
+	return field
+}
+
+// Member returns the field, method or map value name of base, just like the x.name expression.
+// last reports if name is the last identifier of the chain.
+func (rt *Runtime) Member(base reflect.Value, name string, lax, last bool) reflect.Value {
+	field, err := rt.resolveIndex(base, reflect.ValueOf(name), name, lax)
+	if err != nil {
+		panic(rt.at.error(err.Reason(), err.Message()))
+	}
+	if !field.IsValid() {
+		if base.Kind() == reflect.Map && last {
+			return reflect.Value{}
+		}
+		if !lax {
+			panic(rt.at.error(errors.NotFoundFieldOrMethodReason, fmt.Sprintf("there is no field or method '%s' in %s", name, getTypeString(base))))
+		}
+		field = reflect.ValueOf(nil)
+	}
+	return field
+}
+
+// Index returns base[index].
+func (rt *Runtime) Index(base, index reflect.Value, lax bool) reflect.Value {
+	resolved, err := rt.resolveIndex(base, index, "", lax)
+	if err != nil {
+		panic(rt.at.error(err.Reason(), err.Message()))
+	}
+	return resolved
+}
+
+// Slice returns base[index:end]; hasIndex and hasEnd report which bounds were given.
+func (rt *Runtime) Slice(base, index, end reflect.Value, hasIndex, hasEnd bool) reflect.Value {
+	node := &SliceExprNode{NodeBase: rt.node(NodeSliceExpr), Base: rt.value(base)}
+	if hasIndex {
+		node.Index = rt.value(index)
+	}
+	if hasEnd {
+		node.EndIndex = rt.value(end)
+	}
+	return rt.must(rt.evalPrimaryExpressionGroup(node))
+}
+
+// Unary evaluates the unary operator op ("+", "-" or "!") on v. Compiled code uses Neg and Truth instead.
+func (rt *Runtime) Unary(op string, v reflect.Value) reflect.Value {
+	if op == "!" {
+		return reflect.ValueOf(!isTrue(v))
+	}
+	if result, ok := signNumber(op == "+", v); ok && (op == "+" || op == "-") {
+		return result
+	}
+	node := &AdditiveExprNode{binaryExprNode{NodeBase: rt.node(NodeAdditiveExpr), Operator: item{kind: operatorKinds[op], val: op}, Right: rt.value(v)}}
+	return rt.must(rt.evalAdditiveExpression(node))
+}
+
+var operatorKinds = map[string]itemKind{
+	"+":  itemAdd,
+	"-":  itemMinus,
+	"*":  itemMul,
+	"/":  itemDiv,
+	"%":  itemMod,
+	"==": itemEquals,
+	"!=": itemNotEquals,
+	">":  itemGreat,
+	">=": itemGreatEquals,
+	"<":  itemLess,
+	"<=": itemLessEquals,
+	"&&": itemAnd,
+	"||": itemOr,
+}
+
+// Binary evaluates the binary operator op, like "+" or "&&", on left and right. Compiled code uses the methods
+// of the operators instead, like Add or Less, which call Binary for operands the operator isn't defined for.
+func (rt *Runtime) Binary(op string, left, right reflect.Value) reflect.Value {
+	kind, ok := operatorKinds[op]
+	if !ok {
+		panic(rt.at.error(errors.UnexpectedNodeReason, fmt.Sprintf("unknown operator %q", op)))
+	}
+	expr := binaryExprNode{Operator: item{kind: kind, val: op}, Left: rt.value(left), Right: rt.value(right)}
+	switch kind {
+	case itemAdd, itemMinus:
+		expr.NodeBase = rt.node(NodeAdditiveExpr)
+		return rt.must(rt.evalAdditiveExpression(&AdditiveExprNode{expr}))
+	case itemMul, itemDiv, itemMod:
+		expr.NodeBase = rt.node(NodeMultiplicativeExpr)
+		return rt.must(rt.evalMultiplicativeExpression(&MultiplicativeExprNode{expr}))
+	case itemEquals, itemNotEquals:
+		expr.NodeBase = rt.node(NodeComparativeExpr)
+		return rt.must(rt.evalComparativeExpression(&ComparativeExprNode{expr}))
+	case itemAnd, itemOr:
+		expr.NodeBase = rt.node(NodeLogicalExpr)
+		return rt.must(rt.evalLogicalExpression(&LogicalExprNode{expr}))
+	}
+	expr.NodeBase = rt.node(NodeNumericComparativeExpr)
+	return rt.must(rt.evalNumericComparativeExpression(&NumericComparativeExprNode{expr}))
+}
+
+// Truth reports whether v is true in a condition.
+func (rt *Runtime) Truth(v reflect.Value) bool {
+	return isTrue(v)
+}
+
+// Add returns left + right.
+func (rt *Runtime) Add(left, right reflect.Value) reflect.Value {
+	if left.IsValid() && right.IsValid() {
+		if result, ok := addNumbers(true, left, right); ok {
+			return result
+		}
+		if left.Kind() == reflect.String {
+			result := concat(left, right)
+			if err := rt.allocate(result, &rt.at); err != nil {
+				panic(err)
+			}
+			return result
+		}
+	}
+	return rt.Binary("+", left, right)
+}
+
+// Sub returns left - right.
+func (rt *Runtime) Sub(left, right reflect.Value) reflect.Value {
+	if left.IsValid() && right.IsValid() {
+		if result, ok := addNumbers(false, left, right); ok {
+			return result
+		}
+	}
+	return rt.Binary("-", left, right)
+}
+
+// Neg returns -v.
+func (rt *Runtime) Neg(v reflect.Value) reflect.Value {
+	if result, ok := signNumber(false, v); ok {
+		return result
+	}
+	return rt.Unary("-", v)
+}
+
+// Mul returns left * right.
+func (rt *Runtime) Mul(left, right reflect.Value) reflect.Value {
+	if result, ok := multiplyNumbers(itemMul, left, right); ok {
+		return result
+	}
+	return rt.Binary("*", left, right)
+}
+
+// Div returns left / right.
+func (rt *Runtime) Div(left, right reflect.Value) reflect.Value {
+	if result, ok := multiplyNumbers(itemDiv, left, right); ok {
+		return result
+	}
+	return rt.Binary("/", left, right)
+}
+
+// Mod returns left % right.
+func (rt *Runtime) Mod(left, right reflect.Value) reflect.Value {
+	if result, ok := multiplyNumbers(itemMod, left, right); ok {
+		return result
+	}
+	return rt.Binary("%", left, right)
+}
+
+// Equal reports whether left == right.
+func (rt *Runtime) Equal(left, right reflect.Value) bool {
+	return checkEquality(left, right)
+}
+
+// Greater reports whether left > right.
+func (rt *Runtime) Greater(left, right reflect.Value) bool {
+	return rt.compare(itemGreat, ">", left, right)
+}
+
+// GreaterEqual reports whether left >= right.
+func (rt *Runtime) GreaterEqual(left, right reflect.Value) bool {
+	return rt.compare(itemGreatEquals, ">=", left, right)
+}
+
+// Less reports whether left < right.
+func (rt *Runtime) Less(left, right reflect.Value) bool {
+	return rt.compare(itemLess, "<", left, right)
+}
+
+// LessEqual reports whether left <= right.
+func (rt *Runtime) LessEqual(left, right reflect.Value) bool {
+	return rt.compare(itemLessEquals, "<=", left, right)
+}
+
+func (rt *Runtime) compare(kind itemKind, op string, left, right reflect.Value) bool {
+	if result, ok := compareNumbers(kind, left, right); ok {
+		return result
+	}
+	return rt.Binary(op, left, right).Bool()
+}
+
+// And returns a && b. Unlike Go's && operator, but just like the interpreter, it's called with both operands
+// evaluated.
+func (rt *Runtime) And(a, b bool) bool {
+	return a && b
+}
+
+// Or returns a || b, with both operands evaluated.
+func (rt *Runtime) Or(a, b bool) bool {
+	return a || b
+}
+
+// Call calls fn with args, which can be a Func or any other Go function.
+func (rt *Runtime) Call(fn reflect.Value, args ...reflect.Value) reflect.Value {
+	if fn.Kind() != reflect.Func {
+		panic(rt.at.error("invalid.node", fmt.Sprintf("%s is not func kind %q", getTypeString(fn), fn.Kind())))
+	}
+	// the nodes are pushed on stacks reused for all calls; functions calling other templates push theirs above
+	nodes, exprs := len(rt.callNodes), len(rt.callArgs)
+	rt.callNodes = append(rt.callNodes, valueNode{NodeBase: rt.node(nodeValue), value: fn})
+	for _, v := range args {
+		rt.callNodes = append(rt.callNodes, valueNode{NodeBase: rt.node(nodeValue), value: v})
+	}
+	called := rt.callNodes[nodes:]
+	for i := range args {
+		rt.callArgs = append(rt.callArgs, &called[i+1])
+	}
+	ret, err := rt.evalCallExpression(&called[0], fn, CallArgs{Exprs: rt.callArgs[exprs:len(rt.callArgs):len(rt.callArgs)]})
+	for i := range called {
+		called[i] = valueNode{}
+	}
+	for i := exprs; i < len(rt.callArgs); i++ {
+		rt.callArgs[i] = nil
+	}
+	rt.callNodes, rt.callArgs = rt.callNodes[:nodes], rt.callArgs[:exprs]
+	if err != nil {
+		panic(positionError(&rt.at, err))
+	}
+	return ret
+}
+
+// Command is a command of a pipeline in a compiled template.
+type Command struct {
+	Term reflect.Value
+	Args []reflect.Value
+	// Call is true for commands with arguments, like {{ f: a, b }}.
+	Call bool
+}
+
+// Pipeline evaluates the commands of a pipeline and prints the result, just like {{ a | b | c }}.
+func (rt *Runtime) Pipeline(cmds ...Command) {
+	pipe := &PipeNode{NodeBase: rt.node(NodePipe), Cmds: make([]*CommandNode, len(cmds))}
+	for i, cmd := range cmds {
+		node := &CommandNode{NodeBase: rt.node(NodeCommand)}
+		node.CallExprNode = CallExprNode{NodeBase: node.NodeBase, BaseExpr: rt.value(cmd.Term)}
+		if cmd.Call {
+			node.Exprs = rt.values(cmd.Args)
+		}
+		pipe.Cmds[i] = node
+	}
+	v, safeWriter, err := rt.evalPipelineExpression(pipe)
+	if err != nil {
+		panic(err)
+	}
+	if safeWriter || !v.IsValid() {
+		return
+	}
+	if v.Type().Implements(rendererType) {
+		v.Interface().(Renderer).Render(rt)
+		return
+	}
+	if _, err := fastprinter.PrintValue(rt.escapeeWriter, v); err != nil {
+		panic(rt.at.error("", err.Error()))
+	}
+}
+
+// Print prints v, just like {{ v }}.
+func (rt *Runtime) Print(v reflect.Value) {
+	if !v.IsValid() {
+		return
+	}
+	if v.Type().Implements(rendererType) {
+		v.Interface().(Renderer).Render(rt)
+		return
+	}
+	if err := rt.escapeeWriter.printValue(v); err != nil {
+		panic(rt.at.error("", err.Error()))
+	}
+}
+
+// EnterScope opens a new variable scope; LeaveScope closes it.
+func (rt *Runtime) EnterScope() {
+	rt.newScope()
+}
+
+// LeaveScope closes the variable scope opened by the last EnterScope.
+func (rt *Runtime) LeaveScope() {
+	rt.releaseScope()
+}
+
+// LetValue declares the variable name in the current scope, just like {{ name := v }}.
+func (rt *Runtime) LetValue(name string, v reflect.Value) {
+	rt.variables[name] = v
+}
+
+// Assign assigns v to the existing variable name, just like {{ name = v }}.
+func (rt *Runtime) Assign(name string, v reflect.Value) {
+	if err := rt.setValue(name, v); err != nil {
+		panic(rt.at.error(err.Reason(), err.Message()))
+	}
+}
+
+// Range ranges over v, setting the context to each value, and calls body for every iteration.
+// body returns false to stop the loop, like {{ break }} does. Range reports whether there were any iterations,
+// so the caller can execute an else branch otherwise.
+func (rt *Runtime) Range(v reflect.Value, body func() bool) bool {
+	return rt.rangeValue(v, body, false, false, nil)
+}
+
+// RangeLet is like Range, but declares vars in a new scope, like {{ range i, v := x }}.
+func (rt *Runtime) RangeLet(v reflect.Value, body func() bool, vars ...string) bool {
+	return rt.rangeValue(v, body, true, true, vars)
+}
+
+// RangeSet is like Range, but assigns to the existing variables vars, like {{ range i, v = x }}.
+func (rt *Runtime) RangeSet(v reflect.Value, body func() bool, vars ...string) bool {
+	return rt.rangeValue(v, body, true, false, vars)
+}
+
+func (rt *Runtime) rangeValue(v reflect.Value, body func() bool, isSet, isLet bool, vars []string) bool {
+	node := &RangeNode{BranchNode{NodeBase: rt.node(NodeRange)}}
+	ranger, cleanup, err := getRanger(v)
+	if err != nil {
+		panic(node.error("", err.Error()))
+	}
+	defer cleanup()
+	if r, ok := ranger.(*chanRanger); ok {
+		r.done = rt.done
+	}
+
+	keyVarSlot, valVarSlot := 0, -1
+	if len(vars) > 1 {
+		valVarSlot = 1
+	}
+	if !ranger.ProvidesIndex() {
+		if len(vars) > 1 {
+			panic(node.error("", "two-var range over ranger that does not provide an index"))
+		} else if isSet {
+			keyVarSlot, valVarSlot = -1, 0
+		}
+	}
+
+	context := rt.context
+	defer func() { rt.context = context }()
+	if isLet {
+		rt.newScope()
+		defer rt.releaseScope()
+	}
+	// restoring the scope after each iteration releases the scopes of the body left by a break or continue
+	iterationScope := rt.scope
+
+	ev := rt.traceEnter(TraceRange, node, "")
+	indexValue, rangeValue, end := ranger.Range()
+	ranged := !end
+	for !end {
+		rt.at = node.NodeBase
+		if err := rt.iterate(node); err != nil {
+			panic(err)
+		}
+		if isSet {
+			if keyVarSlot >= 0 {
+				rt.setRangeVar(vars[keyVarSlot], indexValue, isLet)
+			}
+			if valVarSlot >= 0 {
+				rt.setRangeVar(vars[valVarSlot], rangeValue, isLet)
+			}
+		}
+		if valVarSlot < 0 {
+			rt.context = rangeValue
+		}
+		cont := body()
+		rt.scope = iterationScope
+		if !cont {
+			break
+		}
+		indexValue, rangeValue, end = ranger.Range()
+	}
+	rt.at = node.NodeBase
+	if err := rt.interrupted(node); err != nil {
+		panic(err)
+	}
+	rt.traceExit(ev, nil)
+	return ranged
+}
+
+func (rt *Runtime) setRangeVar(name string, v reflect.Value, isLet bool) {
+	if isLet {
+		rt.variables[name] = v
+	} else {
+		rt.Assign(name, v)
+	}
+}
+
+// Include executes the template name, just like {{ include name }}, or {{ include name context }}
+// when a context is passed.
+func (rt *Runtime) Include(name reflect.Value, context ...reflect.Value) {
+	node := &IncludeNode{NodeBase: rt.node(NodeInclude), Name: rt.value(name)}
+	if len(context) > 0 {
+		node.Context = rt.value(context[0])
+	}
+	rt.must(rt.executeInclude(node))
+}
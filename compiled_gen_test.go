@@ -0,0 +1,230 @@
+// Code generated by jet compile. DO NOT EDIT.
+
+package jet_test
+
+import (
+	"reflect"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// compiledTemplates holds the compiled templates, pass it to jet.WithCompiledTemplates.
+var compiledTemplates = map[string]jet.CompiledTemplate{
+	"/list.jet":    {Render: render2, Hash: "00ef89ea7cbf92afb45e6f88d7e5056443730335ab33e93c6e89bcb319b656b7"},
+	"/page.jet":    {Render: render0, Hash: "4d34ad056917626d9c422e0b569a9f7e5bc073cfd082e5e39aad1f7a8bdcffe0"},
+	"/partial.jet": {Render: render1, Hash: "3ce66a42cf98382133f2ab27c79a1e39a8dfa5ef51b93152e518fb0dcf60d4d3"},
+}
+
+var (
+	value2_0  = reflect.ValueOf("skip")
+	value2_1  = reflect.ValueOf(float64(2))
+	value2_2  = reflect.ValueOf(float64(0))
+	text2_3   = []byte("<li class=\"")
+	value2_4  = reflect.ValueOf("late")
+	value2_5  = reflect.ValueOf("early")
+	text2_6   = []byte("\">")
+	value2_7  = reflect.ValueOf(float64(1))
+	text2_8   = []byte(": ")
+	text2_9   = []byte(" ")
+	text2_10  = []byte(" long")
+	text2_11  = []byte("</li>\n")
+	value2_12 = reflect.ValueOf(((float64(1.5) * float64(4)) - float64(1)))
+	value2_13 = reflect.ValueOf("a")
+	value2_14 = reflect.ValueOf("b")
+	value2_15 = reflect.ValueOf("ab")
+	text2_16  = []byte("\n")
+	text0_0   = []byte("<h1>")
+	text0_1   = []byte("</h1>")
+	text0_2   = []byte("\n")
+	value0_3  = reflect.ValueOf(float64(3))
+	value0_4  = reflect.ValueOf(float64(2))
+	value0_5  = reflect.ValueOf(float64(1))
+	text0_6   = []byte("<p>")
+	text0_7   = []byte(" ")
+	value0_8  = reflect.ValueOf("many")
+	value0_9  = reflect.ValueOf("few")
+	text0_10  = []byte("</p>\n")
+	value0_11 = reflect.ValueOf(float64(0))
+	text0_12  = []byte("<ul>\n")
+	value0_13 = reflect.ValueOf("skip")
+	value0_14 = reflect.ValueOf("stop")
+	text0_15  = []byte("<li>")
+	text0_16  = []byte(": ")
+	text0_17  = []byte("</li>\n")
+	text0_18  = []byte("</ul>")
+	text0_19  = []byte("<p>hidden</p>")
+	text0_20  = []byte("never")
+	text0_21  = []byte("<p>empty</p>")
+	text0_22  = []byte(",")
+	value0_23 = reflect.ValueOf("Name")
+	value0_24 = reflect.ValueOf("ab")
+	value0_25 = reflect.ValueOf("<b>raw</b>")
+	value0_26 = reflect.ValueOf("<i>")
+	value0_27 = reflect.ValueOf("./partial.jet")
+	text1_0   = []byte("<footer>")
+	value1_1  = reflect.ValueOf(float64(1))
+	text1_2   = []byte(" ")
+	text1_3   = []byte("</footer>\n")
+)
+
+// /list.jet
+func render2(rt *jet.Runtime) {
+	rt.At(1, 17)
+	rt.RangeLet(rt.Lookup("items"), func() bool {
+		rt.At(1, 8)
+		if rt.And(rt.Equal(rt.Mod(rt.Lookup("i"), value2_1), value2_2), !rt.Equal(rt.Lookup("item"), value2_0)) {
+			rt.WriteRaw(text2_3)
+			rt.At(1, 80)
+			rt.Print(func() reflect.Value {
+				if rt.Greater(rt.Lookup("i"), value2_1) {
+					return value2_4
+				}
+				return value2_5
+			}())
+			rt.WriteRaw(text2_6)
+			rt.At(1, 112)
+			rt.Print(rt.Add(rt.Mul(rt.Lookup("i"), value2_1), value2_7))
+			rt.WriteRaw(text2_8)
+			rt.At(1, 129)
+			rt.Print(rt.Lookup("item"))
+			rt.WriteRaw(text2_9)
+			rt.At(1, 140)
+			rt.Print(rt.Member(rt.Lookup("user"), "Name", false, true))
+			rt.At(1, 197)
+			if rt.Or(rt.GreaterEqual(rt.Call(rt.Lookup("len"), rt.Lookup("item")), value2_1), rt.Equal(rt.Lookup("i"), value2_2)) {
+				rt.WriteRaw(text2_10)
+			}
+			rt.WriteRaw(text2_11)
+		}
+		return true
+	}, "i", "item")
+	rt.At(2, 22)
+	rt.EnterScope()
+	rt.LetValue("total", value2_12)
+	rt.At(2, 48)
+	rt.Print(rt.Lookup("total"))
+	rt.WriteRaw(text2_9)
+	rt.At(2, 60)
+	rt.Print(reflect.ValueOf(rt.Equal(rt.Add(value2_13, value2_14), value2_15)))
+	rt.WriteRaw(text2_9)
+	rt.At(2, 84)
+	rt.Print(reflect.ValueOf(!rt.Truth(rt.Lookup("show"))))
+	rt.WriteRaw(text2_16)
+	rt.LeaveScope()
+}
+
+// /page.jet
+func render0(rt *jet.Runtime) {
+	rt.WriteRaw(text0_0)
+	rt.At(1, 8)
+	rt.Pipeline(jet.Command{Term: rt.Lookup("title")}, jet.Command{Term: rt.Lookup("upper")})
+	rt.WriteRaw(text0_1)
+	rt.At(1, 38)
+	rt.Flush()
+	rt.WriteRaw(text0_2)
+	rt.At(2, 4)
+	rt.EnterScope()
+	rt.LetValue("n", value0_3)
+	rt.At(2, 16)
+	rt.LetValue("total", rt.Add(rt.Mul(rt.Lookup("n"), value0_4), value0_5))
+	rt.WriteRaw(text0_6)
+	rt.At(2, 43)
+	rt.Print(rt.Lookup("total"))
+	rt.WriteRaw(text0_7)
+	rt.At(2, 55)
+	rt.Print(func() reflect.Value {
+		if rt.Greater(rt.Lookup("n"), value0_4) {
+			return value0_8
+		}
+		return value0_9
+	}())
+	rt.WriteRaw(text0_7)
+	rt.At(2, 84)
+	rt.Print(reflect.ValueOf(!rt.Truth(rt.Lookup("show"))))
+	rt.WriteRaw(text0_7)
+	rt.At(2, 96)
+	rt.Print(rt.Neg(rt.Lookup("n")))
+	rt.WriteRaw(text0_10)
+	rt.At(3, 45)
+	if rt.And(rt.Truth(rt.Lookup("show")), rt.Greater(rt.Call(rt.Lookup("len"), rt.Lookup("items")), value0_11)) {
+		rt.WriteRaw(text0_12)
+		rt.At(4, 8)
+		rt.RangeLet(rt.Lookup("items"), func() bool {
+			rt.At(4, 73)
+			if rt.Equal(rt.Lookup("item"), value0_13) {
+				return true
+			}
+			rt.At(4, 116)
+			if rt.Equal(rt.Lookup("item"), value0_14) {
+				return false
+			}
+			rt.WriteRaw(text0_15)
+			rt.At(4, 125)
+			rt.Print(rt.Lookup("i"))
+			rt.WriteRaw(text0_16)
+			rt.At(4, 134)
+			rt.Print(rt.Lookup("item"))
+			rt.WriteRaw(text0_17)
+			return true
+		}, "i", "item")
+		rt.WriteRaw(text0_18)
+	} else {
+		rt.WriteRaw(text0_19)
+	}
+	rt.WriteRaw(text0_2)
+	rt.At(6, 52)
+	if !rt.Range(rt.Lookup("empty"), func() bool {
+		rt.WriteRaw(text0_20)
+		return true
+	}) {
+		rt.WriteRaw(text0_21)
+	}
+	rt.WriteRaw(text0_2)
+	rt.At(7, 41)
+	rt.Range(rt.Slice(rt.Member(rt.Lookup("user"), "Tags", false, true), value0_5, reflect.Value{}, true, false), func() bool {
+		rt.At(7, 29)
+		rt.Print(rt.Lookup("."))
+		rt.WriteRaw(text0_22)
+		return true
+	})
+	rt.WriteRaw(text0_2)
+	rt.At(8, 4)
+	rt.Print(rt.Member(rt.Lookup("user"), "Name", false, true))
+	rt.WriteRaw(text0_7)
+	rt.At(8, 20)
+	rt.Print(rt.Index(rt.Lookup("user"), value0_23, false))
+	rt.WriteRaw(text0_7)
+	rt.At(8, 39)
+	rt.Print(rt.Member(rt.Lookup("user"), "Missing", true, true))
+	rt.WriteRaw(text0_7)
+	rt.At(8, 59)
+	rt.Pipeline(jet.Command{Term: rt.Lookup("repeat"), Args: []reflect.Value{value0_24, value0_4}, Call: true})
+	rt.WriteRaw(text0_2)
+	rt.At(9, 4)
+	rt.Pipeline(jet.Command{Term: rt.Lookup("raw"), Args: []reflect.Value{value0_25}, Call: true})
+	rt.WriteRaw(text0_7)
+	rt.At(9, 28)
+	rt.Pipeline(jet.Command{Term: value0_26}, jet.Command{Term: rt.Lookup("raw")})
+	rt.WriteRaw(text0_2)
+	rt.At(10, 33)
+	rt.Include(value0_27, rt.Lookup("user"))
+	rt.WriteRaw(text0_2)
+	rt.LeaveScope()
+}
+
+// /partial.jet
+func render1(rt *jet.Runtime) {
+	rt.WriteRaw(text1_0)
+	rt.At(1, 12)
+	rt.Print(rt.Field(rt.Context(), "Name", false))
+	rt.At(1, 23)
+	rt.EnterScope()
+	rt.LetValue("x", value1_1)
+	rt.At(1, 35)
+	rt.Assign("x", rt.Add(rt.Lookup("x"), value1_1))
+	rt.WriteRaw(text1_2)
+	rt.At(1, 51)
+	rt.Print(rt.Lookup("x"))
+	rt.WriteRaw(text1_3)
+	rt.LeaveScope()
+}
@@ -0,0 +1,173 @@
+package jet_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+func compiledTestVars(items ...string) jet.VarMap {
+	return jet.VarMap{}.
+		Set("title", "Compiled").
+		Set("show", len(items) > 0).
+		Set("items", items).
+		Set("empty", []string{}).
+		Set("user", map[string]interface{}{"Name": "<Mario>", "Tags": []string{"a", "b", "c"}})
+}
+
+// TestCompiledTemplates executes the templates compiled into compiled_gen_test.go and compares
+// their output to the output of the interpreter.
+func TestCompiledTemplates(t *testing.T) {
+	interpreted := jet.NewSet(jet.NewOSFileSystemLoader("./testData/compile"))
+	compiled := jet.NewSet(jet.NewInMemLoader(), jet.WithCompiledTemplates(compiledTemplates))
+
+	for _, vars := range []jet.VarMap{
+		compiledTestVars("a", "skip", "b", "stop", "c"),
+		compiledTestVars(),
+	} {
+		for _, name := range []string{"/page.jet", "/list.jet"} {
+			var expected, got bytes.Buffer
+			tt, err := interpreted.GetTemplate(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.Execute(&expected, vars, nil); err != nil {
+				t.Fatal(err)
+			}
+			tt, err = compiled.GetTemplate(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.Execute(&got, vars, nil); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != expected.String() {
+				t.Errorf("%s: compiled output differs\nexpected: %q\ngot:      %q", name, expected.String(), got.String())
+			}
+		}
+	}
+}
+
+func TestCompiledTemplatesMixed(t *testing.T) {
+	l := jet.NewInMemLoader()
+	set := jet.NewSet(l, jet.WithCompiledTemplates(compiledTemplates))
+	l.Set("/layout.jet", `{{ include "/partial.jet" user }}|{{ exec("/partial.jet", user) }}`)
+
+	tt, err := set.GetTemplate("/layout.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, compiledTestVars(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<footer>&lt;Mario&gt; 2</footer>\n|"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestCompiledTemplatesOutdated(t *testing.T) {
+	source, err := ioutil.ReadFile("./testData/compile/partial.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := jet.NewInMemLoader()
+	set := jet.NewSet(l, jet.WithCompiledTemplates(compiledTemplates))
+	l.Set("/partial.jet", string(source))
+	tt, err := set.GetTemplate("/partial.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tt.Root.Nodes) != 0 {
+		t.Errorf("expected the compiled template for the unchanged source")
+	}
+
+	set = jet.NewSet(l, jet.WithCompiledTemplates(compiledTemplates))
+	l.Set("/partial.jet", "<p>{{ .Name }}</p>")
+	tt, err = set.GetTemplate("/partial.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, nil, map[string]string{"Name": "changed"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<p>changed</p>"; buf.String() != expected {
+		t.Errorf("expected the changed source to be loaded, rendering %q, got %q", expected, buf.String())
+	}
+}
+
+func TestCompiledTemplatesErrors(t *testing.T) {
+	set := jet.NewSet(jet.NewInMemLoader(), jet.WithCompiledTemplates(compiledTemplates), jet.WithLimits(jet.Limits{MaxIterations: 2}))
+	tt, err := set.GetTemplate("/page.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tt.Execute(&buf, compiledTestVars("a", "b", "c"), nil)
+	if jetErr, ok := err.(errors.Error); !ok || jetErr.Reason() != errors.IterationLimitReason || jetErr.Position().L != 4 {
+		t.Errorf("expected an iteration limit error at line 4, got %v", err)
+	}
+
+	err = tt.Execute(&buf, jet.VarMap{}, nil)
+	if jetErr, ok := err.(errors.Error); !ok || !strings.Contains(jetErr.Error(), "/page.jet:1:") {
+		t.Errorf("expected an error at /page.jet:1, got %v", err)
+	}
+}
+
+func TestCompiledSourceMap(t *testing.T) {
+	set := jet.NewSet(jet.NewInMemLoader(), jet.WithCompiledTemplates(compiledTemplates))
+	tt, err := set.GetTemplate("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	m := &jet.SourceMap{}
+	err = tt.ExecuteWith(context.Background(), &buf, compiledTestVars("a", "b"), nil, jet.ExecSourceMap(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the whole output is mapped to lines of the compiled templates
+	end := 0
+	for _, s := range m.Segments {
+		if s.Start != end || s.TemplatePath == "" || s.Line == 0 {
+			t.Fatalf("unexpected segment %+v after %d", s, end)
+		}
+		end = s.End
+	}
+	if end != buf.Len() {
+		t.Errorf("expected the source map to cover all %d bytes of the output, got %d", buf.Len(), end)
+	}
+}
+
+func benchmarkList(b *testing.B, set *jet.Set) {
+	tt, err := set.GetTemplate("/list.jet")
+	if err != nil {
+		b.Fatal(err)
+	}
+	items := make([]string, 100)
+	for i := range items {
+		items[i] = strings.Repeat("x", i%4)
+	}
+	vars := compiledTestVars(items...)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tt.Execute(ioutil.Discard, vars, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInterpretedList(b *testing.B) {
+	benchmarkList(b, jet.NewSet(jet.NewOSFileSystemLoader("./testData/compile")))
+}
+
+func BenchmarkCompiledList(b *testing.B) {
+	benchmarkList(b, jet.NewSet(jet.NewInMemLoader(), jet.WithCompiledTemplates(compiledTemplates)))
+}
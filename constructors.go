@@ -69,7 +69,7 @@ func (t *Template) newList(pos Pos) *ListNode {
 }
 
 func (t *Template) newText(pos Pos, text string) *TextNode {
-	return &TextNode{NodeBase: NodeBase{TemplatePath: t.Name, Item: t.curToken, NodeType: NodeText, Pos: pos}, Text: []byte(text)}
+	return &TextNode{NodeBase: NodeBase{TemplatePath: t.Name, Line: t.curToken.row, Item: t.curToken, NodeType: NodeText, Pos: pos}, Text: []byte(text)}
 }
 
 func (t *Template) newPipeline(pos Pos, line int) *PipeNode {
@@ -154,6 +154,22 @@ func (t *Template) newReturn(pos Pos, line int, pipe Expression) *ReturnNode {
 	return &ReturnNode{NodeBase: NodeBase{TemplatePath: t.Name, Line: line, Item: t.curToken, NodeType: NodeReturn, Pos: pos}, Value: pipe}
 }
 
+func (t *Template) newTranslation(pos Pos, line int, nodeType NodeType, key, count Expression, parameters []BlockParameter, list *ListNode) *TranslationNode {
+	return &TranslationNode{NodeBase: NodeBase{TemplatePath: t.Name, Line: line, Item: t.curToken, NodeType: nodeType, Pos: pos}, Key: key, Count: count, Parameters: parameters, List: list}
+}
+
+func (t *Template) newBreak(pos Pos, line int) *BreakNode {
+	return &BreakNode{NodeBase: NodeBase{TemplatePath: t.Name, Line: line, Item: t.curToken, NodeType: NodeBreak, Pos: pos}}
+}
+
+func (t *Template) newContinue(pos Pos, line int) *ContinueNode {
+	return &ContinueNode{NodeBase: NodeBase{TemplatePath: t.Name, Line: line, Item: t.curToken, NodeType: NodeContinue, Pos: pos}}
+}
+
+func (t *Template) newFlush(pos Pos, line int) *FlushNode {
+	return &FlushNode{NodeBase: NodeBase{TemplatePath: t.Name, Line: line, Item: t.curToken, NodeType: NodeFlush, Pos: pos}}
+}
+
 func (t *Template) newTry(pos Pos, line int, list *ListNode, catch *catchNode) *TryNode {
 	return &TryNode{NodeBase: NodeBase{TemplatePath: t.Name, Line: line, Item: t.curToken, NodeType: NodeTry, Pos: pos}, List: list, Catch: catch}
 }
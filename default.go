@@ -23,12 +23,23 @@ import (
 	"io/ioutil"
 	"net/url"
 	"reflect"
+	"sort"
 	"strings"
 	"text/template"
 )
 
 var defaultVariables map[string]reflect.Value
 
+// Builtins returns the names of the built-in functions and variables available to all templates, sorted.
+func Builtins() []string {
+	names := make([]string, 0, len(defaultVariables))
+	for name := range defaultVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func init() {
 	defaultVariables = map[string]reflect.Value{
 		"lower":     reflect.ValueOf(strings.ToLower),
@@ -82,7 +93,10 @@ func init() {
 		})),
 		"includeIfExists": reflect.ValueOf(Func(func(a Arguments) reflect.Value {
 			a.RequireNumOfArguments("includeIfExists", 1, 2)
-			t, err := a.runtime.set.GetTemplate(a.Get(0).String())
+			t, err := a.runtime.set.includeTemplate(nil, a.Get(0).String(), "/", true)
+			if err != nil && isSandboxError(err) {
+				panic(err)
+			}
 			// If template exists but returns an error then panic instead of failing silently
 			if t != nil && err != nil {
 				a.Panicf(errors.New().WithReason("invalid.includeIfExists").
@@ -93,14 +107,14 @@ func init() {
 				return hiddenFalse
 			}
 
+			if err := a.runtime.enter(a.at, "includeIfExists", t.Name); err != nil {
+				panic(err)
+			}
+
 			a.runtime.newScope()
 			defer a.runtime.releaseScope()
 
 			a.runtime.blocks = t.processedBlocks
-			root := t.Root
-			if t.extends != nil {
-				root = t.extends.Root
-			}
 
 			if a.NumOfArguments() > 1 {
 				c := a.runtime.context
@@ -108,21 +122,31 @@ func init() {
 				a.runtime.context = a.Get(1)
 			}
 
-			if _, err = a.runtime.executeList(root); err != nil {
-				a.Panicf(err.Error())
+			ev := a.runtime.traceEnter(TraceInclude, t.Root, t.Name)
+			_, err = a.runtime.executeTemplate(t)
+			a.runtime.traceExit(ev, err)
+			a.runtime.leave(err)
+			if err != nil {
+				panic(err)
 			}
 
 			return hiddenTrue
 		})),
 		"exec": reflect.ValueOf(Func(func(a Arguments) (result reflect.Value) {
 			a.RequireNumOfArguments("exec", 1, 2)
-			t, err := a.runtime.set.GetTemplate(a.Get(0).String())
-			if err != nil {
+			t, err := a.runtime.set.includeTemplate(nil, a.Get(0).String(), "/", true)
+			if err != nil && isSandboxError(err) {
+				panic(err)
+			} else if err != nil {
 				a.Panicf(errors.New().WithReason("invalid.exec").
 					WithMessage(fmt.Errorf("exec(%s, %v): %w", a.Get(0), a.Get(1), err).Error()).Error(),
 				)
 			}
 
+			if err := a.runtime.enter(a.at, "exec", t.Name); err != nil {
+				panic(err)
+			}
+
 			a.runtime.newScope()
 			defer a.runtime.releaseScope()
 
@@ -131,19 +155,18 @@ func init() {
 			a.runtime.Writer = ioutil.Discard
 
 			a.runtime.blocks = t.processedBlocks
-			root := t.Root
-			if t.extends != nil {
-				root = t.extends.Root
-			}
 
 			if a.NumOfArguments() > 1 {
 				c := a.runtime.context
 				defer func() { a.runtime.context = c }()
 				a.runtime.context = a.Get(1)
 			}
-			result, err = a.runtime.executeList(root)
+			ev := a.runtime.traceEnter(TraceInclude, t.Root, t.Name)
+			result, err = a.runtime.executeTemplate(t)
+			a.runtime.traceExit(ev, err)
+			a.runtime.leave(err)
 			if err != nil {
-				a.Panicf(err.Error())
+				panic(err)
 			}
 
 			return result
@@ -0,0 +1,299 @@
+package jet
+
+import (
+	"sort"
+	"strings"
+)
+
+// DependencyKind is the kind of reference from one template to another.
+type DependencyKind int
+
+const (
+	DependencyExtends DependencyKind = iota // an extends statement
+	DependencyImport                        // an import statement
+	DependencyInclude                       // an include statement, or a call of the includeIfExists or exec built-ins
+)
+
+func (k DependencyKind) String() string {
+	switch k {
+	case DependencyExtends:
+		return "extends"
+	case DependencyImport:
+		return "import"
+	case DependencyInclude:
+		return "include"
+	}
+	return "unknown"
+}
+
+// Dependency is a reference from the template at From to another template.
+type Dependency struct {
+	From string // path of the referencing template, including the extension
+	Kind DependencyKind
+	Line int // line of the reference in the referencing template
+
+	// Name is the template name as written in the referencing template, like "./header" or, for
+	// includes with a name computed at runtime, the expression computing it.
+	Name string
+	// Path is the path of the referenced template, resolved relative to From and including the extension
+	// found by the Set, like "/views/header.jet". It's empty for dynamic includes and references of templates
+	// that don't exist.
+	Path string
+	// Dynamic is set for includes with a name computed at runtime, which can't be resolved statically.
+	Dynamic bool
+
+	target string // Name resolved relative to From, without looking up the extension
+}
+
+// Dependencies returns the templates the template at templatePath extends, imports and includes, in the
+// order they appear in the template. The template is loaded if it's not yet cached. Templates compiled
+// to Go code have no dependencies.
+func (s *Set) Dependencies(templatePath string) ([]Dependency, error) {
+	t, err := s.GetTemplate(templatePath)
+	if err != nil {
+		return nil, err
+	}
+	return s.resolveDependencies(t.dependencies), nil
+}
+
+// Dependents returns the references to the template at templatePath from all templates the Set loaded
+// so far, sorted by the path of the referencing template. Dependencies on the template through dynamic
+// includes can't be found. To find templates that are not referenced by any other, load all templates
+// first.
+func (s *Set) Dependents(templatePath string) []Dependency {
+	canonicalPath, ok := s.resolveTemplatePath(resolveSibling(templatePath, "/"))
+	if !ok {
+		return nil
+	}
+	s.graphMx.RLock()
+	var candidates []Dependency
+	for _, t := range s.graph {
+		for _, d := range t.dependencies {
+			if !d.Dynamic && strings.HasPrefix(canonicalPath, d.target) {
+				candidates = append(candidates, d)
+			}
+		}
+	}
+	s.graphMx.RUnlock()
+
+	var dependents []Dependency
+	for _, d := range s.resolveDependencies(candidates) {
+		if d.Path == canonicalPath {
+			dependents = append(dependents, d)
+		}
+	}
+	sort.SliceStable(dependents, func(i, j int) bool {
+		if dependents[i].From != dependents[j].From {
+			return dependents[i].From < dependents[j].From
+		}
+		return dependents[i].Line < dependents[j].Line
+	})
+	return dependents
+}
+
+// resolveDependencies returns a copy of dependencies with the paths of the referenced templates resolved.
+func (s *Set) resolveDependencies(dependencies []Dependency) []Dependency {
+	resolved := make([]Dependency, len(dependencies))
+	for i, d := range dependencies {
+		if !d.Dynamic && d.Path == "" {
+			d.Path, _ = s.resolveTemplatePath(d.target)
+		}
+		resolved[i] = d
+	}
+	return resolved
+}
+
+// addDependencies records the dependencies of t for Dependents.
+func (s *Set) addDependencies(t *Template) {
+	s.graphMx.Lock()
+	defer s.graphMx.Unlock()
+	if s.graph == nil {
+		s.graph = map[string]*Template{}
+	}
+	s.graph[t.Name] = t
+}
+
+// removeDependencies forgets the dependencies of t, which was removed from the cache, unless the template at
+// its path was loaded again since.
+func (s *Set) removeDependencies(t *Template) {
+	s.graphMx.Lock()
+	defer s.graphMx.Unlock()
+	if s.graph[t.Name] == t {
+		delete(s.graph, t.Name)
+	}
+}
+
+// addDependency records a reference to the template named name at position pos of t.
+func (t *Template) addDependency(kind DependencyKind, name string, pos Pos, dynamic bool) *Dependency {
+	d := Dependency{
+		From:    t.Name,
+		Kind:    kind,
+		Line:    1 + strings.Count(t.text[:pos], "\n"),
+		Name:    name,
+		Dynamic: dynamic,
+	}
+	if !dynamic {
+		d.target = resolveSibling(name, t.Name)
+	}
+	t.dependencies = append(t.dependencies, d)
+	return &t.dependencies[len(t.dependencies)-1]
+}
+
+// findIncludes records the include statements and the calls of the includeIfExists and exec built-ins in node.
+func (t *Template) findIncludes(node Node) {
+	Inspect(node, func(node Node) {
+		var name Expression
+		switch node := node.(type) {
+		case *IncludeNode:
+			name = node.Name
+		case *CallExprNode:
+			name = includeCallName(node)
+		case *CommandNode:
+			name = includeCallName(&node.CallExprNode)
+		default:
+			return
+		}
+		if name == nil {
+			return
+		}
+		if s, ok := name.(*StringNode); ok {
+			t.addDependency(DependencyInclude, s.Text, node.Position(), false)
+		} else {
+			t.addDependency(DependencyInclude, name.String(), node.Position(), true)
+		}
+	})
+}
+
+// includeCallName returns the template name argument of calls of the includeIfExists and exec built-ins,
+// the call itself if the name is piped into it, or nil for other calls.
+func includeCallName(call *CallExprNode) Expression {
+	if ident, ok := call.BaseExpr.(*IdentifierNode); !ok || (ident.Ident != "includeIfExists" && ident.Ident != "exec") {
+		return nil
+	}
+	if len(call.Exprs) == 0 || call.HasPipeSlot {
+		return call
+	}
+	return call.Exprs[0]
+}
+
+// Inspect calls fn for node and every node below it, in the order they appear in the template.
+// Blocks declared in the template are inspected where they are declared.
+func Inspect(node Node, fn func(Node)) {
+	if node == nil || node == (*ListNode)(nil) {
+		return
+	}
+	fn(node)
+	switch node := node.(type) {
+	case *ListNode:
+		for _, n := range node.Nodes {
+			Inspect(n, fn)
+		}
+	case *ActionNode:
+		if node.Set != nil {
+			Inspect(node.Set, fn)
+		}
+		if node.Pipe != nil {
+			Inspect(node.Pipe, fn)
+		}
+	case *PipeNode:
+		for _, cmd := range node.Cmds {
+			Inspect(cmd, fn)
+		}
+	case *CommandNode:
+		inspectCall(&node.CallExprNode, fn)
+	case *CallExprNode:
+		inspectCall(node, fn)
+	case *SetNode:
+		for _, n := range node.Left {
+			Inspect(n, fn)
+		}
+		for _, n := range node.Right {
+			Inspect(n, fn)
+		}
+	case *IfNode:
+		inspectBranch(&node.BranchNode, fn)
+	case *RangeNode:
+		inspectBranch(&node.BranchNode, fn)
+	case *TryNode:
+		Inspect(node.List, fn)
+		if node.Catch != nil {
+			Inspect(node.Catch.List, fn)
+		}
+	case *ReturnNode:
+		Inspect(node.Value, fn)
+	case *BlockNode:
+		inspectParameters(node.Parameters, fn)
+		Inspect(node.Expression, fn)
+		Inspect(node.List, fn)
+		Inspect(node.Content, fn)
+	case *YieldNode:
+		inspectParameters(node.Parameters, fn)
+		Inspect(node.Expression, fn)
+		Inspect(node.Content, fn)
+	case *IncludeNode:
+		Inspect(node.Name, fn)
+		Inspect(node.Context, fn)
+	case *TranslationNode:
+		Inspect(node.Key, fn)
+		Inspect(node.Count, fn)
+		for _, p := range node.Parameters {
+			Inspect(p.Expression, fn)
+		}
+		Inspect(node.List, fn)
+	case *AdditiveExprNode:
+		Inspect(node.Left, fn)
+		Inspect(node.Right, fn)
+	case *MultiplicativeExprNode:
+		Inspect(node.Left, fn)
+		Inspect(node.Right, fn)
+	case *ComparativeExprNode:
+		Inspect(node.Left, fn)
+		Inspect(node.Right, fn)
+	case *NumericComparativeExprNode:
+		Inspect(node.Left, fn)
+		Inspect(node.Right, fn)
+	case *LogicalExprNode:
+		Inspect(node.Left, fn)
+		Inspect(node.Right, fn)
+	case *NotExprNode:
+		Inspect(node.Expr, fn)
+	case *TernaryExprNode:
+		Inspect(node.Boolean, fn)
+		Inspect(node.Left, fn)
+		Inspect(node.Right, fn)
+	case *IndexExprNode:
+		Inspect(node.Base, fn)
+		Inspect(node.Index, fn)
+	case *SliceExprNode:
+		Inspect(node.Base, fn)
+		Inspect(node.Index, fn)
+		Inspect(node.EndIndex, fn)
+	case *ChainNode:
+		Inspect(node.Node, fn)
+	}
+}
+
+func inspectCall(call *CallExprNode, fn func(Node)) {
+	Inspect(call.BaseExpr, fn)
+	for _, n := range call.Exprs {
+		Inspect(n, fn)
+	}
+}
+
+func inspectBranch(branch *BranchNode, fn func(Node)) {
+	if branch.Set != nil {
+		Inspect(branch.Set, fn)
+	}
+	Inspect(branch.Expression, fn)
+	Inspect(branch.List, fn)
+	Inspect(branch.ElseList, fn)
+}
+
+func inspectParameters(parameters *BlockParameterList, fn func(Node)) {
+	if parameters == nil {
+		return
+	}
+	for _, p := range parameters.List {
+		Inspect(p.Expression, fn)
+	}
+}
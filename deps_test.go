@@ -0,0 +1,57 @@
+package jet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDependencies(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l)
+	l.Set("/layout.jet", "<{{ yield body() }}>")
+	l.Set("/blocks.jet", `{{ block greeting() }}{{ include "/views/partial" }}{{ end }}`)
+	l.Set("/views/partial.jet", "partial")
+	l.Set("/views/page.jet", `{{ extends "../layout" }}
+{{ import "/blocks.jet" }}
+{{ block body() }}
+	{{ include "./partial" }}
+	{{ include name }}
+	{{ if exec("/missing") }}{{ includeIfExists: "partial.jet", . }}{{ end }}
+{{ end }}`)
+
+	deps, err := set.Dependencies("/views/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Dependency{
+		{From: "/views/page.jet", Kind: DependencyExtends, Line: 1, Name: "../layout", Path: "/layout.jet"},
+		{From: "/views/page.jet", Kind: DependencyImport, Line: 2, Name: "/blocks.jet", Path: "/blocks.jet"},
+		{From: "/views/page.jet", Kind: DependencyInclude, Line: 4, Name: "./partial", Path: "/views/partial.jet"},
+		{From: "/views/page.jet", Kind: DependencyInclude, Line: 5, Name: "name", Dynamic: true},
+		{From: "/views/page.jet", Kind: DependencyInclude, Line: 6, Name: "/missing"},
+		{From: "/views/page.jet", Kind: DependencyInclude, Line: 6, Name: "partial.jet", Path: "/views/partial.jet"},
+	}
+	if len(deps) != len(expected) {
+		t.Fatalf("expected %d dependencies, got %v", len(expected), deps)
+	}
+	for i := range expected {
+		deps[i].target = ""
+		if !reflect.DeepEqual(deps[i], expected[i]) {
+			t.Errorf("dependency %d: expected %+v, got %+v", i, expected[i], deps[i])
+		}
+	}
+
+	var dependents []string
+	for _, d := range set.Dependents("/views/partial") {
+		dependents = append(dependents, d.From+":"+d.Kind.String())
+	}
+	if expected := []string{"/blocks.jet:include", "/views/page.jet:include", "/views/page.jet:include"}; !reflect.DeepEqual(dependents, expected) {
+		t.Errorf("expected dependents %v, got %v", expected, dependents)
+	}
+	if dependents := set.Dependents("/layout.jet"); len(dependents) != 1 || dependents[0].Kind != DependencyExtends {
+		t.Errorf("expected /layout.jet to be extended by /views/page.jet, got %v", dependents)
+	}
+	if dependents := set.Dependents("/views/page.jet"); len(dependents) != 0 {
+		t.Errorf("expected no dependents of /views/page.jet, got %v", dependents)
+	}
+}
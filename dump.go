@@ -18,7 +18,9 @@ func dumpAll(a Arguments, depth int) reflect.Value {
 
 	ctx := a.runtime.context
 	fmt.Fprintln(&b, "Context:")
-	fmt.Fprintf(&b, "\t%s %#v\n", ctx.Type(), ctx)
+	if ctx.IsValid() {
+		fmt.Fprintf(&b, "\t%s %#v\n", ctx.Type(), ctx)
+	}
 
 	dumpScopeVars(&b, a.runtime.scope, 0)
 	dumpScopeVarsToDepth(&b, a.runtime.parent, depth)
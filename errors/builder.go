@@ -3,11 +3,15 @@ package errors
 import "fmt"
 
 type Builder struct {
-	T Template `json:"template,omitempty"`
-	R Reason   `json:"reason,omitempty"`
-	M Message  `json:"message,omitempty"`
-	P Position `json:"position,omitempty"`
-	D Details  `json:"details,omitempty"`
+	T Template      `json:"template,omitempty"`
+	R Reason        `json:"reason,omitempty"`
+	M Message       `json:"message,omitempty"`
+	P Position      `json:"position,omitempty"`
+	D Details       `json:"details,omitempty"`
+	S []Frame       `json:"stack,omitempty"`
+	C []SnippetLine `json:"snippet,omitempty"`
+	V []Value       `json:"values,omitempty"`
+	E error         `json:"-"`
 }
 
 type Position struct {
@@ -36,6 +40,10 @@ func (b *Builder) Error() string {
 	)
 }
 
+func (b *Builder) Template() Template {
+	return b.T
+}
+
 func (b *Builder) Reason() Reason {
 	return b.R
 }
@@ -95,6 +103,43 @@ func (b *Builder) WithDetails(d Details) Error {
 	return b
 }
 
+func (b *Builder) Stack() []Frame {
+	return b.S
+}
+
+func (b *Builder) WithStack(s []Frame) Error {
+	b.S = s
+	return b
+}
+
+func (b *Builder) Snippet() []SnippetLine {
+	return b.C
+}
+
+func (b *Builder) WithSnippet(c []SnippetLine) Error {
+	b.C = c
+	return b
+}
+
+func (b *Builder) Values() []Value {
+	return b.V
+}
+
+func (b *Builder) WithValue(expression, typ string) Error {
+	b.V = append(b.V, Value{Expression: expression, Type: typ})
+	return b
+}
+
+// Unwrap returns the error causing b, for errors.Is and errors.As.
+func (b *Builder) Unwrap() error {
+	return b.E
+}
+
+func (b *Builder) WithCause(err error) Error {
+	b.E = err
+	return b
+}
+
 func Build(r Reason, t Template, m Message, p Position) Error {
 	return &Builder{
 		R: r,
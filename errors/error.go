@@ -1,8 +1,15 @@
 package errors
 
+import (
+	"strings"
+)
+
 type Error interface {
 	error
 
+	// Template returns the path of the template the error occurred in.
+	Template() Template
+
 	Reason() Reason
 	WithReason(Reason) Error
 	CompleteReason(Reason) Error
@@ -18,4 +25,57 @@ type Error interface {
 	Details() Details
 	WithDetail(string, string) Error
 	WithDetails(Details) Error
+
+	// Stack returns the statements that led to the error, innermost first.
+	Stack() []Frame
+	WithStack([]Frame) Error
+
+	// Snippet returns the source lines around the position of the error.
+	Snippet() []SnippetLine
+	WithSnippet([]SnippetLine) Error
+
+	// Values returns the types of the values involved in the error.
+	Values() []Value
+	WithValue(expression, typ string) Error
+
+	// Unwrap returns the error causing this one, like an error returned by a function called in a template.
+	Unwrap() error
+	WithCause(error) Error
+}
+
+// Frame is a statement executing the template an error occurred in: a yield or block statement, an include,
+// a call of exec() or includeIfExists(), or an extends clause.
+type Frame struct {
+	Kind     string   `json:"kind"`           // "yield", "block", "include", "exec", "includeIfExists" or "extends"
+	Name     string   `json:"name,omitempty"` // name of the block or path of the template
+	Template Template `json:"template"`       // path of the template of the statement
+	Position Position `json:"position"`
+}
+
+func (f Frame) String() string {
+	return f.Kind + " " + f.Name + " at " + positionString(f.Template, f.Position)
+}
+
+// SnippetLine is a line of the source of a template.
+type SnippetLine struct {
+	Line Line   `json:"line"`
+	Text string `json:"text"`
+}
+
+// Value is a value involved in an error, like the operands of an operator or the value whose field
+// couldn't be found.
+type Value struct {
+	Expression string `json:"expression"`
+	Type       string `json:"type"`
+}
+
+// NewSnippet returns the lines of source around line, with up to context lines before and after it.
+func NewSnippet(source string, line Line, context int) []SnippetLine {
+	var snippet []SnippetLine
+	for i, text := range strings.Split(source, "\n") {
+		if n := i + 1; n >= line-context && n <= line+context {
+			snippet = append(snippet, SnippetLine{Line: n, Text: strings.TrimSuffix(text, "\r")})
+		}
+	}
+	return snippet
 }
@@ -0,0 +1,138 @@
+package errors
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+const (
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiBlue  = "\x1b[34m"
+	ansiReset = "\x1b[0m"
+)
+
+// Text renders err on several lines for terminals: the reason and message, the position, the snippet of the
+// source with a caret under the column of the error, the values involved and the stack. With color,
+// it highlights the parts with ANSI escape codes.
+func Text(err Error, color bool) string {
+	paint := func(s string, codes ...string) string {
+		if !color {
+			return s
+		}
+		return strings.Join(codes, "") + s + ansiReset
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n", paint(err.Reason(), ansiBold, ansiRed), paint(err.Message(), ansiBold))
+	p := err.Position()
+	if t := err.Template(); t != "" {
+		fmt.Fprintf(&b, "  %s %s\n", paint("-->", ansiBlue), positionString(t, p))
+	}
+
+	if snippet := err.Snippet(); len(snippet) > 0 {
+		width := len(fmt.Sprint(snippet[len(snippet)-1].Line))
+		gutter := func(line string) string {
+			return paint(fmt.Sprintf(" %*s |", width, line), ansiBlue)
+		}
+		for _, l := range snippet {
+			fmt.Fprintf(&b, "%s %s\n", gutter(fmt.Sprint(l.Line)), l.Text)
+			if l.Line == p.L && p.C > 0 {
+				fmt.Fprintf(&b, "%s %s%s\n", gutter(""), caretIndent(l.Text, p.C), paint("^", ansiBold, ansiRed))
+			}
+		}
+	}
+
+	if values := err.Values(); len(values) > 0 {
+		b.WriteString("  values:\n")
+		for _, v := range values {
+			fmt.Fprintf(&b, "    %s: %s\n", v.Expression, v.Type)
+		}
+	}
+	if stack := err.Stack(); len(stack) > 0 {
+		b.WriteString("  stack:\n")
+		for _, f := range stack {
+			fmt.Fprintf(&b, "    %s\n", f)
+		}
+	}
+	return b.String()
+}
+
+// HTML renders err as an HTML fragment with the same parts as Text. The elements have classes prefixed
+// with "jet-error" for styling.
+func HTML(err Error) string {
+	e := html.EscapeString
+	var b strings.Builder
+	b.WriteString(`<div class="jet-error">`)
+	fmt.Fprintf(&b, `<p class="jet-error-message"><strong class="jet-error-reason">%s</strong> %s</p>`, e(err.Reason()), e(err.Message()))
+	p := err.Position()
+	if t := err.Template(); t != "" {
+		fmt.Fprintf(&b, `<p class="jet-error-position">%s</p>`, e(positionString(t, p)))
+	}
+
+	if snippet := err.Snippet(); len(snippet) > 0 {
+		b.WriteString(`<pre class="jet-error-snippet">`)
+		for _, l := range snippet {
+			class := "jet-error-line"
+			if l.Line == p.L {
+				class += " jet-error-current"
+			}
+			fmt.Fprintf(&b, `<span class="%s"><span class="jet-error-number">%d</span> `, class, l.Line)
+			if l.Line == p.L && p.C > 0 && p.C <= len(l.Text)+1 {
+				// mark the rest of the token at the column
+				start := p.C - 1
+				end := start
+				for end < len(l.Text) && l.Text[end] != ' ' && l.Text[end] != '}' {
+					end++
+				}
+				fmt.Fprintf(&b, `%s<mark>%s</mark>%s`, e(l.Text[:start]), e(l.Text[start:end]), e(l.Text[end:]))
+			} else {
+				b.WriteString(e(l.Text))
+			}
+			b.WriteString("</span>\n")
+		}
+		b.WriteString(`</pre>`)
+	}
+
+	if values := err.Values(); len(values) > 0 {
+		b.WriteString(`<dl class="jet-error-values">`)
+		for _, v := range values {
+			fmt.Fprintf(&b, `<dt><code>%s</code></dt><dd><code>%s</code></dd>`, e(v.Expression), e(v.Type))
+		}
+		b.WriteString(`</dl>`)
+	}
+	if stack := err.Stack(); len(stack) > 0 {
+		b.WriteString(`<ol class="jet-error-stack">`)
+		for _, f := range stack {
+			fmt.Fprintf(&b, `<li><code>%s %s</code> at %s</li>`, e(f.Kind), e(f.Name), e(positionString(f.Template, f.Position)))
+		}
+		b.WriteString(`</ol>`)
+	}
+	b.WriteString(`</div>`)
+	return b.String()
+}
+
+func positionString(t Template, p Position) string {
+	if p.L == 0 {
+		return t
+	}
+	if p.C == 0 {
+		return fmt.Sprintf("%s:%d", t, p.L)
+	}
+	return fmt.Sprintf("%s:%d:%d", t, p.L, p.C)
+}
+
+// caretIndent returns the indentation of a caret under the byte column col of text, keeping tabs so that
+// the caret lines up.
+func caretIndent(text string, col Column) string {
+	var b strings.Builder
+	for i := 0; i < col-1; i++ {
+		if i < len(text) && text[i] == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
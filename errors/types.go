@@ -20,6 +20,29 @@ const (
 	UnexpectedClauseReason         Reason = "unexpected.clause"
 
 	NotFoundFieldOrMethodReason Reason = "not_found.field_or_method"
+
+	FuncErrorReason Reason = "func.error"
+
+	CancelledReason      Reason = "cancelled"
+	IterationLimitReason Reason = "limit.iterations"
+	DepthLimitReason     Reason = "limit.depth"
+	OutputLimitReason    Reason = "limit.output"
+	StepLimitReason      Reason = "limit.steps"
+	MemoryLimitReason    Reason = "limit.memory"
+
+	SandboxTypeReason    Reason = "sandbox.type"
+	SandboxMethodReason  Reason = "sandbox.method"
+	SandboxFuncReason    Reason = "sandbox.func"
+	SandboxIncludeReason Reason = "sandbox.include"
+
+	EscapeContextReason  Reason = "escape.context"
+	EscapeBranchesReason Reason = "escape.branches"
+
+	NotCompilableReason Reason = "compile.unsupported"
+
+	NotFoundTemplateReason Reason = "not_found.template"
+	NotRangeableReason     Reason = "not_rangeable"
+	UnknownTypeReason      Reason = "unknown.type"
 )
 
 type (
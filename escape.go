@@ -0,0 +1,821 @@
+package jet
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+// escapeState describes where in an HTML document the parser currently is.
+type escapeState uint8
+
+const (
+	stateText        escapeState = iota // HTML text between tags
+	stateComment                        // inside <!-- ... -->
+	stateTag                            // inside a tag, between attributes
+	stateAttrName                       // inside an attribute name
+	stateAfterName                      // after an attribute name, before '='
+	stateBeforeValue                    // after '=', before the attribute value
+	stateAttr                           // inside an attribute value
+	stateScript                         // inside a <script> element
+	stateStyle                          // inside a <style> element
+	stateRCDATA                         // inside <textarea> or <title>, where no tags are recognized
+)
+
+// attrKind describes how the value of an attribute is interpreted by a browser.
+type attrKind uint8
+
+const (
+	attrNormal attrKind = iota
+	attrURL
+	attrScript
+	attrStyle
+)
+
+// attrDelim is the delimiter of an attribute value.
+type attrDelim uint8
+
+const (
+	delimNone attrDelim = iota
+	delimDoubleQuote
+	delimSingleQuote
+	delimSpace
+)
+
+// jsState describes the part of a script that isn't a string literal the parser is in.
+type jsState uint8
+
+const (
+	jsCode         jsState = iota // JS code
+	jsLineComment                 // inside a // comment
+	jsBlockComment                // inside a /* */ comment
+	jsRegexp                      // inside a regular expression literal
+	jsRegexpClass                 // inside a character class of a regular expression literal
+)
+
+// jsSlash describes what a '/' in JS code starts, depending on the code before it, just like html/template's jsCtx.
+type jsSlash uint8
+
+const (
+	jsSlashRegexp    jsSlash = iota // a regular expression literal, e.g. after an operator or at the start of a statement
+	jsSlashDivOp                    // a division, e.g. after a value
+	jsSlashUnknown                  // either one, after branches ending in different places
+	jsSlashAmbiguous                // a '/' was found after jsSlashUnknown, the rest of the script can't be parsed
+)
+
+// escapeContext is the HTML parse state at some point between text nodes. It's computed at parse time
+// when contextual escaping is enabled and used to pick the escaper of each action.
+type escapeContext struct {
+	state   escapeState
+	delim   attrDelim
+	attr    attrKind
+	element string // name of the element whose content we're in (script, style, textarea, title) or are about to enter
+	urlPart bool   // true if the URL attribute value already has content, i.e. we're past the scheme
+	jsQuote byte   // quote character of the JS string we're in, or 0
+	js      jsState
+	jsSlash jsSlash
+}
+
+func (c escapeContext) String() string {
+	names := [...]string{"text", "comment", "tag", "attribute name", "after attribute name", "before attribute value", "attribute value", "script", "style", "RCDATA"}
+	s := names[c.state]
+	if c.element != "" {
+		s += " <" + c.element + ">"
+	}
+	if c.state == stateAttr {
+		s += [...]string{"", " (url)", " (script)", " (style)"}[c.attr]
+	}
+	if c.jsQuote != 0 {
+		s += fmt.Sprintf(" in JS string %c", c.jsQuote)
+	}
+	if c.js != jsCode {
+		s += [...]string{"", " in JS line comment", " in JS block comment", " in JS regexp", " in JS regexp"}[c.js]
+	}
+	return s
+}
+
+// advance returns the context after text was written in context c.
+func (c escapeContext) advance(text []byte) escapeContext {
+	for i := 0; i < len(text); {
+		c, i = c.step(text, i)
+	}
+	return c
+}
+
+// step consumes at least one byte of text starting at i and returns the new context and position.
+func (c escapeContext) step(text []byte, i int) (escapeContext, int) {
+	switch c.state {
+	case stateText, stateRCDATA:
+		j := bytes.IndexByte(text[i:], '<')
+		if j < 0 {
+			return c, len(text)
+		}
+		i += j
+		rest := text[i:]
+		if c.state == stateRCDATA {
+			if isEndTag(rest, c.element) {
+				return escapeContext{state: stateTag}, i + 2 + len(c.element)
+			}
+			return c, i + 1
+		}
+		if bytes.HasPrefix(rest, []byte("<!--")) {
+			return escapeContext{state: stateComment}, i + 4
+		}
+		if len(rest) > 1 && isASCIILetter(rest[1]) {
+			name := tagName(rest[1:])
+			return escapeContext{state: stateTag, element: specialElement(name)}, i + 1 + len(name)
+		}
+		if len(rest) > 2 && rest[1] == '/' && isASCIILetter(rest[2]) {
+			return escapeContext{state: stateTag}, i + 2 + len(tagName(rest[2:]))
+		}
+		return c, i + 1
+	case stateComment:
+		j := bytes.Index(text[i:], []byte("-->"))
+		if j < 0 {
+			return c, len(text)
+		}
+		return escapeContext{}, i + j + 3
+	case stateTag:
+		b := text[i]
+		switch {
+		case isHTMLSpace(b), b == '/':
+			return c, i + 1
+		case b == '>':
+			return elementContent(c.element), i + 1
+		}
+		name := attrName(text[i:])
+		c.state, c.attr = stateAttrName, attrKindOf(string(name))
+		if i+len(name) < len(text) {
+			c.state = stateAfterName
+		}
+		return c, i + len(name)
+	case stateAttrName:
+		// the attribute name was split by an action; whatever follows ends it
+		name := attrName(text[i:])
+		if len(name) == 0 {
+			c.state = stateAfterName
+		}
+		return c, i + len(name)
+	case stateAfterName:
+		b := text[i]
+		switch {
+		case isHTMLSpace(b):
+			return c, i + 1
+		case b == '=':
+			c.state = stateBeforeValue
+			return c, i + 1
+		}
+		c.state, c.attr = stateTag, attrNormal
+		return c, i
+	case stateBeforeValue:
+		b := text[i]
+		switch {
+		case isHTMLSpace(b):
+			return c, i + 1
+		case b == '"':
+			c.state, c.delim = stateAttr, delimDoubleQuote
+			return c, i + 1
+		case b == '\'':
+			c.state, c.delim = stateAttr, delimSingleQuote
+			return c, i + 1
+		case b == '>':
+			c.state, c.attr = stateTag, attrNormal
+			return c, i
+		}
+		c.state, c.delim = stateAttr, delimSpace
+		return c, i
+	case stateAttr:
+		b := text[i]
+		if (c.delim == delimDoubleQuote && b == '"') || (c.delim == delimSingleQuote && b == '\'') {
+			return escapeContext{state: stateTag, element: c.element}, i + 1
+		}
+		if c.delim == delimSpace && (isHTMLSpace(b) || b == '>') {
+			return escapeContext{state: stateTag, element: c.element}, i
+		}
+		switch c.attr {
+		case attrURL:
+			c.urlPart = true
+		case attrScript:
+			return c.stepJS(text, i)
+		}
+		return c, i + 1
+	case stateScript, stateStyle:
+		if text[i] == '<' && isEndTag(text[i:], c.element) {
+			return escapeContext{state: stateTag}, i + 2 + len(c.element)
+		}
+		if c.state == stateScript {
+			return c.stepJS(text, i)
+		}
+		return c, i + 1
+	}
+	return c, len(text)
+}
+
+// stepJS tracks whether we're inside a JS string literal, comment or regular expression literal.
+func (c escapeContext) stepJS(text []byte, i int) (escapeContext, int) {
+	b := text[i]
+	var next byte
+	if i+1 < len(text) {
+		next = text[i+1]
+	}
+	switch {
+	case c.jsQuote != 0:
+		switch b {
+		case '\\':
+			return c, i + 2
+		case c.jsQuote:
+			c.jsQuote, c.jsSlash = 0, jsSlashDivOp
+		}
+		return c, i + 1
+	case c.js == jsLineComment:
+		if b == '\n' || b == '\r' {
+			c.js = jsCode
+		}
+		return c, i + 1
+	case c.js == jsBlockComment:
+		if b == '*' && next == '/' {
+			c.js = jsCode
+			return c, i + 2
+		}
+		return c, i + 1
+	case c.js == jsRegexp, c.js == jsRegexpClass:
+		switch {
+		case b == '\\':
+			return c, i + 2
+		case b == '[':
+			c.js = jsRegexpClass
+		case b == ']' && c.js == jsRegexpClass:
+			c.js = jsRegexp
+		case b == '/' && c.js == jsRegexp:
+			c.js, c.jsSlash = jsCode, jsSlashDivOp
+		}
+		return c, i + 1
+	}
+	switch {
+	case b == '"' || b == '\'' || b == '`':
+		c.jsQuote = b
+	case b == '/' && next == '/':
+		c.js = jsLineComment
+		return c, i + 2
+	case b == '/' && next == '*':
+		c.js = jsBlockComment
+		return c, i + 2
+	case b == '/':
+		switch c.jsSlash {
+		case jsSlashRegexp:
+			c.js = jsRegexp
+		case jsSlashDivOp:
+			c.jsSlash = jsSlashRegexp
+		default:
+			c.jsSlash = jsSlashAmbiguous
+			return c, len(text)
+		}
+	case (b == '+' || b == '-') && next == b:
+		// like html/template, assume ++ and -- are postfix operators
+		c.jsSlash = jsSlashDivOp
+		return c, i + 2
+	case isJSIdentPart(b):
+		j := i + 1
+		for j < len(text) && isJSIdentPart(text[j]) {
+			j++
+		}
+		c.jsSlash = jsSlashDivOp
+		if regexpPrecederKeywords[string(text[i:j])] {
+			c.jsSlash = jsSlashRegexp
+		}
+		return c, j
+	case b == ')' || b == ']':
+		c.jsSlash = jsSlashDivOp
+	case isHTMLSpace(b):
+	default:
+		c.jsSlash = jsSlashRegexp
+	}
+	return c, i + 1
+}
+
+// regexpPrecederKeywords are the keywords after which a '/' starts a regular expression literal.
+var regexpPrecederKeywords = map[string]bool{
+	"break": true, "case": true, "continue": true, "delete": true, "do": true, "else": true, "finally": true,
+	"in": true, "instanceof": true, "return": true, "throw": true, "try": true, "typeof": true, "void": true,
+}
+
+func isJSIdentPart(b byte) bool {
+	return isASCIILetter(b) || ('0' <= b && b <= '9') || b == '_' || b == '$' || b == '.' || b >= utf8.RuneSelf
+}
+
+func elementContent(element string) escapeContext {
+	switch element {
+	case "script":
+		return escapeContext{state: stateScript, element: element}
+	case "style":
+		return escapeContext{state: stateStyle, element: element}
+	case "textarea", "title":
+		return escapeContext{state: stateRCDATA, element: element}
+	}
+	return escapeContext{}
+}
+
+func specialElement(name []byte) string {
+	switch n := strings.ToLower(string(name)); n {
+	case "script", "style", "textarea", "title":
+		return n
+	}
+	return ""
+}
+
+func attrKindOf(name string) attrKind {
+	name = strings.ToLower(name)
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name = name[i+1:] // strip namespace, e.g. xlink:href
+	}
+	switch {
+	case strings.HasPrefix(name, "on"):
+		return attrScript
+	case name == "style":
+		return attrStyle
+	}
+	switch name {
+	case "href", "src", "action", "formaction", "cite", "background", "poster", "codebase", "data", "manifest", "longdesc", "usemap", "icon", "profile", "classid", "archive":
+		return attrURL
+	}
+	if strings.Contains(name, "url") || strings.Contains(name, "uri") {
+		return attrURL
+	}
+	return attrNormal
+}
+
+func isEndTag(text []byte, element string) bool {
+	if len(text) < 2+len(element) || text[0] != '<' || text[1] != '/' {
+		return false
+	}
+	if !strings.EqualFold(string(text[2:2+len(element)]), element) {
+		return false
+	}
+	return len(text) == 2+len(element) || !isASCIILetter(text[2+len(element)])
+}
+
+func tagName(text []byte) []byte {
+	i := 0
+	for i < len(text) && (isASCIILetter(text[i]) || ('0' <= text[i] && text[i] <= '9') || text[i] == '-') {
+		i++
+	}
+	return text[:i]
+}
+
+func attrName(text []byte) []byte {
+	i := 0
+	for i < len(text) && !isHTMLSpace(text[i]) && text[i] != '=' && text[i] != '>' && text[i] != '/' {
+		i++
+	}
+	return text[:i]
+}
+
+func isASCIILetter(b byte) bool {
+	return ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+func isHTMLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+// afterAction returns the context after an action's output was written in context c.
+func (c escapeContext) afterAction() escapeContext {
+	if c.state == stateBeforeValue {
+		c.state, c.delim = stateAttr, delimSpace
+	}
+	if c.state == stateAttr && c.attr == attrURL {
+		c.urlPart = true
+	}
+	if (c.state == stateScript || (c.state == stateAttr && c.attr == attrScript)) && c.jsQuote == 0 && c.js == jsCode {
+		// the action wrote a value
+		c.jsSlash = jsSlashDivOp
+	}
+	return c
+}
+
+// join returns the context after branches ending in c and d. They may only disagree about what a '/' in JS code
+// would start.
+func (c escapeContext) join(d escapeContext) (escapeContext, bool) {
+	if c == d {
+		return c, true
+	}
+	c.jsSlash, d.jsSlash = jsSlashUnknown, jsSlashUnknown
+	return c, c == d
+}
+
+// compatible reports whether the contexts c and d only disagree about what a '/' in JS code would start.
+func (c escapeContext) compatible(d escapeContext) bool {
+	_, ok := c.join(d)
+	return ok
+}
+
+// jsEscaper returns the SafeWriter to use for actions in the script context c.
+func (c escapeContext) jsEscaper() SafeWriter {
+	switch {
+	case c.jsQuote != 0:
+		return jsStringEscaper
+	case c.js == jsLineComment, c.js == jsBlockComment:
+		return jsCommentEscaper
+	case c.js == jsRegexp, c.js == jsRegexpClass:
+		return jsRegexpEscaper
+	}
+	return jsValueEscaper
+}
+
+// escaper returns the SafeWriter to use for actions in context c.
+func (c escapeContext) escaper() SafeWriter {
+	switch c.state {
+	case stateTag, stateAttrName, stateAfterName:
+		return attrNameEscaper
+	case stateBeforeValue:
+		c.delim = delimSpace
+		fallthrough
+	case stateAttr:
+		var esc SafeWriter
+		switch c.attr {
+		case attrURL:
+			esc = urlStartEscaperHTML
+			if c.urlPart {
+				esc = urlPartEscaperHTML
+			}
+		case attrScript:
+			esc = chainEscapers(c.jsEscaper(), template.HTMLEscape)
+		case attrStyle:
+			esc = cssEscaperHTML
+		default:
+			esc = template.HTMLEscape
+		}
+		if c.delim == delimSpace {
+			// everything was HTML-escaped already, but unquoted values also have to be safe from spaces and such
+			return chainEscapers(esc, unquotedAttrEscaper)
+		}
+		return esc
+	case stateScript:
+		return c.jsEscaper()
+	case stateStyle:
+		return cssEscaper
+	}
+	return template.HTMLEscape
+}
+
+var (
+	urlStartEscaperHTML = chainEscapers(urlStartEscaper, template.HTMLEscape)
+	urlPartEscaperHTML  = chainEscapers(urlPartEscaper, template.HTMLEscape)
+	cssEscaperHTML      = chainEscapers(cssEscaper, template.HTMLEscape)
+)
+
+// chainEscapers returns a SafeWriter passing the output of first through second.
+func chainEscapers(first, second SafeWriter) SafeWriter {
+	return func(w io.Writer, b []byte) {
+		var buf bytes.Buffer
+		first(&buf, b)
+		second(w, buf.Bytes())
+	}
+}
+
+// filteredValue is written instead of values that are unsafe in their context, just like html/template does.
+const filteredValue = "ZgotmplZ"
+
+func attrNameEscaper(w io.Writer, b []byte) {
+	for _, c := range b {
+		if !isASCIILetter(c) && !('0' <= c && c <= '9') && c != '-' && c != '_' && c != ':' {
+			io.WriteString(w, filteredValue)
+			return
+		}
+	}
+	w.Write(b)
+}
+
+func unquotedAttrEscaper(w io.Writer, b []byte) {
+	last := 0
+	for i, c := range b {
+		switch c {
+		case 0, ' ', '\t', '\n', '\r', '\f', '"', '\'', '`', '=', '<', '>':
+			w.Write(b[last:i])
+			fmt.Fprintf(w, "&#%d;", c)
+			last = i + 1
+		}
+	}
+	w.Write(b[last:])
+}
+
+func jsStringEscaper(w io.Writer, b []byte) {
+	last := 0
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		switch {
+		case r < ' ', r == '\\', r == '"', r == '\'', r == '`', r == '$', r == '<', r == '>', r == '&', r == '=', r == '/', r == '\u2028', r == '\u2029':
+			w.Write(b[last:i])
+			fmt.Fprintf(w, `\u%04X`, r)
+			last = i + size
+		}
+		i += size
+	}
+	w.Write(b[last:])
+}
+
+// jsRegexpEscaper escapes values like jsStringEscaper does, but also the characters with a special meaning
+// in regular expressions. Empty values are written as an empty group, so they can't end up starting a comment.
+func jsRegexpEscaper(w io.Writer, b []byte) {
+	if len(b) == 0 {
+		io.WriteString(w, "(?:)")
+		return
+	}
+	last := 0
+	for i, c := range b {
+		if strings.IndexByte(`.*+?^$|()[]{}-`, c) >= 0 {
+			jsStringEscaper(w, b[last:i])
+			fmt.Fprintf(w, `\u%04X`, c)
+			last = i + 1
+		}
+	}
+	jsStringEscaper(w, b[last:])
+}
+
+// jsCommentEscaper drops values written into JS comments, which could otherwise end the comment.
+func jsCommentEscaper(w io.Writer, b []byte) {}
+
+// jsValueEscaper writes numbers and booleans as they are and quotes everything else as a JS string.
+func jsValueEscaper(w io.Writer, b []byte) {
+	if isJSLiteral(b) {
+		w.Write(b)
+		return
+	}
+	io.WriteString(w, `"`)
+	jsStringEscaper(w, b)
+	io.WriteString(w, `"`)
+}
+
+func isJSLiteral(b []byte) bool {
+	switch string(b) {
+	case "true", "false", "null":
+		return true
+	}
+	i := 0
+	if i < len(b) && b[i] == '-' {
+		i++
+	}
+	digits := 0
+	for ; i < len(b) && '0' <= b[i] && b[i] <= '9'; i++ {
+		digits++
+	}
+	if i < len(b) && b[i] == '.' {
+		for i++; i < len(b) && '0' <= b[i] && b[i] <= '9'; i++ {
+			digits++
+		}
+	}
+	if digits > 0 && i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			i++
+		}
+		exp := i
+		for ; i < len(b) && '0' <= b[i] && b[i] <= '9'; i++ {
+		}
+		if i == exp {
+			return false
+		}
+	}
+	return digits > 0 && i == len(b)
+}
+
+func cssEscaper(w io.Writer, b []byte) {
+	last := 0
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r < utf8.RuneSelf && !isASCIILetter(byte(r)) && !('0' <= r && r <= '9') && r != ' ' && r != '-' && r != '_' && r != '.' && r != ',' && r != '#' && r != '%' {
+			w.Write(b[last:i])
+			fmt.Fprintf(w, `\%x `, r)
+			last = i + size
+		}
+		i += size
+	}
+	w.Write(b[last:])
+}
+
+// urlStartEscaper filters URLs with schemes other than http, https and mailto and normalizes the rest.
+func urlStartEscaper(w io.Writer, b []byte) {
+	if i := bytes.IndexAny(b, ":/?#"); i >= 0 && b[i] == ':' {
+		switch strings.ToLower(string(b[:i])) {
+		case "http", "https", "mailto":
+		default:
+			io.WriteString(w, "#"+filteredValue)
+			return
+		}
+	}
+	urlNormalizer(w, b)
+}
+
+// urlNormalizer percent-encodes everything that's not allowed in a URL, but keeps its structure intact.
+func urlNormalizer(w io.Writer, b []byte) {
+	last := 0
+	for i, c := range b {
+		if isURLUnreserved(c) || strings.IndexByte("!#$&*+,/:;=?@[]%'()", c) >= 0 {
+			continue
+		}
+		w.Write(b[last:i])
+		fmt.Fprintf(w, "%%%02X", c)
+		last = i + 1
+	}
+	w.Write(b[last:])
+}
+
+// urlPartEscaper percent-encodes everything but unreserved characters, so values can't change the structure of the URL.
+func urlPartEscaper(w io.Writer, b []byte) {
+	last := 0
+	for i, c := range b {
+		if isURLUnreserved(c) {
+			continue
+		}
+		w.Write(b[last:i])
+		fmt.Fprintf(w, "%%%02X", c)
+		last = i + 1
+	}
+	w.Write(b[last:])
+}
+
+func isURLUnreserved(c byte) bool {
+	return isASCIILetter(c) || ('0' <= c && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// escape computes the HTML context of every action in the template and assigns the matching escaper.
+func (t *Template) escape() errors.Error {
+	_, err := t.escapeList(escapeContext{}, t.Root)
+	return err
+}
+
+func (t *Template) escapeList(c escapeContext, list *ListNode) (escapeContext, errors.Error) {
+	if list == nil {
+		return c, nil
+	}
+	var err errors.Error
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *TextNode:
+			if c = c.advance(node.Text); c.jsSlash == jsSlashAmbiguous {
+				return c, node.error(errors.EscapeContextReason, "'/' could start a division or a regular expression, branches before it end in different places of the script")
+			}
+		case *ActionNode:
+			if hasIncludeCall(node) && c != (escapeContext{}) {
+				return c, node.error(errors.EscapeContextReason, fmt.Sprintf("includeIfExists in %s, included templates can only be rendered in text", c))
+			}
+			if node.Pipe != nil {
+				node.escapee = c.escaper()
+				c = c.afterAction()
+			}
+		case *IncludeNode:
+			// included templates are escaped on their own, starting in text
+			if c != (escapeContext{}) {
+				return c, node.error(errors.EscapeContextReason, fmt.Sprintf("%s in %s, included templates can only be rendered in text", node, c))
+			}
+		case *TranslationNode:
+			// messages are assumed not to change the context, just like the msg content
+			node.escapee = c.escaper()
+			if c, err = t.escapeNeutral(c, node, "msg", node.List); err != nil {
+				return c, err
+			}
+			c = c.afterAction()
+		case *IfNode:
+			if c, err = t.escapeBranches(c, node, "if", node.List, node.ElseList); err != nil {
+				return c, err
+			}
+		case *TryNode:
+			var catch *ListNode
+			if node.Catch != nil {
+				catch = node.Catch.List
+			}
+			if c, err = t.escapeBranches(c, node, "try", node.List, catch); err != nil {
+				return c, err
+			}
+		case *RangeNode:
+			t.escapeLoops = append(t.escapeLoops, c)
+			end, err := t.escapeNeutral(c, node, "range", node.List)
+			t.escapeLoops = t.escapeLoops[:len(t.escapeLoops)-1]
+			if err != nil {
+				return c, err
+			}
+			if c, err = t.escapeNeutral(end, node, "range", node.ElseList); err != nil {
+				return c, err
+			}
+		case *BreakNode, *ContinueNode:
+			if len(t.escapeLoops) == 0 {
+				return c, node.error(errors.EscapeContextReason, fmt.Sprintf("%s outside of a range body", node))
+			}
+			// the loop continues with its next iteration or the nodes after it, both expecting the context the body started in
+			if start := t.escapeLoops[len(t.escapeLoops)-1]; !c.compatible(start) {
+				return c, node.error(errors.EscapeContextReason, fmt.Sprintf("%s in %s, but the range body starts in %s", node, c, start))
+			}
+		case *BlockNode:
+			loops := t.escapeLoops
+			t.escapeLoops = nil
+			start := c
+			if t.extends != nil {
+				// an overriding block is rendered wherever the block it replaces is
+				if parent, ok := t.extends.processedBlocks[node.Name]; ok && parent.escaped {
+					start = parent.escapeCtx
+				}
+			}
+			node.escapeCtx, node.escaped = start, true
+			end, err := t.escapeNeutral(start, node, "block "+node.Name, node.List)
+			if err != nil {
+				return c, err
+			}
+			if _, err = t.escapeNeutral(start, node, "content of block "+node.Name, node.Content); err != nil {
+				return c, err
+			}
+			if start == c {
+				c = end
+			}
+			t.escapeLoops = loops
+		case *YieldNode:
+			if !node.IsContent {
+				if block := t.lookupBlock(node.Name); block != nil && block.escaped && !block.escapeCtx.compatible(c) {
+					return c, node.error(errors.EscapeContextReason, fmt.Sprintf("yield of block %q in %s, but the block was declared in %s", node.Name, c, block.escapeCtx))
+				}
+			}
+			loops := t.escapeLoops
+			t.escapeLoops = nil
+			if _, err = t.escapeNeutral(c, node, "yield content", node.Content); err != nil {
+				return c, err
+			}
+			t.escapeLoops = loops
+		}
+	}
+	return c, nil
+}
+
+// escapeBranches escapes the branches of a conditional statement; both have to end in the same context.
+func (t *Template) escapeBranches(c escapeContext, node Node, statement string, list, elseList *ListNode) (escapeContext, errors.Error) {
+	c1, err := t.escapeList(c, list)
+	if err != nil {
+		return c, err
+	}
+	c2, err := t.escapeList(c, elseList)
+	if err != nil {
+		return c, err
+	}
+	end, ok := c1.join(c2)
+	if !ok {
+		return c, node.error(errors.EscapeBranchesReason, fmt.Sprintf("branches of %s end in different contexts: %s, %s", statement, c1, c2))
+	}
+	return end, nil
+}
+
+// escapeNeutral escapes a list that can be rendered any number of times and therefore has to end in the context it
+// starts in. It returns the context after the list was rendered any number of times.
+func (t *Template) escapeNeutral(c escapeContext, node Node, statement string, list *ListNode) (escapeContext, errors.Error) {
+	end, err := t.escapeList(c, list)
+	if err != nil {
+		return c, err
+	}
+	joined, ok := c.join(end)
+	if !ok {
+		return c, node.error(errors.EscapeContextReason, fmt.Sprintf("%s starts in %s, but ends in %s", statement, c, end))
+	}
+	if joined != c {
+		// the second time around, the list starts where the first one ended
+		return t.escapeNeutral(joined, node, statement, list)
+	}
+	return c, nil
+}
+
+// hasIncludeCall reports whether node calls the includeIfExists built-in, which renders the template it includes.
+// The output of templates run by exec is discarded, so exec is safe in any context.
+func hasIncludeCall(node *ActionNode) bool {
+	found := false
+	Inspect(node, func(node Node) {
+		var call *CallExprNode
+		switch node := node.(type) {
+		case *CallExprNode:
+			call = node
+		case *CommandNode:
+			call = &node.CallExprNode
+		default:
+			return
+		}
+		if ident, ok := call.BaseExpr.(*IdentifierNode); ok && ident.Ident == "includeIfExists" {
+			found = true
+		}
+	})
+	return found
+}
+
+func (t *Template) lookupBlock(name string) *BlockNode {
+	if block, ok := t.passedBlocks[name]; ok {
+		return block
+	}
+	for _, _import := range t.imports {
+		if block, ok := _import.processedBlocks[name]; ok {
+			return block
+		}
+	}
+	if t.extends != nil {
+		return t.extends.processedBlocks[name]
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package jet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+func TestContextualEscaping(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l, WithContextualEscaping())
+	vars := VarMap{}
+	vars.Set("x", `<a href="x">'&'</a>`)
+	vars.Set("url", "javascript:alert(1)")
+	vars.Set("path", "/search?q=a b")
+	vars.Set("q", "a&b=c d")
+	vars.Set("n", 42)
+	vars.Set("attr", `onclick="x"`)
+	vars.Set("js", "alert(1)")
+
+	tests := []struct {
+		name, content, expected string
+	}{
+		{"text", `<p>{{ x }}</p>`, `<p>&lt;a href=&#34;x&#34;&gt;&#39;&amp;&#39;&lt;/a&gt;</p>`},
+		{"quotedAttr", `<p title="{{ x }}">`, `<p title="&lt;a href=&#34;x&#34;&gt;&#39;&amp;&#39;&lt;/a&gt;">`},
+		{"unquotedAttr", `<p title={{ "a b" }}>`, `<p title=a&#32;b>`},
+		{"attrName", `<p {{ attr }}>`, `<p ZgotmplZ>`},
+		{"urlScheme", `<a href="{{ url }}">`, `<a href="#ZgotmplZ">`},
+		{"urlStart", `<a href="{{ path }}">`, `<a href="/search?q=a%20b">`},
+		{"urlPart", `<a href="/search?q={{ q }}">`, `<a href="/search?q=a%26b%3Dc%20d">`},
+		{"scriptValue", `<script>var n = {{ n }}, s = {{ "</script>" }};</script>`, `<script>var n = 42, s = "\u003C\u002Fscript\u003E";</script>`},
+		{"scriptString", `<script>var s = '{{ "it's" }}';</script>`, `<script>var s = 'it\u0027s';</script>`},
+		{"eventHandler", `<button onclick="go({{ "a\"b" }})">`, `<button onclick="go(&#34;a\u0022b&#34;)">`},
+		{"style", `<style>p { color: {{ "red;}" }} }</style>`, `<style>p { color: red\3b \7d  }</style>`},
+		{"styleAttr", `<p style="color: {{ "red" }}">`, `<p style="color: red">`},
+		{"textarea", `<textarea>{{ "</textarea>" }}</textarea>`, `<textarea>&lt;/textarea&gt;</textarea>`},
+		{"comment", `<!-- {{ "<" }} --><p>{{ "<" }}</p>`, `<!-- &lt; --><p>&lt;</p>`},
+		{"afterTag", `<script>{{ n }}</script><p>{{ "<" }}</p>`, `<script>42</script><p>&lt;</p>`},
+		{"unsafe", `<script>{{ "<b>" | raw }}</script>`, `<script><b></script>`},
+		{"if", `<a href="{{ if true }}{{ path }}{{ else }}/{{ end }}">`, `<a href="/search?q=a%20b">`},
+		{"range", `<ul>{{ range ints(0, 2) }}<li data-i="{{ . }}">{{ "<" }}</li>{{ end }}</ul>`, `<ul><li data-i="0">&lt;</li><li data-i="1">&lt;</li></ul>`},
+		{"scriptLineComment", `<script>// don't` + "\n" + `var a = {{ js }};</script>`, `<script>// don't` + "\n" + `var a = "alert(1)";</script>`},
+		{"scriptBlockComment", `<script>/* it's */ var a = {{ js }};</script>`, `<script>/* it's */ var a = "alert(1)";</script>`},
+		{"scriptInComment", `<script>/* {{ "*/alert(1)" }} */</script>`, `<script>/*  */</script>`},
+		{"scriptRegexp", `<script>var r = /'/, a = {{ js }} / 2;</script>`, `<script>var r = /'/, a = "alert(1)" / 2;</script>`},
+		{"scriptInRegexp", `<script>var r = /{{ "a.b/" }}/;</script>`, `<script>var r = /a\u002Eb\u002F/;</script>`},
+		{"scriptDivision", `<script>var a = 4 / 2, b = '{{ js }}';</script>`, `<script>var a = 4 / 2, b = 'alert(1)';</script>`},
+		{"scriptBranches", `<script>{{ if true }}f(){{ else }}1;{{ end }} var a = {{ js }};</script>`, `<script>f() var a = "alert(1)";</script>`},
+		{"returns", `{{ return "</script>" }}`, ``},
+		{"exec", `<script>var a = {{ exec("returns") }};</script>`, `<script>var a = "\u003C\u002Fscript\u003E";</script>`},
+	}
+	for _, test := range tests {
+		l.Set(test.name, test.content)
+		RunJetTestWithSet(t, set, vars, nil, test.name, test.expected)
+	}
+}
+
+func TestContextualEscapingBlocks(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l, WithContextualEscaping())
+	l.Set("layout.jet", `<script>var title = {{ block title() }}{{ "default" }}{{ end }};</script><p>{{ yield body() }}</p>{{ block body() }}{{ end }}`)
+	l.Set("page.jet", `{{ extends "layout.jet" }}{{ block title() }}{{ "</script>" }}{{ end }}{{ block body() }}{{ "</p>" }}{{ end }}`)
+	RunJetTestWithSet(t, set, nil, nil, "page.jet", `<script>var title = "\u003C\u002Fscript\u003E";</script><p>&lt;/p&gt;</p>&lt;/p&gt;`)
+}
+
+func TestContextualEscapingLongValues(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l, WithContextualEscaping())
+	long := strings.Repeat("a", 5000)
+	vars := VarMap{}
+	vars.Set("s", long)
+	vars.Set("url", "/"+long+"?x=javascript:alert(1)")
+	vars.Set("js", long+"javascript:alert(1)")
+	l.Set("script", `<script>var x = {{ s }};</script>`)
+	l.Set("url", `<a href="{{ url }}">`)
+	l.Set("scheme", `<a href="{{ js }}">`)
+	RunJetTestWithSet(t, set, vars, nil, "script", `<script>var x = "`+long+`";</script>`)
+	RunJetTestWithSet(t, set, vars, nil, "url", `<a href="/`+long+`?x=javascript:alert(1)">`)
+	RunJetTestWithSet(t, set, vars, nil, "scheme", `<a href="#ZgotmplZ">`)
+}
+
+func TestContextualEscapingErrors(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l, WithContextualEscaping())
+	tests := []struct {
+		name, content string
+		reason        errors.Reason
+		message       string
+	}{
+		{"branches", `{{ if true }}<a href="{{ else }}<b>{{ end }}`, errors.EscapeBranchesReason, "branches of if end in different contexts"},
+		{"range", `{{ range ints(0, 2) }}<a href="{{ end }}`, errors.EscapeContextReason, "range starts in text, but ends in attribute value (url)"},
+		{"block", `{{ block b() }}<script>{{ end }}`, errors.EscapeContextReason, "block b starts in text, but ends in script <script>"},
+		{"yield", `<p>{{ block b() }}{{ end }}</p><script>{{ yield b() }}</script>`, errors.EscapeContextReason, `yield of block "b" in script <script>, but the block was declared in text`},
+		{"break", `{{ range ints(0, 2) }}<a href="{{ break }}">{{ end }}`, errors.EscapeContextReason, "{{break}} in attribute value (url), but the range body starts in text"},
+		{"include", `<script>var a = {{ include "/inc.jet" }};</script>`, errors.EscapeContextReason, "included templates can only be rendered in text"},
+		{"includeIfExists", `<a href="{{ includeIfExists("/inc.jet") }}">`, errors.EscapeContextReason, "included templates can only be rendered in text"},
+		{"slash", `<script>{{ if true }}f(){{ else }}1;{{ end }} /a/.test(b)</script>`, errors.EscapeContextReason, "'/' could start a division or a regular expression"},
+	}
+	for _, test := range tests {
+		l.Set(test.name, test.content)
+		_, err := set.GetTemplate(test.name)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		jetErr, ok := err.(errors.Error)
+		if !ok || jetErr.Reason() != test.reason || !strings.Contains(jetErr.Message(), test.message) {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+}
@@ -16,6 +16,7 @@ package jet
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/CloudyKit/jet/v6/errors"
 	"io"
@@ -31,6 +32,8 @@ import (
 
 var (
 	funcType       = reflect.TypeOf(Func(nil))
+	errFuncType    = reflect.TypeOf(ErrFunc(nil))
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
 	stringerType   = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
 	rangerType     = reflect.TypeOf((*Ranger)(nil)).Elem()
 	rendererType   = reflect.TypeOf((*Renderer)(nil)).Elem()
@@ -60,10 +63,13 @@ type escapeeWriter struct {
 	Writer  io.Writer
 	escapee SafeWriter
 	set     *Set
+	buf     bytes.Buffer // value printed for the escapee of a context
 }
 
 func (w *escapeeWriter) Write(b []byte) (int, error) {
-	if w.set.escapee == nil {
+	if w.escapee != nil {
+		w.escapee(w.Writer, b)
+	} else if w.set.escapee == nil {
 		w.Writer.Write(b)
 	} else {
 		w.set.escapee(w.Writer, b)
@@ -71,6 +77,24 @@ func (w *escapeeWriter) Write(b []byte) (int, error) {
 	return 0, nil
 }
 
+// printValue prints v. The escaper of a context gets the whole value at once, since values are printed
+// in chunks and escapers like those of JS values and URLs quote or check the value as a whole.
+func (w *escapeeWriter) printValue(v reflect.Value) error {
+	if w.escapee == nil {
+		_, err := fastprinter.PrintValue(w, v)
+		return err
+	}
+	w.buf.Reset()
+	if _, err := fastprinter.PrintValue(&w.buf, v); err != nil {
+		return err
+	}
+	w.escapee(w.Writer, w.buf.Bytes())
+	if w.buf.Cap() > 64<<10 {
+		w.buf = bytes.Buffer{} // don't keep large values in pooled runtimes
+	}
+	return nil
+}
+
 // Runtime this type holds the state of the execution of an template
 type Runtime struct {
 	*escapeeWriter
@@ -78,6 +102,28 @@ type Runtime struct {
 	content func(*Runtime, Expression) errors.Error
 
 	context reflect.Value
+	locale  string
+
+	ctx        context.Context
+	done       <-chan struct{}
+	halt       errors.Error // set when the execution was cancelled or exceeded a limit
+	iterations int64
+	frames     []frame // yields and includes being executed
+	steps      int64
+	memory     int64 // estimated bytes allocated
+	output     *limitWriter
+	blockDepth int // number of blocks being rendered
+
+	loopControl NodeType // NodeBreak or NodeContinue while leaving the lists of a range body, 0 otherwise
+
+	at        NodeBase     // position of the statement executed by a compiled template
+	callNodes []valueNode  // stack of the callees and arguments of the functions called by compiled templates
+	callArgs  []Expression // stack of the arguments in callNodes
+
+	sourceMap *sourceMapWriter // set when executing with a source map
+
+	tracer Tracer
+	trace  *TraceEvent // the innermost event entered
 }
 
 // Context returns the current context value
@@ -194,12 +240,29 @@ func (rt *Runtime) resolve(name string) (reflect.Value, errors.Error) {
 		return rt.context, nil
 	}
 
+	v, ok := rt.lookup(name)
+	if ok {
+		if p := rt.set.sandbox; p != nil {
+			if err := p.checkFunc(name, v); err != nil {
+				return reflect.Value{}, err
+			}
+		}
+		return v, nil
+	}
+
+	return reflect.Value{}, errors.New().
+		WithReason("not_available.identifier").
+		WithMessage(fmt.Sprintf("identifier %q not available in current (%+v) or parent scope, global, or default variables", name, rt.scope.variables))
+}
+
+// lookup looks name up in the variable scopes, the globals and the default variables.
+func (rt *Runtime) lookup(name string) (reflect.Value, bool) {
 	// try current, then parent variable scopes
 	sc := rt.scope
 	for sc != nil {
 		v, ok := sc.variables[name]
 		if ok {
-			return indirectEface(v), nil
+			return indirectEface(v), true
 		}
 		sc = sc.parent
 	}
@@ -209,18 +272,15 @@ func (rt *Runtime) resolve(name string) (reflect.Value, errors.Error) {
 	v, ok := rt.set.globals[name]
 	rt.set.gmx.RUnlock()
 	if ok {
-		return indirectEface(v), nil
+		return indirectEface(v), true
 	}
 
 	// try default variables
 	v, ok = defaultVariables[name]
 	if ok {
-		return indirectEface(v), nil
+		return indirectEface(v), true
 	}
-
-	return reflect.Value{}, errors.New().
-		WithReason("not_available.identifier").
-		WithMessage(fmt.Sprintf("identifier %q not available in current (%+v) or parent scope, global, or default variables", name, rt.scope.variables))
+	return reflect.Value{}, false
 }
 
 // Resolve calls resolve() and ignores any errors, meaning it may return a zero reflect.Value.
@@ -239,11 +299,16 @@ func (rt *Runtime) MustResolve(name string) reflect.Value {
 }
 
 func (rt *Runtime) recover(err *error) {
+	recovered := recover()
+	if recovered != nil {
+		rt.unwindTrace(nil, recovered)
+		rt.unwindFrames(0, recovered)
+	}
 	// reset state scope and context just to be safe (they might not be cleared properly if there was a panic while using the state)
 	rt.scope = &scope{}
 	rt.context = reflect.Value{}
 	pool_State.Put(rt)
-	if recovered := recover(); recovered != nil {
+	if recovered != nil {
 		var ok bool
 		if _, ok = recovered.(runtime.Error); ok {
 			panic(recovered)
@@ -276,12 +341,17 @@ func (rt *Runtime) executeSet(left Expression, right reflect.Value) errors.Error
 	}
 	lef := len(fields) - 1
 	for i := 0; i < lef; i++ {
-		value, err = resolveIndex(value, reflect.Value{}, fields[i].name, fields[i].lax)
+		value, err = rt.resolveIndex(value, reflect.Value{}, fields[i].name, fields[i].lax)
 		if err != nil {
 			return left.error(err.WithColumn(errors.Column(left.Position())).Reason(), err.Message())
 		}
 	}
 
+	if p := rt.set.sandbox; p != nil {
+		if err := p.checkMember(value, fields[lef].name); err != nil {
+			return left.error(err.Reason(), err.Message())
+		}
+	}
 	for {
 		switch value.Kind() {
 		case reflect.Ptr:
@@ -476,10 +546,14 @@ func (rt *Runtime) executeList(list *ListNode) (returnValue reflect.Value, err e
 
 	for i := 0; i < len(list.Nodes); i++ {
 		node := list.Nodes[i]
+		if err := rt.step(node.base()); err != nil {
+			return reflect.Value{}, err
+		}
 
 		switch node.Type() {
 		case NodeText:
 			node := node.(*TextNode)
+			rt.mapOutput(&node.NodeBase)
 			if _, err := rt.Writer.Write(node.Text); err != nil {
 				return reflect.Value{}, node.error("", err.Error())
 			}
@@ -498,15 +572,24 @@ func (rt *Runtime) executeList(list *ListNode) (returnValue reflect.Value, err e
 				}
 			}
 			if node.Pipe != nil {
+				rt.mapOutput(&node.NodeBase)
 				v, safeWriter, err := rt.evalPipelineExpression(node.Pipe)
 				if err != nil {
 					return reflect.Value{}, err
 				}
+				// functions called by the pipeline may have executed other templates
+				rt.mapOutput(&node.NodeBase)
 				if !safeWriter && v.IsValid() {
+					if err := rt.checkPrint(v, node); err != nil {
+						return reflect.Value{}, err
+					}
 					if v.Type().Implements(rendererType) {
 						v.Interface().(Renderer).Render(rt)
 					} else {
-						if _, err := fastprinter.PrintValue(rt.escapeeWriter, v); err != nil {
+						rt.escapeeWriter.escapee = node.escapee
+						err := rt.escapeeWriter.printValue(v)
+						rt.escapeeWriter.escapee = nil
+						if err != nil {
 							return reflect.Value{}, node.error("", err.Error())
 						}
 					}
@@ -566,9 +649,16 @@ func (rt *Runtime) executeList(list *ListNode) (returnValue reflect.Value, err e
 				}
 			}
 
-			ranger, cleanup, err := getRanger(expression)
-			if err != nil {
-				return reflect.Value{}, node.error("", err.Error())
+			ranger, cleanup, rangeErr := getRanger(expression)
+			if rangeErr != nil {
+				rangeExpression := node.Expression
+				if isSet {
+					rangeExpression = node.Set.Right[0]
+				}
+				return reflect.Value{}, node.error("", rangeErr.Error()).WithValue(rangeExpression.String(), getTypeString(expression))
+			}
+			if r, ok := ranger.(*chanRanger); ok {
+				r.done = rt.done
 			}
 			if !ranger.ProvidesIndex() {
 				if isSet && len(node.Set.Left) > 1 {
@@ -579,9 +669,19 @@ func (rt *Runtime) executeList(list *ListNode) (returnValue reflect.Value, err e
 				}
 			}
 
+			ev := rt.traceEnter(TraceRange, node, "")
 			indexValue, rangeValue, end := ranger.Range()
 			if !end {
 				for !end && !returnValue.IsValid() {
+					if err = rt.iterate(node); err != nil {
+						break
+					}
+					if p := rt.set.sandbox; p != nil {
+						if sbErr := p.checkRanged(rangeValue); sbErr != nil {
+							err = node.error(sbErr.Reason(), sbErr.Message())
+							break
+						}
+					}
 					if isSet {
 						if isLet {
 							if keyVarSlot >= 0 {
@@ -603,6 +703,14 @@ func (rt *Runtime) executeList(list *ListNode) (returnValue reflect.Value, err e
 						rt.context = rangeValue
 					}
 					returnValue, err = rt.executeList(node.List)
+					if err != nil {
+						break
+					}
+					loopControl := rt.loopControl
+					rt.loopControl = 0
+					if loopControl == NodeBreak {
+						break
+					}
 					indexValue, rangeValue, end = ranger.Range()
 				}
 			} else if node.ElseList != nil {
@@ -613,6 +721,10 @@ func (rt *Runtime) executeList(list *ListNode) (returnValue reflect.Value, err e
 			if isLet {
 				rt.releaseScope()
 			}
+			if err == nil {
+				err = rt.interrupted(node)
+			}
+			rt.traceExit(ev, err)
 		case NodeTry:
 			node := node.(*TryNode)
 			returnValue, err = rt.executeTry(node)
@@ -627,7 +739,15 @@ func (rt *Runtime) executeList(list *ListNode) (returnValue reflect.Value, err e
 				if has == false || block == nil {
 					return reflect.Value{}, node.error("unresolved.block", fmt.Sprintf("unresolved block %q!!", node.Name))
 				}
+				if err = rt.enter(node, "yield", node.Name); err != nil {
+					return reflect.Value{}, err
+				}
+				ev := rt.traceEnter(TraceYield, node, node.Name)
+				rt.blockDepth++
 				err = rt.executeYieldBlock(block, block.Parameters, node.Parameters, node.Expression, node.Content)
+				rt.leave(err)
+				err = rt.blockDone(node, err)
+				rt.traceExit(ev, err)
 			}
 		case NodeBlock:
 			node := node.(*BlockNode)
@@ -635,13 +755,35 @@ func (rt *Runtime) executeList(list *ListNode) (returnValue reflect.Value, err e
 			if has == false {
 				block = node
 			}
+			if err = rt.enter(node, "block", node.Name); err != nil {
+				return reflect.Value{}, err
+			}
+			ev := rt.traceEnter(TraceBlock, node, node.Name)
+			rt.blockDepth++
 			err = rt.executeYieldBlock(block, block.Parameters, block.Parameters, block.Expression, block.Content)
+			rt.leave(err)
+			err = rt.blockDone(node, err)
+			rt.traceExit(ev, err)
 		case NodeInclude:
 			node := node.(*IncludeNode)
 			returnValue, err = rt.executeInclude(node)
 		case NodeReturn:
 			node := node.(*ReturnNode)
 			returnValue, err = rt.evalPrimaryExpressionGroup(node.Value)
+		case NodeTrans, NodeMsg:
+			node := node.(*TranslationNode)
+			rt.mapOutput(&node.NodeBase)
+			err = rt.executeTranslation(node)
+		case NodeBreak, NodeContinue:
+			rt.loopControl = node.Type()
+		case NodeFlush:
+			err = rt.flush(node)
+		}
+		if err == nil && (rt.halt != nil || (rt.output != nil && rt.output.exceeded)) {
+			err = rt.interrupted(node)
+		}
+		if err != nil || rt.loopControl != 0 {
+			return returnValue, err
 		}
 	}
 
@@ -649,16 +791,37 @@ func (rt *Runtime) executeList(list *ListNode) (returnValue reflect.Value, err e
 }
 
 func (rt *Runtime) executeTry(try *TryNode) (returnValue reflect.Value, err errors.Error) {
-	writer := rt.Writer
+	writer, sourceMap, trace, frames := rt.Writer, rt.sourceMap, rt.trace, len(rt.frames)
 	buf := new(bytes.Buffer)
+	var buffered *sourceMapWriter // records the source of the buffered output
+	if sourceMap != nil {
+		buffered = &sourceMapWriter{w: buf, at: sourceMap.at}
+	}
 
 	defer func() {
 		r := recover()
+		if r == nil && err != nil && rt.halt == nil && err.Reason() == errors.FuncErrorReason {
+			// errors returned by functions are caught like panics, other errors returned by the body aren't
+			r, returnValue, err = err, reflect.Value{}, nil
+		}
 
 		// copy buffered render output to writer only if no panic occured
 		if r == nil {
+			if buffered != nil {
+				sourceMap.pending = buffered.segments
+			}
 			io.Copy(writer, buf)
+			if buffered != nil {
+				sourceMap.pending = nil
+			}
+		} else if rt.halt != nil {
+			// cancellation and exceeded limits can't be caught
+			rt.unwindTrace(trace, r)
+			rt.unwindFrames(frames, r)
+			err = rt.halt
 		} else {
+			rt.unwindTrace(trace, r)
+			rt.unwindFrames(frames, r)
 			// rt.Writer is already set to its original value since the later defer ran first
 			if try.Catch != nil {
 				if try.Catch.Err != nil {
@@ -676,7 +839,10 @@ func (rt *Runtime) executeTry(try *TryNode) (returnValue reflect.Value, err erro
 	}()
 
 	rt.Writer = buf
-	defer func() { rt.Writer = writer }()
+	if buffered != nil {
+		rt.Writer, rt.sourceMap = buffered, buffered
+	}
+	defer func() { rt.Writer, rt.sourceMap = writer, sourceMap }()
 
 	return rt.executeList(try.List)
 }
@@ -698,11 +864,16 @@ func (rt *Runtime) executeInclude(node *IncludeNode) (returnValue reflect.Value,
 		return reflect.Value{}, node.error(errors.UnexpectedExpressionTypeReason, fmt.Sprintf("evaluating name of template to include: unexpected expression type %q", getTypeString(name)))
 	}
 
-	t, getTemplateErr := rt.set.getSiblingTemplate(templatePath, node.TemplatePath, true)
-	if err != nil {
-		return reflect.Value{}, node.error("", getTemplateErr.Error())
+	t, getTemplateErr := rt.set.includeTemplate(nil, templatePath, node.TemplatePath, true)
+	if getTemplateErr != nil {
+		return reflect.Value{}, node.error(includeError(getTemplateErr))
 	}
 
+	if err = rt.enter(node, "include", t.Name); err != nil {
+		return reflect.Value{}, err
+	}
+	ev := rt.traceEnter(TraceInclude, node, t.Name)
+
 	rt.newScope()
 	defer rt.releaseScope()
 
@@ -714,18 +885,17 @@ func (rt *Runtime) executeInclude(node *IncludeNode) (returnValue reflect.Value,
 		defer func() { rt.context = context }()
 		contextExpression, err := rt.evalPrimaryExpressionGroup(node.Context)
 		if err != nil {
+			rt.traceExit(ev, err)
+			rt.leave(err)
 			return reflect.Value{}, err
 		}
 		rt.context = contextExpression
 	}
 
-	Root := t.Root
-	for t.extends != nil {
-		t = t.extends
-		Root = t.Root
-	}
-
-	return rt.executeList(Root)
+	returnValue, err = rt.executeTemplate(t)
+	rt.traceExit(ev, err)
+	rt.leave(err)
+	return returnValue, err
 }
 
 var (
@@ -768,11 +938,11 @@ func (rt *Runtime) evalPrimaryExpressionGroup(node Expression) (reflect.Value, e
 			return reflect.Value{}, err
 		}
 		if baseExpr.Kind() != reflect.Func {
-			return reflect.Value{}, node.error("invalid.node", fmt.Sprintf("node %q is not func kind %q", node.BaseExpr, baseExpr.Type()))
+			return reflect.Value{}, node.error("invalid.node", fmt.Sprintf("node %q is not func kind %q", node.BaseExpr, baseExpr.Type())).WithValue(node.BaseExpr.String(), getTypeString(baseExpr))
 		}
-		ret, err := rt.evalCallExpression(baseExpr, node.CallArgs)
+		ret, err := rt.evalCallExpression(node.BaseExpr, baseExpr, node.CallArgs)
 		if err != nil {
-			return reflect.Value{}, node.error("", err.Error())
+			return reflect.Value{}, positionError(node.base(), err)
 		}
 		return ret, nil
 	case NodeIndexExpr:
@@ -786,9 +956,9 @@ func (rt *Runtime) evalPrimaryExpressionGroup(node Expression) (reflect.Value, e
 			return reflect.Value{}, err
 		}
 
-		resolved, err := resolveIndex(base, index, "", node.Lax)
+		resolved, err := rt.resolveIndex(base, index, "", node.Lax)
 		if err != nil {
-			return reflect.Value{}, node.error(err.Reason(), err.Message())
+			return reflect.Value{}, withOperands(node.error(err.Reason(), err.Message()), node.Base, base, node.Index, index)
 		}
 		return resolved, nil
 	case NodeSliceExpr:
@@ -845,9 +1015,12 @@ func notNil(v reflect.Value) bool {
 }
 
 func (rt *Runtime) isSet(node Node) (ok bool, err errors.Error) {
+	trace, frames := rt.trace, len(rt.frames)
 	defer func() {
 		if r := recover(); r != nil {
 			// something panicked while evaluating node
+			rt.unwindTrace(trace, r)
+			rt.unwindFrames(frames, r)
 			ok = false
 		}
 	}()
@@ -878,7 +1051,7 @@ func (rt *Runtime) isSet(node Node) (ok bool, err errors.Error) {
 			return false, err
 		}
 
-		resolved, err := resolveIndex(base, index, "", node.Lax)
+		resolved, err := rt.resolveIndex(base, index, "", node.Lax)
 		return err == nil && notNil(resolved), nil
 	case NodeIdentifier:
 		value, err := rt.resolve(node.String())
@@ -888,7 +1061,7 @@ func (rt *Runtime) isSet(node Node) (ok bool, err errors.Error) {
 		resolved := rt.context
 		for i := 0; i < len(node.Idents); i++ {
 			var err error
-			resolved, err = resolveIndex(resolved, reflect.Value{}, node.Idents[i].name, node.Idents[i].lax)
+			resolved, err = rt.resolveIndex(resolved, reflect.Value{}, node.Idents[i].name, node.Idents[i].lax)
 			if err != nil || !notNil(resolved) {
 				return false, nil
 			}
@@ -915,88 +1088,84 @@ func (rt *Runtime) evalNumericComparativeExpression(node *NumericComparativeExpr
 	if err != nil {
 		return reflect.Value{}, err
 	}
-	isTrue := false
-	kind := left.Kind()
+	isTrue, ok := compareNumbers(node.Operator.kind, left, right)
+	if !ok {
+		return reflect.Value{}, withOperands(node.Left.error(errors.InvalidValueReason, "a non numeric value in numeric comparative expression"), node.Left, left, node.Right, right)
+	}
+	return reflect.ValueOf(isTrue), nil
+}
 
+// compareNumbers evaluates the numeric comparison op (>, >=, < or <=) of left and right. ok is false if left is
+// not a number.
+func compareNumbers(op itemKind, left, right reflect.Value) (result, ok bool) {
+	kind := left.Kind()
 	// if the left value is not a float and the right is, we need to promote the left value to a float before the calculation
 	// this is necessary for expressions like 4*1.23
 	needFloatPromotion := !isFloat(kind) && isFloat(right.Kind())
+	switch {
+	case isInt(kind) && needFloatPromotion:
+		return compareFloats(op, float64(left.Int()), right.Float()), true
+	case isInt(kind):
+		return ordered(op, compareInts(left.Int(), toInt(right))), true
+	case isFloat(kind):
+		return compareFloats(op, left.Float(), toFloat(right)), true
+	case isUint(kind) && needFloatPromotion:
+		return compareFloats(op, float64(left.Uint()), right.Float()), true
+	case isUint(kind):
+		return ordered(op, compareUints(left.Uint(), toUint(right))), true
+	}
+	return false, false
+}
 
-	switch node.Operator.kind {
+func compareFloats(op itemKind, a, b float64) bool {
+	switch op {
 	case itemGreat:
-		if isInt(kind) {
-			if needFloatPromotion {
-				isTrue = float64(left.Int()) > right.Float()
-			} else {
-				isTrue = left.Int() > toInt(right)
-			}
-		} else if isFloat(kind) {
-			isTrue = left.Float() > toFloat(right)
-		} else if isUint(kind) {
-			if needFloatPromotion {
-				isTrue = float64(left.Uint()) > right.Float()
-			} else {
-				isTrue = left.Uint() > toUint(right)
-			}
-		} else {
-			return reflect.Value{}, node.Left.error(errors.InvalidValueReason, "a non numeric value in numeric comparative expression")
-		}
+		return a > b
 	case itemGreatEquals:
-		if isInt(kind) {
-			if needFloatPromotion {
-				isTrue = float64(left.Int()) >= right.Float()
-			} else {
-				isTrue = left.Int() >= toInt(right)
-			}
-		} else if isFloat(kind) {
-			isTrue = left.Float() >= toFloat(right)
-		} else if isUint(kind) {
-			if needFloatPromotion {
-				isTrue = float64(left.Uint()) >= right.Float()
-			} else {
-				isTrue = left.Uint() >= toUint(right)
-			}
-		} else {
-			return reflect.Value{}, node.Left.error(errors.InvalidValueReason, "a non numeric value in numeric comparative expression")
-		}
+		return a >= b
 	case itemLess:
-		if isInt(kind) {
-			if needFloatPromotion {
-				isTrue = float64(left.Int()) < right.Float()
-			} else {
-				isTrue = left.Int() < toInt(right)
-			}
-		} else if isFloat(kind) {
-			isTrue = left.Float() < toFloat(right)
-		} else if isUint(kind) {
-			if needFloatPromotion {
-				isTrue = float64(left.Uint()) < right.Float()
-			} else {
-				isTrue = left.Uint() < toUint(right)
-			}
-		} else {
-			return reflect.Value{}, node.Left.error(errors.InvalidValueReason, "a non numeric value in numeric comparative expression")
-		}
+		return a < b
 	case itemLessEquals:
-		if isInt(kind) {
-			if needFloatPromotion {
-				isTrue = float64(left.Int()) <= right.Float()
-			} else {
-				isTrue = left.Int() <= toInt(right)
-			}
-		} else if isFloat(kind) {
-			isTrue = left.Float() <= toFloat(right)
-		} else if isUint(kind) {
-			if needFloatPromotion {
-				isTrue = float64(left.Uint()) <= right.Float()
-			} else {
-				isTrue = left.Uint() <= toUint(right)
-			}
-		} else {
-			return reflect.Value{}, node.Left.error(errors.InvalidValueReason, "a non numeric value in numeric comparative expression")
-		}
+		return a <= b
 	}
-	return reflect.ValueOf(isTrue), nil
+	return false
+}
+
+// ordered reports whether the numeric comparison op holds for operands comparing as c, see compareInts.
+func ordered(op itemKind, c int) bool {
+	switch op {
+	case itemGreat:
+		return c > 0
+	case itemGreatEquals:
+		return c >= 0
+	case itemLess:
+		return c < 0
+	case itemLessEquals:
+		return c <= 0
+	}
+	return false
+}
+
+// compareInts returns -1, 0 or 1 if a is less than, equal to or greater than b.
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareUints returns -1, 0 or 1 if a is less than, equal to or greater than b.
+func compareUints(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
 }
 
 func (rt *Runtime) evalLogicalExpression(node *LogicalExprNode) (reflect.Value, errors.Error) {
@@ -1126,61 +1295,56 @@ func (rt *Runtime) evalMultiplicativeExpression(node *MultiplicativeExprNode) (r
 	if err != nil {
 		return reflect.Value{}, err
 	}
+	result, ok := multiplyNumbers(node.Operator.kind, left, right)
+	if !ok {
+		return reflect.Value{}, withOperands(node.Left.error(errors.InvalidValueReason, "a non numeric value in multiplicative expression"), node.Left, left, node.Right, right)
+	}
+	return result, nil
+}
+
+// multiplyNumbers evaluates the multiplicative operation op (*, / or %) of left and right. ok is false if left
+// is not a number.
+func multiplyNumbers(op itemKind, left, right reflect.Value) (result reflect.Value, ok bool) {
 	kind := left.Kind()
 	// if the left value is not a float and the right is, we need to promote the left value to a float before the calculation
 	// this is necessary for expressions like 4*1.23
-	needFloatPromotion := !isFloat(kind) && isFloat(right.Kind())
-	switch node.Operator.kind {
-	case itemMul:
-		if isInt(kind) {
-			if needFloatPromotion {
-				// do the promotion and calculates
-				left = reflect.ValueOf(float64(left.Int()) * right.Float())
-			} else {
-				// do not need float promotion
-				left = reflect.ValueOf(left.Int() * toInt(right))
-			}
-		} else if isFloat(kind) {
-			left = reflect.ValueOf(left.Float() * toFloat(right))
-		} else if isUint(kind) {
-			if needFloatPromotion {
-				left = reflect.ValueOf(float64(left.Uint()) * right.Float())
-			} else {
-				left = reflect.ValueOf(left.Uint() * toUint(right))
-			}
-		} else {
-			return reflect.Value{}, node.Left.error(errors.InvalidValueReason, "a non numeric value in multiplicative expression")
-		}
-	case itemDiv:
-		if isInt(kind) {
-			if needFloatPromotion {
-				left = reflect.ValueOf(float64(left.Int()) / right.Float())
-			} else {
-				left = reflect.ValueOf(left.Int() / toInt(right))
-			}
-		} else if isFloat(kind) {
-			left = reflect.ValueOf(left.Float() / toFloat(right))
-		} else if isUint(kind) {
-			if needFloatPromotion {
-				left = reflect.ValueOf(float64(left.Uint()) / right.Float())
-			} else {
-				left = reflect.ValueOf(left.Uint() / toUint(right))
-			}
-		} else {
-			return reflect.Value{}, node.Left.error(errors.InvalidValueReason, "a non numeric value in multiplicative expression")
-		}
-	case itemMod:
-		if isInt(kind) {
-			left = reflect.ValueOf(left.Int() % toInt(right))
-		} else if isFloat(kind) {
-			left = reflect.ValueOf(int64(left.Float()) % toInt(right))
-		} else if isUint(kind) {
-			left = reflect.ValueOf(left.Uint() % toUint(right))
-		} else {
-			return reflect.Value{}, node.Left.error("invalid.value", "a non numeric value in multiplicative expression")
+	needFloatPromotion := !isFloat(kind) && isFloat(right.Kind()) && op != itemMod
+	switch {
+	case isInt(kind) && needFloatPromotion:
+		return reflect.ValueOf(multiplyFloats(op, float64(left.Int()), right.Float())), true
+	case isInt(kind):
+		a, b := left.Int(), toInt(right)
+		switch op {
+		case itemMul:
+			return reflect.ValueOf(a * b), true
+		case itemDiv:
+			return reflect.ValueOf(a / b), true
+		}
+		return reflect.ValueOf(a % b), true
+	case isFloat(kind) && op == itemMod:
+		return reflect.ValueOf(int64(left.Float()) % toInt(right)), true
+	case isFloat(kind):
+		return reflect.ValueOf(multiplyFloats(op, left.Float(), toFloat(right))), true
+	case isUint(kind) && needFloatPromotion:
+		return reflect.ValueOf(multiplyFloats(op, float64(left.Uint()), right.Float())), true
+	case isUint(kind):
+		a, b := left.Uint(), toUint(right)
+		switch op {
+		case itemMul:
+			return reflect.ValueOf(a * b), true
+		case itemDiv:
+			return reflect.ValueOf(a / b), true
 		}
+		return reflect.ValueOf(a % b), true
 	}
-	return left, nil
+	return reflect.Value{}, false
+}
+
+func multiplyFloats(op itemKind, a, b float64) float64 {
+	if op == itemDiv {
+		return a / b
+	}
+	return a * b
 }
 
 func (rt *Runtime) evalAdditiveExpression(node *AdditiveExprNode) (reflect.Value, errors.Error) {
@@ -1191,30 +1355,12 @@ func (rt *Runtime) evalAdditiveExpression(node *AdditiveExprNode) (reflect.Value
 			return reflect.Value{}, err
 		}
 		if !right.IsValid() {
-			return reflect.Value{}, node.error(errors.InvalidValueReason, "right side of additive expression is invalid value")
+			return reflect.Value{}, node.error(errors.InvalidValueReason, "right side of additive expression is invalid value").WithValue(node.Right.String(), getTypeString(right))
 		}
-		kind := right.Kind()
-		// todo: optimize
-		if isInt(kind) {
-			if isAdditive {
-				return reflect.ValueOf(+right.Int()), nil
-			} else {
-				return reflect.ValueOf(-right.Int()), nil
-			}
-		} else if isUint(kind) {
-			if isAdditive {
-				return right, nil
-			} else {
-				return reflect.ValueOf(-int64(right.Uint())), nil
-			}
-		} else if isFloat(kind) {
-			if isAdditive {
-				return reflect.ValueOf(+right.Float()), nil
-			} else {
-				return reflect.ValueOf(-right.Float()), nil
-			}
+		if result, ok := signNumber(isAdditive, right); ok {
+			return result, nil
 		}
-		return reflect.Value{}, node.Left.error(errors.InvalidValueReason, fmt.Sprintf("additive expression: right side %s (%s) is not a numeric value (no left side)", node.Right, getTypeString(right)))
+		return reflect.Value{}, node.error(errors.InvalidValueReason, fmt.Sprintf("additive expression: right side %s (%s) is not a numeric value (no left side)", node.Right, getTypeString(right))).WithValue(node.Right.String(), getTypeString(right))
 	}
 
 	left, err := rt.evalPrimaryExpressionGroup(node.Left)
@@ -1226,65 +1372,100 @@ func (rt *Runtime) evalAdditiveExpression(node *AdditiveExprNode) (reflect.Value
 		return reflect.Value{}, err
 	}
 	if !left.IsValid() {
-		return reflect.Value{}, node.error(errors.InvalidValueReason, "left side of additive expression is invalid value")
+		return reflect.Value{}, withOperands(node.error(errors.InvalidValueReason, "left side of additive expression is invalid value"), node.Left, left, node.Right, right)
 	}
 	if !right.IsValid() {
-		return reflect.Value{}, node.error(errors.InvalidValueReason, "right side of additive expression is invalid value")
+		return reflect.Value{}, withOperands(node.error(errors.InvalidValueReason, "right side of additive expression is invalid value"), node.Left, left, node.Right, right)
+	}
+	if result, ok := addNumbers(isAdditive, left, right); ok {
+		return result, nil
+	}
+	kind := left.Kind()
+	if kind != reflect.String {
+		if isFloat(right.Kind()) {
+			return reflect.Value{}, withOperands(node.Left.error(errors.InvalidValueReason, fmt.Sprintf("additive expression: left side (%s (%s) needs float promotion but neither int nor uint)", node.Left, getTypeString(left))), node.Left, left, node.Right, right)
+		}
+		return reflect.Value{}, withOperands(node.Left.error(errors.InvalidValueReason, fmt.Sprintf("additive expression: left side %s (%s) is not a numeric value", node.Left, getTypeString(left))), node.Left, left, node.Right, right)
+	}
+	if !isAdditive {
+		return reflect.Value{}, withOperands(node.Right.error("not_allowed.signal", "minus signal is not allowed with strings"), node.Left, left, node.Right, right)
+	}
+	left = concat(left, right)
+	if err := rt.allocate(left, node.base()); err != nil {
+		return reflect.Value{}, err
+	}
+	return left, nil
+}
+
+// signNumber evaluates the unary + or - operator on the number v. ok is false if v is not a number.
+func signNumber(isAdditive bool, v reflect.Value) (result reflect.Value, ok bool) {
+	kind := v.Kind()
+	switch {
+	case isInt(kind) && isAdditive:
+		return reflect.ValueOf(+v.Int()), true
+	case isInt(kind):
+		return reflect.ValueOf(-v.Int()), true
+	case isUint(kind) && isAdditive:
+		return v, true
+	case isUint(kind):
+		return reflect.ValueOf(-int64(v.Uint())), true
+	case isFloat(kind) && isAdditive:
+		return reflect.ValueOf(+v.Float()), true
+	case isFloat(kind):
+		return reflect.ValueOf(-v.Float()), true
+	}
+	return reflect.Value{}, false
+}
+
+// addNumbers adds right to or subtracts it from left. ok is false if left is not a number.
+func addNumbers(isAdditive bool, left, right reflect.Value) (result reflect.Value, ok bool) {
+	sign := 1.0
+	if !isAdditive {
+		sign = -1
 	}
 	kind := left.Kind()
 	// if the left value is not a float and the right is, we need to promote the left value to a float before the calculation
 	// this is necessary for expressions like 4+1.23
-	needFloatPromotion := !isFloat(kind) && kind != reflect.String && isFloat(right.Kind())
-	if needFloatPromotion {
-		if isInt(kind) {
-			if isAdditive {
-				left = reflect.ValueOf(float64(left.Int()) + right.Float())
-			} else {
-				left = reflect.ValueOf(float64(left.Int()) - right.Float())
-			}
-		} else if isUint(kind) {
-			if isAdditive {
-				left = reflect.ValueOf(float64(left.Uint()) + right.Float())
-			} else {
-				left = reflect.ValueOf(float64(left.Uint()) - right.Float())
-			}
-		} else {
-			return reflect.Value{}, node.Left.error(errors.InvalidValueReason, fmt.Sprintf("additive expression: left side (%s (%s) needs float promotion but neither int nor uint)", node.Left, getTypeString(left)))
-		}
-	} else {
-		if isInt(kind) {
-			if isAdditive {
-				left = reflect.ValueOf(left.Int() + toInt(right))
-			} else {
-				left = reflect.ValueOf(left.Int() - toInt(right))
-			}
-		} else if isFloat(kind) {
-			if isAdditive {
-				left = reflect.ValueOf(left.Float() + toFloat(right))
-			} else {
-				left = reflect.ValueOf(left.Float() - toFloat(right))
-			}
-		} else if isUint(kind) {
-			if isAdditive {
-				left = reflect.ValueOf(left.Uint() + toUint(right))
-			} else {
-				left = reflect.ValueOf(left.Uint() - toUint(right))
-			}
-		} else if kind == reflect.String {
-			if !isAdditive {
-				return reflect.Value{}, node.Right.error("not_allowed.signal", "minus signal is not allowed with strings")
-			}
-			// converts []byte (and alias types of []byte) to string
-			if right.Kind() == reflect.Slice && right.Type().Elem().Kind() == reflect.Uint8 {
-				right = right.Convert(left.Type())
-			}
-			left = reflect.ValueOf(left.String() + fmt.Sprint(right))
-		} else {
-			return reflect.Value{}, node.Left.error(errors.InvalidValueReason, fmt.Sprintf("additive expression: left side %s (%s) is not a numeric value", node.Left, getTypeString(left)))
-		}
+	needFloatPromotion := !isFloat(kind) && isFloat(right.Kind())
+	switch {
+	case isInt(kind) && needFloatPromotion:
+		return reflect.ValueOf(float64(left.Int()) + sign*right.Float()), true
+	case isInt(kind) && isAdditive:
+		return reflect.ValueOf(left.Int() + toInt(right)), true
+	case isInt(kind):
+		return reflect.ValueOf(left.Int() - toInt(right)), true
+	case isFloat(kind):
+		return reflect.ValueOf(left.Float() + sign*toFloat(right)), true
+	case isUint(kind) && needFloatPromotion:
+		return reflect.ValueOf(float64(left.Uint()) + sign*right.Float()), true
+	case isUint(kind) && isAdditive:
+		return reflect.ValueOf(left.Uint() + toUint(right)), true
+	case isUint(kind):
+		return reflect.ValueOf(left.Uint() - toUint(right)), true
 	}
+	return reflect.Value{}, false
+}
 
-	return left, nil
+// concat appends right to the string left.
+func concat(left, right reflect.Value) reflect.Value {
+	// converts []byte (and alias types of []byte) to string
+	if right.Kind() == reflect.Slice && right.Type().Elem().Kind() == reflect.Uint8 {
+		right = right.Convert(left.Type())
+	}
+	return reflect.ValueOf(left.String() + fmt.Sprint(right))
+}
+
+// withOperands adds the types of the operands of a binary expression to err.
+func withOperands(err errors.Error, leftNode Expression, left reflect.Value, rightNode Expression, right reflect.Value) errors.Error {
+	return err.WithValue(leftNode.String(), getTypeString(left)).WithValue(rightNode.String(), getTypeString(right))
+}
+
+// withValues adds values, evaluated for another error, to err.
+func withValues(err errors.Error, values []errors.Value) errors.Error {
+	for _, v := range values {
+		err = err.WithValue(v.Expression, v.Type)
+	}
+	return err
 }
 
 func getTypeString(value reflect.Value) string {
@@ -1298,6 +1479,8 @@ func (rt *Runtime) evalBaseExpressionGroup(node Node) (reflect.Value, errors.Err
 	switch node.Type() {
 	case NodeNil:
 		return reflect.ValueOf(nil), nil
+	case nodeValue:
+		return node.(*valueNode).value, nil
 	case NodeBool:
 		if node.(*BoolNode).True {
 			return valueBoolTRUE, nil
@@ -1315,12 +1498,13 @@ func (rt *Runtime) evalBaseExpressionGroup(node Node) (reflect.Value, errors.Err
 		node := node.(*FieldNode)
 		resolved := rt.context
 		for i := 0; i < len(node.Idents); i++ {
-			field, err := resolveIndex(resolved, reflect.Value{}, node.Idents[i].name, node.Idents[i].lax)
+			field, err := rt.resolveIndex(resolved, reflect.Value{}, node.Idents[i].name, node.Idents[i].lax)
 			if err != nil {
-				return reflect.Value{}, node.error(err.Reason(), err.Message())
+				return reflect.Value{}, node.error(err.Reason(), err.Message()).WithValue(node.Idents.prefix("", i), getTypeString(resolved))
 			}
 			if !field.IsValid() {
-				return reflect.Value{}, node.error(errors.NotFoundFieldOrMethodReason, fmt.Sprintf("there is no field or method '%s' in %s (.%s)", node.Idents[i].name, getTypeString(resolved), strings.Join(node.Idents.names(), ".")))
+				return reflect.Value{}, node.error(errors.NotFoundFieldOrMethodReason, fmt.Sprintf("there is no field or method '%s' in %s (.%s)", node.Idents[i].name, getTypeString(resolved), strings.Join(node.Idents.names(), "."))).
+					WithValue(node.Idents.prefix("", i), getTypeString(resolved))
 			}
 			resolved = field
 		}
@@ -1349,18 +1533,52 @@ func (rt *Runtime) evalBaseExpressionGroup(node Node) (reflect.Value, errors.Err
 	return reflect.Value{}, node.error(errors.UnexpectedNodeTypeReason, fmt.Sprintf("unexpected node type %s in unary expression evaluating", node))
 }
 
-func (rt *Runtime) evalCallExpression(baseExpr reflect.Value, args CallArgs) (reflect.Value, errors.Error) {
-	return rt.evalPipeCallExpression(baseExpr, args, nil)
+func (rt *Runtime) evalCallExpression(callee Expression, baseExpr reflect.Value, args CallArgs) (reflect.Value, errors.Error) {
+	return rt.evalPipeCallExpression(callee, baseExpr, args, nil)
 }
 
-func (rt *Runtime) evalPipeCallExpression(baseExpr reflect.Value, args CallArgs, pipedArg *reflect.Value) (reflect.Value, errors.Error) {
+// evalPipeCallExpression calls baseExpr, the value of the expression callee.
+func (rt *Runtime) evalPipeCallExpression(callee Expression, baseExpr reflect.Value, args CallArgs, pipedArg *reflect.Value) (reflect.Value, errors.Error) {
 	if !baseExpr.IsValid() {
 		return reflect.Value{}, errors.New().
 			WithReason("invalid.value").
 			WithMessage("base of call expression is invalid value")
 	}
+	if err := rt.step(callee.base()); err != nil {
+		panic(err)
+	}
+	if p := rt.set.sandbox; p != nil {
+		if err := p.checkCallee(callee); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	var ret reflect.Value
+	var err errors.Error
+	if rt.tracer != nil {
+		ev := rt.traceEnter(TraceFunc, callee, "")
+		ret, err = rt.call(callee, baseExpr, args, pipedArg)
+		rt.traceExit(ev, err)
+	} else {
+		ret, err = rt.call(callee, baseExpr, args, pipedArg)
+	}
+	if err == nil {
+		if err := rt.allocate(ret, callee.base()); err != nil {
+			panic(err)
+		}
+	}
+	return ret, err
+}
+
+func (rt *Runtime) call(callee Expression, baseExpr reflect.Value, args CallArgs, pipedArg *reflect.Value) (reflect.Value, errors.Error) {
 	if funcType.AssignableTo(baseExpr.Type()) {
-		return baseExpr.Interface().(Func)(Arguments{runtime: rt, args: args, pipedVal: pipedArg}), nil
+		return baseExpr.Interface().(Func)(Arguments{runtime: rt, args: args, pipedVal: pipedArg, at: callee}), nil
+	}
+	if errFuncType.AssignableTo(baseExpr.Type()) {
+		ret, err := baseExpr.Interface().(ErrFunc)(Arguments{runtime: rt, args: args, pipedVal: pipedArg, at: callee})
+		if err != nil {
+			return reflect.Value{}, funcError(callee, err)
+		}
+		return ret, nil
 	}
 
 	argValues, err := rt.evaluateArgs(baseExpr.Type(), args, pipedArg)
@@ -1370,7 +1588,17 @@ func (rt *Runtime) evalPipeCallExpression(baseExpr reflect.Value, args CallArgs,
 			WithMessage(fmt.Sprintf("call expression: %v", err))
 	}
 
+	if err := rt.reserve(baseExpr, argValues, callee.base()); err != nil {
+		return reflect.Value{}, err
+	}
 	returns := baseExpr.Call(argValues)
+	// functions and methods returning (T, error) or error fail with the error
+	if last := len(returns) - 1; last >= 0 && baseExpr.Type().Out(last) == errorType {
+		if !returns[last].IsNil() {
+			return reflect.Value{}, funcError(callee, returns[last].Interface().(error))
+		}
+		returns = returns[:last]
+	}
 	if len(returns) == 0 {
 		return reflect.Value{}, nil
 	}
@@ -1378,6 +1606,19 @@ func (rt *Runtime) evalPipeCallExpression(baseExpr reflect.Value, args CallArgs,
 	return returns[0], nil
 }
 
+// funcError returns the error for err, returned by the function called by callee.
+func funcError(callee Expression, err error) errors.Error {
+	return callee.error(errors.FuncErrorReason, err.Error()).WithCause(err)
+}
+
+// positionError returns err, an error evaluating a call, positioned at at unless it has a position.
+func positionError(at *NodeBase, err errors.Error) errors.Error {
+	if err.Template() != "" {
+		return err
+	}
+	return withValues(at.error("", err.Error()), err.Values()).WithCause(err.Unwrap())
+}
+
 func (rt *Runtime) evalCommandExpression(node *CommandNode) (reflect.Value, bool, errors.Error) {
 	term, err := rt.evalPrimaryExpressionGroup(node.BaseExpr)
 	if err != nil {
@@ -1388,13 +1629,13 @@ func (rt *Runtime) evalCommandExpression(node *CommandNode) (reflect.Value, bool
 			if term.Type() == safeWriterType {
 				return reflect.Value{}, true, rt.evalSafeWriter(term, node)
 			}
-			ret, err := rt.evalCallExpression(term, node.CallArgs)
+			ret, err := rt.evalCallExpression(node.BaseExpr, term, node.CallArgs)
 			if err != nil {
-				return reflect.Value{}, false, node.BaseExpr.error("", err.Error())
+				return reflect.Value{}, false, positionError(node.BaseExpr.base(), err)
 			}
 			return ret, false, nil
 		}
-		return reflect.Value{}, false, node.Exprs[0].error("", fmt.Sprintf("command %q has arguments but is %s, not a function", node.Exprs[0], term.Type()))
+		return reflect.Value{}, false, node.Exprs[0].error("", fmt.Sprintf("command %q has arguments but is %s, not a function", node.Exprs[0], term.Type())).WithValue(node.Exprs[0].String(), getTypeString(term))
 	}
 	return term, false, nil
 }
@@ -1407,9 +1648,9 @@ func (rt *Runtime) evalChainNodeExpression(node *ChainNode) (reflect.Value, erro
 
 	for i := 0; i < len(node.Idents); i++ {
 		lax := node.Idents[i].lax
-		field, err := resolveIndex(resolved, reflect.ValueOf(node.Idents[i].name), node.Idents[i].name, lax)
+		field, err := rt.resolveIndex(resolved, reflect.ValueOf(node.Idents[i].name), node.Idents[i].name, lax)
 		if err != nil {
-			return reflect.Value{}, node.errorField(err.Reason(), err.Message(), i)
+			return reflect.Value{}, node.errorField(err.Reason(), err.Message(), i).WithValue(node.Idents.prefix(node.Node.String(), i), getTypeString(resolved))
 		}
 		if !field.IsValid() {
 			if resolved.Kind() == reflect.Map && i == len(node.Idents)-1 {
@@ -1420,7 +1661,8 @@ func (rt *Runtime) evalChainNodeExpression(node *ChainNode) (reflect.Value, erro
 				return reflect.Value{}, errors.New().
 					WithReason(errors.NotFoundFieldOrMethodReason).
 					WithMessage(fmt.Sprintf("there is no field or method '%s' in %s (%s)", node.Idents[i].name, getTypeString(resolved), node)).
-					WithColumn(node.Idents[i].col)
+					WithColumn(node.Idents[i].col).
+					WithValue(node.Idents.prefix(node.Node.String(), i), getTypeString(resolved))
 			}
 			field = reflect.ValueOf(nil)
 		}
@@ -1443,6 +1685,9 @@ func (w *escapeWriter) Write(b []byte) (int, error) {
 func (rt *Runtime) evalSafeWriter(term reflect.Value, node *CommandNode, v ...reflect.Value) errors.Error {
 	sw := &escapeWriter{rawWriter: rt.Writer, safeWriter: term.Interface().(SafeWriter)}
 	for i := 0; i < len(v); i++ {
+		if err := rt.checkPrint(v[i], node); err != nil {
+			return err
+		}
 		if _, err := fastprinter.PrintValue(sw, v[i]); err != nil {
 			return errors.New().WithReason("invalid.arguments").WithMessage(err.Error())
 		}
@@ -1452,6 +1697,9 @@ func (rt *Runtime) evalSafeWriter(term reflect.Value, node *CommandNode, v ...re
 		if err != nil {
 			return err
 		}
+		if err := rt.checkPrint(expression, node); err != nil {
+			return err
+		}
 		if _, err := fastprinter.PrintValue(sw, expression); err != nil {
 			return errors.New().WithReason("invalid.arguments").WithMessage(err.Error())
 		}
@@ -1476,9 +1724,9 @@ func (rt *Runtime) evalCommandPipeExpression(node *CommandNode, value reflect.Va
 		return reflect.Value{}, true, rt.evalSafeWriter(term, node, value)
 	}
 
-	ret, err := rt.evalPipeCallExpression(term, node.CallArgs, &value)
+	ret, err := rt.evalPipeCallExpression(node.BaseExpr, term, node.CallArgs, &value)
 	if err != nil {
-		return reflect.Value{}, false, node.BaseExpr.error("", err.Error())
+		return reflect.Value{}, false, positionError(node.BaseExpr.base(), err)
 	}
 	return ret, false, nil
 }
@@ -1854,19 +2102,7 @@ func resolveIndex(v, index reflect.Value, indexAsStr string, lax bool) (reflect.
 		key := indexAsStr
 
 		// Fast path: use the struct cache to avoid allocations.
-		cachedStructsMutex.RLock()
-		cache, ok := cachedStructsFieldIndex[typ]
-		cachedStructsMutex.RUnlock()
-		if !ok {
-			cachedStructsMutex.Lock()
-			if cache, ok = cachedStructsFieldIndex[typ]; !ok {
-				cache = make(map[string][]int)
-				buildCache(typ, cache, nil)
-				cachedStructsFieldIndex[typ] = cache
-			}
-			cachedStructsMutex.Unlock()
-		}
-		if id, ok := cache[key]; ok {
+		if id, ok := structFieldIndex(typ)[key]; ok {
 			return v.FieldByIndex(id), nil
 		}
 
@@ -1945,6 +2181,23 @@ func indexArg(index reflect.Value, cap int) (int, errors.Error) {
 	return int(x), nil
 }
 
+// structFieldIndex returns the indexes of the fields of the struct type typ by name, including promoted fields.
+func structFieldIndex(typ reflect.Type) map[string][]int {
+	cachedStructsMutex.RLock()
+	cache, ok := cachedStructsFieldIndex[typ]
+	cachedStructsMutex.RUnlock()
+	if !ok {
+		cachedStructsMutex.Lock()
+		if cache, ok = cachedStructsFieldIndex[typ]; !ok {
+			cache = make(map[string][]int)
+			buildCache(typ, cache, nil)
+			cachedStructsFieldIndex[typ] = cache
+		}
+		cachedStructsMutex.Unlock()
+	}
+	return cache
+}
+
 func buildCache(typ reflect.Type, cache map[string][]int, parent []int) {
 	numFields := typ.NumField()
 	max := len(parent) + 1
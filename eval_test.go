@@ -16,13 +16,17 @@ package jet
 
 import (
 	"bytes"
+	stderrors "errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"strconv"
 	"strings"
 	"testing"
 	"text/template"
+
+	"github.com/CloudyKit/jet/v6/errors"
 )
 
 var (
@@ -342,6 +346,15 @@ func TestEvalRangeNode(t *testing.T) {
 	RunJetTest(t, data, nil, "Range_ExpressionValueIf", `{{range i, user:=users}}<h1>{{if i == 0 || i == 2}}{{i}}: {{end}}{{user.Name}}<small>{{user.Email}}</small></h1>{{end}}`, resultString2)
 }
 
+func TestEvalRangeBreakContinue(t *testing.T) {
+	RunJetTest(t, nil, nil, "Range_Break", `{{range i := ints(0, 10)}}{{if i == 3}}{{break}}{{end}}{{i}}{{end}}`, "012")
+	RunJetTest(t, nil, nil, "Range_Continue", `{{range i := ints(0, 6)}}{{if i % 2 == 0}}{{continue}}{{end}}{{i}}{{end}}`, "135")
+	RunJetTest(t, nil, nil, "Range_BreakTry", `{{range i := ints(0, 10)}}{{try}}{{i}}{{if i == 2}}{{break}}{{end}}{{end}},{{end}}`, "0,1,2")
+	RunJetTest(t, nil, nil, "Range_BreakNested", `{{range i := ints(0, 3)}}{{range j := ints(0, 3)}}{{if j > i}}{{break}}{{end}}{{j}}{{end}};{{end}}`, "0;01;012;")
+	RunJetTest(t, nil, nil, "Range_BreakElse", `{{range ints(0, 3)}}{{break}}{{else}}empty{{end}}done`, "done")
+	RunJetTest(t, nil, nil, "Range_BreakVariable", `{{ break := 1 }}{{ break }}{{range continue := ints(0, 3)}}{{ break + continue }}{{end}}`, "1123")
+}
+
 func TestEvalDefaultFuncs(t *testing.T) {
 	RunJetTest(t, nil, nil, "DefaultFuncs_safeHtml", `<h1>{{"<h1>Hello Buddy!</h1>" |safeHtml}}</h1>`, `<h1>&lt;h1&gt;Hello Buddy!&lt;/h1&gt;</h1>`)
 	RunJetTest(t, nil, nil, "DefaultFuncs_safeHtml2", `<h1>{{safeHtml: "<h1>Hello Buddy!</h1>"}}</h1>`, `<h1>&lt;h1&gt;Hello Buddy!&lt;/h1&gt;</h1>`)
@@ -693,6 +706,71 @@ func TestTryCatchOld(t *testing.T) {
 	RunJetTestWithSet(t, set, nil, nil, `try_include`, "before broken include ...\n\nafter broken include ...")
 }
 
+type repository struct{}
+
+var errNotFound = fmt.Errorf("not found")
+
+func (repository) Find(id int) (*User, error) {
+	if id != 1 {
+		return nil, errNotFound
+	}
+	return &User{Name: "José Santos", Email: "email@example.com"}, nil
+}
+
+func (repository) Delete(id int) error {
+	if id != 1 {
+		return fmt.Errorf("deleting user %d: %w", id, errNotFound)
+	}
+	return nil
+}
+
+func TestEvalFuncErrors(t *testing.T) {
+	vars := VarMap{}.
+		Set("users", repository{}).
+		Set("fail", ErrFunc(func(a Arguments) (reflect.Value, error) {
+			if a.NumOfArguments() > 0 {
+				return reflect.Value{}, errNotFound
+			}
+			return reflect.ValueOf("ok"), nil
+		}))
+	RunJetTest(t, vars, nil, "funcErrorsNil", `{{ users.Find(1).Name }} {{ users.Delete(1) }}{{ fail() }}`, "José Santos ok")
+	RunJetTest(t, vars, nil, "funcErrorsCatch", `{{ try }}{{ users.Find(2).Name }}{{ catch err }}{{ err.Error() }}{{ end }}`, "func.error /funcErrorsCatch:1:18 not found")
+	RunJetTest(t, vars, nil, "funcErrorsPipe", `{{ try }}{{ 2 | users.Delete }}{{ catch }}failed{{ end }}`, "failed")
+
+	for _, test := range []struct{ name, content string }{
+		{"funcErrorsMethod", `<p>{{ users.Find(2).Name }}</p>`},
+		{"funcErrorsErrorOnly", `{{ users.Delete(2) }}`},
+		{"funcErrorsErrFunc", `{{ fail(1) }}`},
+	} {
+		JetTestingLoader.Set(test.name, test.content)
+		tt, err := JetTestingSet.GetTemplate(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tt.Execute(ioutil.Discard, vars, nil)
+		if !stderrors.Is(err, errNotFound) {
+			t.Errorf("%s: expected an error wrapping errNotFound, got %v", test.name, err)
+		}
+		var jetErr errors.Error
+		if !stderrors.As(err, &jetErr) || jetErr.Reason() != errors.FuncErrorReason || jetErr.Template() != "/"+test.name || jetErr.Position().L != 1 {
+			t.Errorf("%s: expected a positioned errors.Error of reason %s, got %v", test.name, errors.FuncErrorReason, err)
+		}
+	}
+}
+
+func TestTryReturnedErrors(t *testing.T) {
+	// try catches errors returned by functions, but not the other errors evaluating the body returns
+	JetTestingLoader.Set("tryInvalidValue", `{{ try }}{{ "a" * 2 }}{{ catch }}caught{{ end }}`)
+	tt, err := JetTestingSet.GetTemplate("tryInvalidValue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jetErr errors.Error
+	if err = tt.Execute(ioutil.Discard, nil, nil); !stderrors.As(err, &jetErr) || jetErr.Reason() != errors.InvalidValueReason {
+		t.Errorf("expected an error of reason %s, got %v", errors.InvalidValueReason, err)
+	}
+}
+
 func TestBuiltinCollectionFuncs(t *testing.T) {
 	RunJetTest(t, nil, nil, "map_builtin", `{{ m := map( "foo", "bar", "asd", 123)}}{{m}}`, "map[asd:123 foo:bar]")
 	RunJetTest(t, nil, nil, "slice_builtin", `{{ m := slice( "foo", "bar", "asd", 123)}}{{m}}`, "[foo bar asd 123]")
@@ -18,9 +18,7 @@
 package main
 
 import (
-	"bytes"
 	"flag"
-	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -30,6 +28,7 @@ import (
 
 	"github.com/CloudyKit/jet/v6"
 	"github.com/CloudyKit/jet/v6/examples/asset_packaging/assets/templates"
+	"github.com/CloudyKit/jet/v6/jethttp"
 	"github.com/CloudyKit/jet/v6/loaders/httpfs"
 )
 
@@ -52,22 +51,9 @@ var runAndExit = flag.Bool("run-and-exit", false, "Run app, request / and exit (
 func main() {
 	flag.Parse()
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		view, err := views.GetTemplate("index.jet")
-		if err != nil {
-			w.WriteHeader(503)
-			fmt.Fprintf(w, "Unexpected error while parsing template: %+v", err.Error())
-			return
-		}
-		var resp bytes.Buffer
-		if err = view.Execute(&resp, nil, nil); err != nil {
-			w.WriteHeader(503)
-			fmt.Fprintf(w, "Error when executing template: %+v", err.Error())
-			return
-		}
-		w.WriteHeader(200)
-		w.Write(resp.Bytes())
-	})
+	// renders errors with the development error page, remove jethttp.InDevelopmentMode() in production
+	renderer := jethttp.New(views, jethttp.InDevelopmentMode())
+	http.Handle("/", renderer.Handler("index.jet", nil))
 
 	port := os.Getenv("PORT")
 	if len(port) == 0 {
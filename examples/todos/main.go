@@ -26,6 +26,7 @@ import (
 	"strings"
 
 	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/jethttp"
 )
 
 var views = jet.NewSet(
@@ -94,34 +95,26 @@ func main() {
 		"example-todo-4": {Text: "Add an delete todo page to the example project", Done: true},
 	}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		view, err := views.GetTemplate("todos/index.jet")
-		if err != nil {
-			log.Println("Unexpected template err:", err.Error())
-		}
-		view.Execute(w, nil, todos)
-	})
+	// renders errors with the development error page, remove jethttp.InDevelopmentMode() in production
+	renderer := jethttp.New(views, jethttp.InDevelopmentMode())
+
+	http.Handle("/", renderer.Handler("todos/index.jet", func(r *http.Request) (jet.VarMap, interface{}, error) {
+		return nil, todos, nil
+	}))
 	http.HandleFunc("/todo", func(w http.ResponseWriter, r *http.Request) {
-		view, err := views.GetTemplate("todos/show.jet")
-		if err != nil {
-			log.Println("Unexpected template err:", err.Error())
-		}
 		id := r.URL.Query().Get("id")
 		todo, ok := todos[id]
 		if !ok {
 			http.Redirect(w, r, "/", http.StatusNotFound)
+			return
 		}
-		view.Execute(w, nil, todo)
+		renderer.Render(w, r, "todos/show.jet", nil, todo)
 	})
-	http.HandleFunc("/all-done", func(w http.ResponseWriter, r *http.Request) {
-		view, err := views.GetTemplate("todos/index.jet")
-		if err != nil {
-			log.Println("Unexpected template err:", err.Error())
-		}
+	http.Handle("/all-done", renderer.Handler("todos/index.jet", func(r *http.Request) (jet.VarMap, interface{}, error) {
 		vars := make(jet.VarMap)
 		vars.Set("showingAllDone", true)
-		view.Execute(w, vars, (&doneTODOs{}).New(todos))
-	})
+		return vars, (&doneTODOs{}).New(todos), nil
+	}))
 
 	port := os.Getenv("PORT")
 	if len(port) == 0 {
@@ -19,9 +19,13 @@
 package jet
 
 import (
+	"context"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"sort"
+
+	"github.com/CloudyKit/jet/v6/errors"
 )
 
 type VarMap map[string]reflect.Value
@@ -53,23 +57,177 @@ func (scope VarMap) SetWriter(name string, v SafeWriter) VarMap {
 
 // Execute executes the template into w.
 func (t *Template) Execute(w io.Writer, variables VarMap, data interface{}) (err error) {
+	return t.execute(context.Background(), w, variables, data, execOptions{})
+}
+
+// ExecuteContext executes the template into w, stopping with an error reason of errors.CancelledReason
+// when ctx is done. Cancellation is checked at every loop iteration, yield and include.
+func (t *Template) ExecuteContext(ctx context.Context, w io.Writer, variables VarMap, data interface{}) (err error) {
+	return t.execute(ctx, w, variables, data, execOptions{})
+}
+
+// ExecuteWith executes the template into w like ExecuteContext, configured by opts.
+func (t *Template) ExecuteWith(ctx context.Context, w io.Writer, variables VarMap, data interface{}, opts ...ExecOption) (err error) {
+	var o execOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return t.execute(ctx, w, variables, data, o)
+}
+
+// ExecOption configures a single execution of a template, see ExecuteWith.
+type ExecOption func(*execOptions)
+
+type execOptions struct {
+	locale    string
+	sourceMap *SourceMap
+}
+
+// ExecLocale returns an option resolving {{trans}} statements and {{msg}} blocks in locale. Without it, the
+// Translator of the Set is asked for messages with an empty locale, which it resolves on its own; a
+// MapTranslator uses the fallback locale passed to NewMapTranslator.
+func ExecLocale(locale string) ExecOption {
+	return func(o *execOptions) {
+		o.locale = locale
+	}
+}
+
+// ExecSourceMap returns an option recording in m which node of which template wrote each range of the
+// output. m holds the source map of the output written so far also when the execution fails. Output written
+// inside try statements is recorded as well; output of the exec built-in is discarded and therefore not
+// recorded.
+func ExecSourceMap(m *SourceMap) ExecOption {
+	return func(o *execOptions) {
+		o.sourceMap = m
+	}
+}
+
+func (t *Template) execute(ctx context.Context, w io.Writer, variables VarMap, data interface{}, o execOptions) (err error) {
 	st := pool_State.Get().(*Runtime)
+	defer t.decorateError(&err)
 	defer st.recover(&err)
 
+	var sourceMap *sourceMapWriter
+	if o.sourceMap != nil {
+		sourceMap = &sourceMapWriter{w: w}
+		defer func() { o.sourceMap.Segments = sourceMap.segments }()
+	}
+
 	st.blocks = t.processedBlocks
 	st.variables = variables
 	st.set = t.set
 	st.Writer = w
+	st.locale = o.locale
+	st.ctx, st.done = ctx, ctx.Done()
+	st.halt, st.iterations, st.frames, st.output = nil, 0, st.frames[:0], nil
+	st.steps, st.memory = 0, 0
+	st.loopControl, st.blockDepth = 0, 0
+	st.sourceMap = sourceMap
+	st.tracer, st.trace = t.set.tracer, nil
+	if tracer, ok := ctx.Value(tracerKey{}).(Tracer); ok {
+		st.tracer = tracer
+	}
+	if sourceMap != nil {
+		st.Writer = sourceMap
+	}
+	if max := t.set.limits.MaxOutputBytes; max > 0 {
+		st.output = &limitWriter{w: st.Writer, max: max}
+		st.Writer = st.output
+	}
+
+	if data != nil {
+		st.context = reflect.ValueOf(data)
+	}
+
+	ev := st.traceEnter(TraceTemplate, t.Root, t.Name)
 
 	// resolve extended template
 	for t.extends != nil {
 		t = t.extends
 	}
 
-	if data != nil {
-		st.context = reflect.ValueOf(data)
+	_, execErr := st.executeTemplate(t)
+	if execErr == nil {
+		execErr = st.interrupted(t.Root)
+	}
+	st.traceExit(ev, execErr)
+	if execErr != nil {
+		return execErr
+	}
+	return nil
+}
+
+// decorateError adds the extends statements of t to the stack of the runtime error *err, and the lines of
+// source around the position of the error.
+func (t *Template) decorateError(err *error) {
+	jetErr, ok := (*err).(errors.Error)
+	if !ok || jetErr.Template() == "" {
+		return
+	}
+
+	var extends []errors.Frame
+	for tt := t; tt.extends != nil; tt = tt.extends {
+		frame := errors.Frame{Kind: "extends", Name: tt.extends.Name, Template: tt.Name}
+		for _, dep := range tt.dependencies {
+			if dep.Kind == DependencyExtends {
+				frame.Position.L = dep.Line
+				break
+			}
+		}
+		extends = append(extends, frame)
+	}
+	if len(extends) > 0 {
+		stack := jetErr.Stack()
+		for i := len(extends) - 1; i >= 0; i-- {
+			stack = append(stack, extends[i])
+		}
+		jetErr.WithStack(stack)
+	}
+
+	if len(jetErr.Snippet()) == 0 && jetErr.Position().L > 0 {
+		if source, ok := t.source(jetErr.Template()); ok {
+			jetErr.WithSnippet(errors.NewSnippet(source, jetErr.Position().L, 2))
+		}
+	}
+}
+
+// source returns the text of the template at templatePath, looking in the templates t extends and imports
+// first, then in the cache and the loader of the Set.
+func (t *Template) source(templatePath string) (string, bool) {
+	tt := t.find(templatePath)
+	if tt == nil {
+		tt, _ = t.set.getTemplateFromCache(templatePath)
+	}
+	if tt != nil {
+		return tt.text, tt.compiled == nil
+	}
+
+	f, err := t.set.loader.Open(templatePath)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", false
 	}
+	return string(content), true
+}
 
-	_, err = st.executeList(t.Root)
-	return err
+// find returns the template at templatePath if it's t or a template t extends or imports.
+func (t *Template) find(templatePath string) *Template {
+	if t.Name == templatePath {
+		return t
+	}
+	if t.extends != nil {
+		if tt := t.extends.find(templatePath); tt != nil {
+			return tt
+		}
+	}
+	for _, _import := range t.imports {
+		if tt := _import.find(templatePath); tt != nil {
+			return tt
+		}
+	}
+	return nil
 }
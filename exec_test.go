@@ -3,7 +3,10 @@ package jet
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 	"testing"
+
+	"github.com/CloudyKit/jet/v6/errors"
 )
 
 func TestExecuteConcurrency(t *testing.T) {
@@ -28,3 +31,60 @@ func TestExecuteConcurrency(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteErrorStack(t *testing.T) {
+	l := NewInMemLoader()
+	l.Set("/layout.jet", "<main>\n{{ yield body() }}\n</main>")
+	l.Set("/row.jet", "<tr>\n\t<td>{{ .Admin * 2 }}</td>\n</tr>")
+	l.Set("/page.jet", `{{ extends "layout" }}
+{{ block body() }}
+{{ range users }}{{ include "row" . }}{{ end }}
+{{ end }}`)
+	set := NewSet(l)
+	tt, err := set.GetTemplate("/page.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := VarMap{}.Set("users", []struct{ Admin bool }{{Admin: true}})
+
+	err = tt.Execute(ioutil.Discard, vars, nil)
+	jetErr, ok := err.(errors.Error)
+	if !ok {
+		t.Fatalf("expected an errors.Error, got %v", err)
+	}
+
+	if p := jetErr.Position(); jetErr.Template() != "/row.jet" || p.L != 2 || p.C != 9 {
+		t.Errorf("unexpected position %s:%d:%d", jetErr.Template(), p.L, p.C)
+	}
+	var stack []string
+	for _, f := range jetErr.Stack() {
+		stack = append(stack, f.String())
+	}
+	expectedStack := []string{
+		"include /row.jet at /page.jet:3:37",
+		"yield body at /layout.jet:2:17",
+		"extends /layout.jet at /page.jet:1",
+	}
+	if got, expected := strings.Join(stack, "\n"), strings.Join(expectedStack, "\n"); got != expected {
+		t.Errorf("unexpected stack:\n%s\nexpected:\n%s", got, expected)
+	}
+	if values := fmt.Sprint(jetErr.Values()); values != "[{.Admin bool} {2 float64}]" {
+		t.Errorf("unexpected values %s", values)
+	}
+
+	text := errors.Text(jetErr, false)
+	for _, expected := range []string{
+		"invalid.value: a non numeric value in multiplicative expression\n  --> /row.jet:2:9\n",
+		" 2 | \t<td>{{ .Admin * 2 }}</td>\n   | \t       ^\n 3 | </tr>\n",
+		"  values:\n    .Admin: bool\n",
+		"  stack:\n    include /row.jet at /page.jet:3:37\n",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected %q in text:\n%s", expected, text)
+		}
+	}
+	html := errors.HTML(jetErr)
+	if !strings.Contains(html, `<mark>`) || !strings.Contains(html, "&lt;td&gt;") {
+		t.Errorf("unexpected HTML %s", html)
+	}
+}
@@ -0,0 +1,65 @@
+package jet
+
+import (
+	"fmt"
+)
+
+// flight is the load of a template from the loader. Concurrent lookups of a template that isn't cached yet
+// wait for the same flight instead of parsing the template again, like the templates it extends and
+// imports do.
+type flight struct {
+	done    chan struct{} // closed when the template is loaded
+	t       *Template
+	err     error
+	waiting *flight // flight of an extended or imported template the goroutine loading this one waits for
+}
+
+// load loads and parses the template at canonicalPath, or waits for the flight already loading it. from is
+// the flight of the template extending or importing it, if any; a cycle of extends and imports is an error.
+func (s *Set) load(from *flight, canonicalPath string, cacheAfterParsing bool) (*Template, error) {
+	s.flightMx.Lock()
+	if f, ok := s.flights[canonicalPath]; ok {
+		// waiting for a flight that waits for from, directly or through other flights, would deadlock
+		for w := f; w != nil; w = w.waiting {
+			if w == from {
+				s.flightMx.Unlock()
+				return nil, fmt.Errorf("template %s extends or imports itself", canonicalPath)
+			}
+		}
+		s.setWaiting(from, f)
+		s.flightMx.Unlock()
+		<-f.done
+		s.flightMx.Lock()
+		s.setWaiting(from, nil)
+		s.flightMx.Unlock()
+		return f.t, f.err
+	}
+
+	f := &flight{done: make(chan struct{})}
+	if s.flights == nil {
+		s.flights = map[string]*flight{}
+	}
+	s.flights[canonicalPath] = f
+	s.setWaiting(from, f)
+	s.flightMx.Unlock()
+	defer func() {
+		if f.t == nil && f.err == nil {
+			f.err = fmt.Errorf("template %s could not be loaded", canonicalPath) // parse panicked
+		}
+		s.flightMx.Lock()
+		delete(s.flights, canonicalPath)
+		s.setWaiting(from, nil)
+		s.flightMx.Unlock()
+		close(f.done)
+	}()
+
+	f.t, f.err = s.loadFromFile(f, canonicalPath, cacheAfterParsing)
+	return f.t, f.err
+}
+
+// setWaiting records that the goroutine loading from waits for f; s.flightMx must be held.
+func (s *Set) setWaiting(from, f *flight) {
+	if from != nil {
+		from.waiting = f
+	}
+}
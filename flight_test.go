@@ -0,0 +1,93 @@
+package jet
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingLoader counts the templates opened and blocks opening them until released.
+type blockingLoader struct {
+	*InMemLoader
+	opened  chan string
+	release chan struct{}
+
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func (l *blockingLoader) Open(templatePath string) (io.ReadCloser, error) {
+	l.mu.Lock()
+	l.opens[templatePath]++
+	l.mu.Unlock()
+	select {
+	case l.opened <- templatePath:
+	default:
+	}
+	<-l.release
+	return l.InMemLoader.Open(templatePath)
+}
+
+func TestLoadDeduplication(t *testing.T) {
+	l := &blockingLoader{
+		InMemLoader: NewInMemLoader(),
+		opened:      make(chan string, 1),
+		release:     make(chan struct{}),
+		opens:       map[string]int{},
+	}
+	l.Set("/base.jet", "base {{ yield body() }}")
+	l.Set("/page.jet", `{{ extends "base.jet" }}{{ block body() }}page{{ end }}`)
+	set := NewSet(l)
+
+	var wg sync.WaitGroup
+	templates := make([]*Template, 20)
+	get := func(i int, templatePath string) {
+		defer wg.Done()
+		tt, err := set.GetTemplate(templatePath)
+		if err != nil {
+			t.Error(err)
+		}
+		templates[i] = tt
+	}
+	wg.Add(1)
+	go get(0, "/page.jet")
+	<-l.opened // the first lookup loads /page.jet, the others wait for it
+	for i := 1; i < len(templates); i++ {
+		templatePath := "/page.jet"
+		if i%2 == 0 {
+			templatePath = "/base.jet"
+		}
+		wg.Add(1)
+		go get(i, templatePath)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(l.release)
+	wg.Wait()
+
+	for i, tt := range templates {
+		if i%2 == 1 && tt != templates[0] {
+			t.Errorf("expected every lookup of /page.jet to get the same template")
+			break
+		}
+	}
+	if l.opens["/page.jet"] != 1 || l.opens["/base.jet"] != 1 {
+		t.Errorf("expected every template to be loaded once, got %v", l.opens)
+	}
+}
+
+func TestLoadCycle(t *testing.T) {
+	l := NewInMemLoader()
+	l.Set("/self.jet", `{{ import "self" }}`)
+	l.Set("/a.jet", `{{ extends "b" }}`)
+	l.Set("/b.jet", `{{ extends "a" }}`)
+	set := NewSet(l)
+
+	for _, templatePath := range []string{"/self.jet", "/a.jet"} {
+		_, err := set.GetTemplate(templatePath)
+		if err == nil || !strings.Contains(err.Error(), "extends or imports itself") {
+			t.Errorf("expected a cycle error for %s, got %v", templatePath, err)
+		}
+	}
+}
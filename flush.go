@@ -0,0 +1,56 @@
+package jet
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+// Flusher is implemented by writers buffering output, like bufio.Writer. When a template executes
+// {{ flush }}, the output writer is flushed if it implements Flusher or http.Flusher.
+type Flusher interface {
+	Flush() error
+}
+
+// httpFlusher has the method set of http.Flusher.
+type httpFlusher interface {
+	Flush()
+}
+
+// WithAutoFlush returns an option function that makes templates flush the output after every block
+// rendered at the top level, i.e. not from within another block. Layouts built of blocks, like a head
+// and a body block, then send every part to the client as soon as it's rendered.
+func WithAutoFlush() Option {
+	return func(s *Set) {
+		s.autoFlush = true
+	}
+}
+
+func flushWriter(w io.Writer) error {
+	switch w := w.(type) {
+	case Flusher:
+		return w.Flush()
+	case httpFlusher:
+		w.Flush()
+	}
+	return nil
+}
+
+// flush flushes the output. Inside try statements, where the output is buffered, it does nothing.
+func (rt *Runtime) flush(node Node) errors.Error {
+	if err := flushWriter(rt.Writer); err != nil {
+		return node.error("", fmt.Sprintf("flush: %v", err))
+	}
+	return nil
+}
+
+// blockDone is called when a block finished rendering and flushes the output after top-level blocks
+// if auto-flush is enabled.
+func (rt *Runtime) blockDone(node Node, err errors.Error) errors.Error {
+	rt.blockDepth--
+	if err != nil || rt.blockDepth > 0 || !rt.set.autoFlush {
+		return err
+	}
+	return rt.flush(node)
+}
@@ -0,0 +1,81 @@
+package jet
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// flushRecorder marks every flush in the output with a '|'.
+type flushRecorder struct {
+	bytes.Buffer
+	err error
+}
+
+func (w *flushRecorder) Flush() error {
+	w.WriteByte('|')
+	return w.err
+}
+
+func TestFlush(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l)
+	l.Set("flush", "<head></head>{{ flush }}<body>{{ range ints(0, 2) }}{{ . }}{{ flush }}{{ end }}</body>")
+	l.Set("try", "{{ try }}a{{ flush }}{{ end }}b")
+	l.Set("variable", "{{ flush := 1 }}{{- flush -}}{{ flush + 1 }}")
+	l.Set("layout", "<head>{{ block head() }}{{ end }}</head>{{ block body() }}{{ end }}")
+	l.Set("page", `{{ extends "layout" }}{{ block head() }}h{{ end }}{{ block body() }}{{ block inner() }}i{{ end }}b{{ end }}`)
+
+	for name, expected := range map[string]string{
+		"flush":    "<head></head>|<body>0|1|</body>",
+		"try":      "ab",
+		"variable": "|2",
+		"page":     "<head>h</head>ib",
+	} {
+		tt, err := set.GetTemplate(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var w flushRecorder
+		if err := tt.Execute(&w, nil, nil); err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if w.String() != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, w.String())
+		}
+	}
+
+	w := flushRecorder{err: errors.New("connection closed")}
+	tt, _ := set.GetTemplate("flush")
+	if err := tt.Execute(&w, nil, nil); err == nil || !strings.Contains(err.Error(), "connection closed") {
+		t.Errorf("expected the flush error, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := tt.Execute(rec, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !rec.Flushed {
+		t.Error("expected the http.ResponseWriter to be flushed")
+	}
+}
+
+func TestAutoFlush(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l, WithAutoFlush())
+	l.Set("layout", "<head>{{ block head() }}{{ end }}</head>{{ block body() }}{{ end }}")
+	l.Set("page", `{{ extends "layout" }}{{ block head() }}h{{ end }}{{ block body() }}{{ block inner() }}i{{ end }}{{ yield inner() }}b{{ end }}`)
+
+	tt, err := set.GetTemplate("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w flushRecorder
+	if err := tt.Execute(&w, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<head>h|</head>iib|"; w.String() != expected {
+		t.Errorf("expected %q, got %q", expected, w.String())
+	}
+}
@@ -0,0 +1,357 @@
+package jet
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// FormatOptions configures Format.
+type FormatOptions struct {
+	// Reindent indents the lines of text and actions by their nesting level, see Format.
+	Reindent bool
+	// Indent is the indentation of one nesting level of if, range, block, try, msg and yield content statements
+	// with Reindent. Defaults to a tab.
+	Indent string
+	// LeftDelim and RightDelim are the delimiters of the template, see WithDelims.
+	LeftDelim, RightDelim string
+}
+
+// Format returns the template source src in canonical format:
+//   - actions are written as {{ action }}, with single spaces around binary operators, assignments and pipes,
+//     after commas and none inside parentheses and brackets;
+//   - whitespace trim markers are written as {{- and -}};
+//   - with opts.Reindent, the lines inside if, range, block, try, msg and yield content statements are
+//     indented one level deeper than the statement. Indentation beyond the nesting level, like that of nested
+//     HTML elements, is kept. Lines with nothing but spaces are emptied.
+//
+// Text and comments are kept as they are, apart from the indentation of their lines with opts.Reindent, so the
+// output of the template doesn't change otherwise. Format is idempotent. It returns an error if src can't be
+// parsed.
+func Format(src string, opts FormatOptions) (string, error) {
+	if opts.Indent == "" {
+		opts.Indent = "\t"
+	}
+	leftDelim, rightDelim := opts.LeftDelim, opts.RightDelim
+	if leftDelim == "" {
+		leftDelim = defaultLeftDelim
+	}
+	if rightDelim == "" {
+		rightDelim = defaultRightDelim
+	}
+
+	// templates are parsed on their own, as if every template they extend and import was empty
+	set := NewSet(formatLoader{}, WithDelims(leftDelim, rightDelim))
+	if _, err := set.Parse("/template.jet", src); err != nil {
+		return "", err
+	}
+
+	f := &formatter{src: src, opts: opts, leftDelim: leftDelim, rightDelim: rightDelim}
+	items := lexItems(src, leftDelim, rightDelim)
+	textStart := Pos(0)
+	for i := 0; i < len(items); i++ {
+		if items[i].kind != itemLeftDelim {
+			continue
+		}
+		j := i + 1
+		for items[j].kind != itemRightDelim {
+			j++
+		}
+		f.text(src[textStart:items[i].pos], items[i+1:j])
+		f.action(items[i], items[i+1:j], items[j])
+		textStart = items[j].pos + Pos(len(items[j].val))
+		i = j
+	}
+	f.text(src[textStart:], nil)
+
+	// make sure only spaces in actions, and the indentation of lines with opts.Reindent, changed
+	if !sameTokens(items, lexItems(f.out.String(), leftDelim, rightDelim), opts.Reindent) {
+		return "", errors.New("jet: formatting changed the template")
+	}
+	return f.out.String(), nil
+}
+
+func lexItems(src, leftDelim, rightDelim string) []item {
+	l := newLexer("", src, false)
+	l.setDelimiters(leftDelim, rightDelim)
+	l.lex()
+	return l.items
+}
+
+// sameTokens reports whether a and b hold the same text and actions. With reindented, the indentation of the
+// lines of text may differ.
+func sameTokens(a, b []item, reindented bool) bool {
+	tokens := func(items []item) (tokens []item) {
+		for _, item := range items {
+			if item.kind == itemSpace {
+				continue
+			}
+			if item.kind == itemText && reindented {
+				if item.val = unindent(item.val); item.val == "" {
+					continue
+				}
+			}
+			tokens = append(tokens, item)
+		}
+		return tokens
+	}
+	ta, tb := tokens(a), tokens(b)
+	if len(ta) != len(tb) {
+		return false
+	}
+	for i := range ta {
+		if ta[i].kind != tb[i].kind || ta[i].val != tb[i].val {
+			return false
+		}
+	}
+	return true
+}
+
+// unindent removes the indentation of the lines of text.
+func unindent(text string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimLeft(line, " \t")
+	}
+	return strings.Join(lines, "")
+}
+
+// formatLoader has an empty template at every path.
+type formatLoader struct{}
+
+func (formatLoader) Exists(string) bool { return true }
+
+func (formatLoader) Open(string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+type formatter struct {
+	src                   string
+	opts                  FormatOptions
+	leftDelim, rightDelim string
+	out                   bytes.Buffer
+	depth                 int  // nesting level of statements with a body
+	lineStart             bool // whether the output is at the start of a line
+}
+
+// text writes the text (and comments) in front of the action made of tokens, re-indenting its lines.
+func (f *formatter) text(text string, next []item) {
+	if f.out.Len() == 0 {
+		f.lineStart = true
+	}
+	for text != "" {
+		if !f.lineStart || !f.opts.Reindent {
+			i := strings.IndexByte(text, '\n') + 1
+			if i == 0 {
+				i = len(text)
+			}
+			f.out.WriteString(text[:i])
+			f.lineStart = text[i-1] == '\n'
+			text = text[i:]
+			continue
+		}
+
+		line := text
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			line = text[:i+1]
+		}
+		content := strings.TrimLeft(line, " \t")
+		if content == "" {
+			// the line continues with the action
+			if len(next) > 0 {
+				f.indent(f.depth-dedent(next), line)
+			}
+			f.lineStart = false
+			return
+		}
+		if content[0] == '\n' || content == "\r\n" {
+			f.out.WriteString(content)
+		} else {
+			f.indent(f.depth, line)
+			f.out.WriteString(content)
+			f.lineStart = content[len(content)-1] == '\n'
+		}
+		text = text[len(line):]
+	}
+	if f.lineStart && f.opts.Reindent && len(next) > 0 {
+		// the action starts the line
+		f.indent(f.depth-dedent(next), "")
+		f.lineStart = false
+	}
+}
+
+// indent writes the indentation for the nesting level depth of line, keeping any indentation beyond the level.
+func (f *formatter) indent(depth int, line string) {
+	for i := 0; i < depth; i++ {
+		f.out.WriteString(f.opts.Indent)
+	}
+	space := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	for i := 0; i < depth && strings.HasPrefix(space, f.opts.Indent); i++ {
+		space = space[len(f.opts.Indent):]
+	}
+	f.out.WriteString(space)
+}
+
+// dedent returns 1 for actions ending a nesting level or continuing the body in a lower one, like else.
+func dedent(tokens []item) int {
+	switch firstToken(tokens, 0).kind {
+	case itemEnd, itemElse, itemCatch, itemContent:
+		return 1
+	}
+	return 0
+}
+
+// firstToken returns the token of the action made of tokens after skipping n tokens, ignoring spaces.
+func firstToken(tokens []item, n int) item {
+	for _, token := range tokens {
+		if token.kind == itemSpace {
+			continue
+		}
+		if n == 0 {
+			return token
+		}
+		n--
+	}
+	return item{}
+}
+
+// opens reports whether the action made of tokens starts a body, including the else branches and the
+// content of blocks.
+func opens(tokens []item) bool {
+	switch firstToken(tokens, 0).kind {
+	case itemIf, itemRange, itemBlock, itemTry, itemMSG, itemElse, itemCatch, itemContent:
+		return true
+	case itemYield:
+		last := tokens[len(tokens)-1]
+		if last.kind == itemSpace {
+			last = tokens[len(tokens)-2]
+		}
+		return last.kind == itemContent && firstToken(tokens, 1).kind != itemContent
+	}
+	return false
+}
+
+// level is a nesting level of parentheses or brackets in an action.
+type level struct {
+	bracket   itemKind // itemLeftParen, itemLeftBrackets or itemLeftLaxBrackets; 0 for the top level
+	ternaries int      // ternary operators waiting for their colon
+}
+
+// action writes the action in canonical format.
+func (f *formatter) action(leftDelim item, tokens []item, rightDelim item) {
+	f.depth -= dedent(tokens)
+	if f.depth < 0 {
+		f.depth = 0
+	}
+
+	f.out.WriteString(f.leftDelim)
+	if strings.HasPrefix(f.src[leftDelim.pos+Pos(len(leftDelim.val)):], leftTrimMarker) {
+		f.out.WriteString("-")
+	}
+	f.out.WriteString(" ")
+
+	levels := []level{{}}
+	var previous item
+	previousUnary := false
+	for i, token := range tokens {
+		if token.kind == itemSpace {
+			continue
+		}
+		current := &levels[len(levels)-1]
+		unary := token.kind == itemNot || token.kind == itemMinus && (previous.kind == 0 || expectsOperand(previous))
+		if previous.kind != 0 {
+			spaced := tokens[i-1].kind == itemSpace
+			f.out.WriteString(space(previous, token, previousUnary, unary, spaced, *current))
+		}
+		f.out.WriteString(token.val)
+
+		switch token.kind {
+		case itemLeftParen, itemLeftBrackets, itemLeftLaxBrackets:
+			levels = append(levels, level{bracket: token.kind})
+		case itemRightParen, itemRightBrackets:
+			if len(levels) > 1 {
+				levels = levels[:len(levels)-1]
+			}
+		case itemTernary:
+			current.ternaries++
+		case itemColon:
+			if current.ternaries > 0 {
+				current.ternaries--
+			}
+		}
+		previous, previousUnary = token, unary
+	}
+
+	f.out.WriteString(" ")
+	if strings.HasSuffix(f.src[:rightDelim.pos], rightTrimMarker) {
+		f.out.WriteString("-")
+	}
+	f.out.WriteString(f.rightDelim)
+
+	if opens(tokens) {
+		f.depth++
+	}
+	f.lineStart = false
+}
+
+// expectsOperand reports whether an operand has to follow the token, making a following minus a negation.
+func expectsOperand(token item) bool {
+	switch token.kind {
+	case itemLeftParen, itemLeftBrackets, itemLeftLaxBrackets, itemComma, itemSemicolon, itemColon,
+		itemAssign, itemEquals, itemNotEquals, itemGreat, itemGreatEquals, itemLess, itemLessEquals,
+		itemAdd, itemMinus, itemMul, itemDiv, itemMod, itemTernary, itemPipe, itemAnd, itemOr, itemNot:
+		return true
+	}
+	return token.kind > itemKeyword
+}
+
+// space returns the space between the tokens a and b; spaced tells whether they were separated in the source.
+func space(a, b item, aUnary, bUnary, spaced bool, current level) string {
+	switch {
+	case a.kind == itemLeftParen || a.kind == itemLeftBrackets || a.kind == itemLeftLaxBrackets:
+		return ""
+	case b.kind == itemRightParen || b.kind == itemRightBrackets || b.kind == itemComma || b.kind == itemSemicolon ||
+		b.kind == itemLeftLaxBrackets:
+		return ""
+	case a.kind == itemComma || a.kind == itemSemicolon:
+		return " "
+	case b.kind == itemColon:
+		if current.ternaries > 0 {
+			return " "
+		}
+		return "" // prefix call or slice
+	case a.kind == itemColon:
+		if current.bracket == itemLeftBrackets || current.bracket == itemLeftLaxBrackets {
+			return "" // slice
+		}
+		return " "
+	case a.kind == itemAssign && a.val == "=" || b.kind == itemAssign && b.val == "=":
+		// named parameters are often written without spaces
+		if spaced {
+			return " "
+		}
+		return ""
+	case aUnary:
+		if a.val == "not" {
+			return " "
+		}
+		return ""
+	case isBinaryOperator(a) || isBinaryOperator(b) && !bUnary:
+		return " "
+	case spaced:
+		return " "
+	}
+	return ""
+}
+
+// isBinaryOperator reports whether the token is an operator between two operands, or a minus.
+func isBinaryOperator(token item) bool {
+	switch token.kind {
+	case itemAssign, itemEquals, itemNotEquals, itemGreat, itemGreatEquals, itemLess, itemLessEquals,
+		itemAdd, itemMinus, itemMul, itemDiv, itemMod, itemTernary, itemPipe, itemAnd, itemOr:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package jet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	for _, test := range []struct {
+		name, src, expected string
+		reindent            bool
+	}{
+		{"spaces", `{{a+b*2}}{{x:=f(1,2)}}{{ list[ 1 : 2 ] }}{{ ok?"y":"n" }}{{ s|upper|lower }}`,
+			`{{ a + b * 2 }}{{ x := f(1, 2) }}{{ list[1:2] }}{{ ok ? "y" : "n" }}{{ s | upper | lower }}`, false},
+		{"unary", `{{-x}}{{ a-1 }}{{ a - -1 }}{{ !ok||not  done }}{{ f(-a) }}`,
+			`{{ -x }}{{ a - 1 }}{{ a - -1 }}{{ !ok || not done }}{{ f(-a) }}`, false},
+		{"calls", `{{ f: a,b }}{{ u.Format( "x" ) }}{{ m?.A }}{{ m ?[ "k" ] }}{{ t[1] ? a[:2] : b }}`,
+			`{{ f: a, b }}{{ u.Format("x") }}{{ m?.A }}{{ m?["k"] }}{{ t[1] ? a[:2] : b }}`, false},
+		{"parameters", `{{ block b(a=1, c = 2) }}{{ end }}{{ trans "k" n name=v }}`,
+			`{{ block b(a=1, c = 2) }}{{ end }}{{ trans "k" n name=v }}`, false},
+		{"trim markers", "a  {{- x -}}  b{{-  y}} {{ z  -}}", "a  {{- x -}}  b{{- y }} {{ z -}}", false},
+		{"comments", "{* keep {{ this }} *}\n{{x}}{*end*}", "{* keep {{ this }} *}\n{{ x }}{*end*}", false},
+		{"text", "{{if a}}\n<ul>\n    {{range items}}\n  <li>{{.}}</li>\n    {{end}}\n\t\t\n{{end}}\n",
+			"{{ if a }}\n<ul>\n    {{ range items }}\n  <li>{{ . }}</li>\n    {{ end }}\n\t\t\n{{ end }}\n", false},
+		{"indentation", "{{ if a }}\n<ul>\n    {{ range items }}\n  <li>{{ . }}</li>\n{{ else }}\nnone\n      {{ end }}\n</ul>\n\t\t\n{{ else if b }}\nb\n{{ end }}\n",
+			"{{ if a }}\n\t<ul>\n\t    {{ range items }}\n\t\t  <li>{{ . }}</li>\n\t{{ else }}\n\t\tnone\n\t      {{ end }}\n\t</ul>\n\n{{ else if b }}\n\tb\n{{ end }}\n", true},
+		{"blocks", "{{ block page() }}\n{{ yield content }}\n{{ yield b() content }}\nc\n{{ end }}\n{{ content }}\ndefault\n{{ end }}\n{{ try }}\nx\n{{ catch err }}\ny\n{{ end }}\n{{ msg \"k\" }}\nz\n{{ end }}",
+			"{{ block page() }}\n\t{{ yield content }}\n\t{{ yield b() content }}\n\t\tc\n\t{{ end }}\n{{ content }}\n\tdefault\n{{ end }}\n{{ try }}\n\tx\n{{ catch err }}\n\ty\n{{ end }}\n{{ msg \"k\" }}\n\tz\n{{ end }}", true},
+	} {
+		opts := FormatOptions{Reindent: test.reindent}
+		out, err := Format(test.src, opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if out != test.expected {
+			t.Errorf("%s: expected\n%q\ngot\n%q", test.name, test.expected, out)
+		}
+		if again, _ := Format(out, opts); again != out {
+			t.Errorf("%s: formatting is not idempotent, got\n%q", test.name, again)
+		}
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	src := "{{if a}}\n<p>\n  {{b}}\n</p>\n{{end}}"
+	out, err := Format(src, FormatOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{{ if a }}\n<p>\n  {{ b }}\n</p>\n{{ end }}"; out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+
+	out, err = Format(src, FormatOptions{Reindent: true, Indent: "  "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{{ if a }}\n  <p>\n  {{ b }}\n  </p>\n{{ end }}"; out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+
+	out, err = Format("<%if a%><%b -%> <% end %>", FormatOptions{LeftDelim: "<%", RightDelim: "%>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<% if a %><% b -%> <% end %>"; out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	if _, err := Format("{{ if a }}", FormatOptions{}); err == nil || !strings.Contains(err.Error(), "unexpected") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
+
+func TestFormatSameTokens(t *testing.T) {
+	src := lexItems("{{ if a }}\n  <p>{{x}}</p>\n{{ end }}", "{{", "}}")
+	for _, test := range []struct {
+		out        string
+		reindented bool
+		same       bool
+	}{
+		{"{{ if a }}\n  <p>{{ x }}</p>\n{{ end }}", false, true},
+		{"{{ if a }}\n\t<p>{{ x }}</p>\n{{ end }}", false, false},
+		{"{{ if a }}\n\t<p>{{ x }}</p>\n{{ end }}", true, true},
+		{"{{ if a }}\n  <p>{{ x }}</b>\n{{ end }}", true, false},
+		{"{{ if a }}\n  <p>{{ x }}</p>{{ end }}", true, false},
+	} {
+		if same := sameTokens(src, lexItems(test.out, "{{", "}}"), test.reindented); same != test.same {
+			t.Errorf("%q (reindented: %v): expected %v, got %v", test.out, test.reindented, test.same, same)
+		}
+	}
+}
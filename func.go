@@ -26,6 +26,7 @@ type Arguments struct {
 	runtime  *Runtime
 	args     CallArgs
 	pipedVal *reflect.Value
+	at       Node // the expression calling the function
 }
 
 // IsSet checks whether an argument is set or not. It behaves like the build-in isset function.
@@ -193,3 +194,8 @@ func (a *Arguments) ParseInto(ptrs ...interface{}) errors.Error {
 // If a function is being called many times in the execution of a template, you may consider implementing
 // a wrapper for that function implementing a Func.
 type Func func(Arguments) reflect.Value
+
+// ErrFunc is a Func returning an error instead of panicking with Arguments.Panicf. A non-nil error aborts the
+// evaluation with an errors.Error of reason errors.FuncErrorReason wrapping it, which try/catch can catch.
+// Go functions and methods returning (T, error) or error fail the same way.
+type ErrFunc func(Arguments) (reflect.Value, error)
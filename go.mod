@@ -2,4 +2,7 @@ module github.com/CloudyKit/jet/v6
 
 go 1.12
 
-require github.com/CloudyKit/fastprinter v0.0.0-20200109182630-33d98a066a53
+require (
+	github.com/CloudyKit/fastprinter v0.0.0-20200109182630-33d98a066a53
+	gopkg.in/yaml.v3 v3.0.1
+)
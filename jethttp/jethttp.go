@@ -0,0 +1,246 @@
+// Package jethttp renders the templates of a jet.Set in HTTP handlers. When a template fails to parse
+// or execute, a Renderer in development mode responds with an error page showing the error with the
+// highlighted source, the template stack and a dump of the variables and the context; in production,
+// it renders a configurable error template:
+//
+//	renderer := jethttp.New(views, jethttp.InDevelopmentMode())
+//	http.Handle("/", renderer.Handler("index.jet", func(r *http.Request) (jet.VarMap, interface{}, error) {
+//		return nil, todos, nil
+//	}))
+//
+// Templates are rendered to a buffer before they are written to the response, so that an error
+// replaces the partial output.
+package jethttp
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+// Renderer renders the templates of a Set.
+type Renderer struct {
+	set           *jet.Set
+	development   bool
+	errorTemplate string
+	errorLog      *log.Logger
+}
+
+// Option configures a Renderer.
+type Option func(*Renderer)
+
+// InDevelopmentMode makes the Renderer respond to errors with the error page.
+func InDevelopmentMode() Option {
+	return func(r *Renderer) {
+		r.development = true
+	}
+}
+
+// WithErrorTemplate sets the template rendered in production when rendering fails. It's executed with
+// an *ErrorPage as context. Without it, the Renderer responds with the plain status text.
+func WithErrorTemplate(templatePath string) Option {
+	return func(r *Renderer) {
+		r.errorTemplate = templatePath
+	}
+}
+
+// WithErrorLog sets the logger errors are logged to. By default, they're logged with the standard logger.
+func WithErrorLog(l *log.Logger) Option {
+	return func(r *Renderer) {
+		r.errorLog = l
+	}
+}
+
+// New returns a Renderer rendering the templates of set.
+func New(set *jet.Set, opts ...Option) *Renderer {
+	r := &Renderer{set: set}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// ErrorPage is the context of the error template.
+type ErrorPage struct {
+	Status  int
+	Err     error
+	Request *http.Request
+}
+
+// DataFunc returns the variables and the context a Handler executes its template with.
+type DataFunc func(r *http.Request) (jet.VarMap, interface{}, error)
+
+// Handler returns a handler rendering the template at templatePath with the variables and the context
+// returned by data, which may be nil. An error returned by data is handled like a failing template.
+func (r *Renderer) Handler(templatePath string, data DataFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var vars jet.VarMap
+		var context interface{}
+		if data != nil {
+			var err error
+			if vars, context, err = data(req); err != nil {
+				r.Error(w, req, err, vars, context)
+				return
+			}
+		}
+		r.Render(w, req, templatePath, vars, context)
+	})
+}
+
+// Render renders the template at templatePath with vars and context. The response gets the status
+// http.StatusOK and, unless set, the content type "text/html; charset=utf-8".
+func (r *Renderer) Render(w http.ResponseWriter, req *http.Request, templatePath string, vars jet.VarMap, context interface{}) {
+	t, err := r.set.GetTemplate(templatePath)
+	if err != nil {
+		r.Error(w, req, err, vars, context)
+		return
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteContext(req.Context(), &buf, vars, context); err != nil {
+		r.Error(w, req, err, vars, context)
+		return
+	}
+	setContentType(w)
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+// Middleware returns a handler calling next, responding to its panics like to a failing template. Panics
+// after next started the response are only logged, as the response can't be replaced anymore.
+func (r *Renderer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			err, ok := recovered.(error)
+			if !ok {
+				err = fmt.Errorf("%v", recovered)
+			}
+			if rw.started {
+				r.logf("jethttp: %s %s: %v", req.Method, req.URL.Path, err)
+				return
+			}
+			r.Error(w, req, err, nil, nil)
+		}()
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// responseWriter records whether the response was started by writing its header or body.
+type responseWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.started = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the response if the underlying ResponseWriter is an http.Flusher.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.started = true
+		f.Flush()
+	}
+}
+
+// Error logs err and responds with the status http.StatusInternalServerError: in development mode with
+// the error page showing err and a dump of vars and context, otherwise with the error template.
+func (r *Renderer) Error(w http.ResponseWriter, req *http.Request, err error, vars jet.VarMap, context interface{}) {
+	r.logf("jethttp: %s %s: %v", req.Method, req.URL.Path, err)
+	status := http.StatusInternalServerError
+	if r.development {
+		setContentType(w)
+		w.WriteHeader(status)
+		w.Write(r.errorPage(err, vars, context))
+		return
+	}
+
+	if r.errorTemplate != "" {
+		var buf bytes.Buffer
+		t, tErr := r.set.GetTemplate(r.errorTemplate)
+		if tErr == nil {
+			tErr = t.Execute(&buf, nil, &ErrorPage{Status: status, Err: err, Request: req})
+		}
+		if tErr == nil {
+			setContentType(w)
+			w.WriteHeader(status)
+			buf.WriteTo(w)
+			return
+		}
+		r.logf("jethttp: rendering error template %s: %v", r.errorTemplate, tErr)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (r *Renderer) logf(format string, v ...interface{}) {
+	if r.errorLog != nil {
+		r.errorLog.Printf(format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
+}
+
+func setContentType(w http.ResponseWriter) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+}
+
+// errorPage returns the error page showing err and a dump of vars and context.
+func (r *Renderer) errorPage(err error, vars jet.VarMap, context interface{}) []byte {
+	var b bytes.Buffer
+	b.WriteString(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>`)
+	b.WriteString(html.EscapeString(err.Error()))
+	b.WriteString(`</title><style>` + style + `</style></head><body>`)
+	if jetErr, ok := err.(errors.Error); ok {
+		b.WriteString(errors.HTML(jetErr))
+	} else {
+		fmt.Fprintf(&b, `<div class="jet-error"><p class="jet-error-message">%s</p></div>`, html.EscapeString(err.Error()))
+	}
+	fmt.Fprintf(&b, `<h2>Variables and context</h2><pre class="jet-dump">%s</pre>`, html.EscapeString(dump(vars, context)))
+	b.WriteString(`</body></html>`)
+	return b.Bytes()
+}
+
+// dump returns vars and context in the format of the dump() built-in. It doesn't execute a template, so it
+// doesn't depend on the delimiters and the sandbox of the Set.
+func dump(vars jet.VarMap, context interface{}) string {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "Context:")
+	if context != nil {
+		fmt.Fprintf(&b, "\t%T %#v\n", context, context)
+	}
+	fmt.Fprintln(&b, "Variables:")
+	for _, name := range vars.SortedKeys() {
+		fmt.Fprintf(&b, "\t%s=%#v\n", name, vars[name])
+	}
+	return b.String()
+}
+
+const style = `body{font-family:sans-serif;margin:2em;color:#222}
+.jet-error-message{font-size:1.3em}
+.jet-error-reason{color:#b00020;margin-right:.5em}
+.jet-error-position{color:#555;font-family:monospace}
+pre{background:#f6f6f6;padding:1em;overflow:auto}
+.jet-error-current{background:#fde8e8}
+mark{background:#f8b4b4}
+.jet-error-values dt{font-family:monospace;font-weight:bold}
+.jet-error-stack{font-family:monospace}`
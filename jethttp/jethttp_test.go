@@ -0,0 +1,130 @@
+package jethttp
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+type user struct {
+	Name  string
+	Admin bool
+}
+
+func newSet() *jet.Set {
+	l := jet.NewInMemLoader()
+	l.Set("/layout.jet", "<main>\n{{ yield body() }}\n</main>")
+	l.Set("/page.jet", `{{ extends "layout" }}
+{{ block body() }}
+<p>{{ .Name }} {{ .Admin * 2 }}</p>
+{{ end }}`)
+	l.Set("/ok.jet", "<p>{{ .Name }}</p>")
+	l.Set("/broken.jet", "<p>{{ .Name </p>")
+	l.Set("/error.jet", "<h1>Error {{ .Status }}</h1>")
+	return jet.NewSet(l)
+}
+
+func serve(h http.Handler) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	return w
+}
+
+func TestRenderer(t *testing.T) {
+	quiet := log.New(ioutil.Discard, "", 0)
+	data := func(*http.Request) (jet.VarMap, interface{}, error) {
+		return jet.VarMap{}.Set("title", "Users"), &user{Name: "Ann", Admin: true}, nil
+	}
+
+	tests := []struct {
+		name        string
+		opts        []Option
+		template    string
+		status      int
+		contains    []string
+		notContains []string
+	}{
+		{"ok", nil, "/ok.jet", http.StatusOK, []string{"<p>Ann</p>"}, nil},
+		{"development", []Option{InDevelopmentMode()}, "/page.jet", http.StatusInternalServerError, []string{
+			`<strong class="jet-error-reason">invalid.value</strong>`,
+			`<p class="jet-error-position">/page.jet:3:19</p>`,
+			`<mark>.Admin</mark>`,
+			`<li><code>yield body</code> at /layout.jet:2:17</li>`,
+			`<dt><code>.Admin</code></dt><dd><code>bool</code></dd>`,
+			"title=&#34;Users&#34;",
+			"*jethttp.user",
+		}, []string{"<p>Ann"}},
+		{"parse error", []Option{InDevelopmentMode()}, "/broken.jet", http.StatusInternalServerError, []string{
+			`<p class="jet-error-position">/broken.jet:1`,
+			`<pre class="jet-error-snippet">`,
+		}, nil},
+		{"production", []Option{WithErrorTemplate("/error.jet")}, "/page.jet", http.StatusInternalServerError, []string{"<h1>Error 500</h1>"}, []string{"invalid.value"}},
+		{"production without error template", nil, "/page.jet", http.StatusInternalServerError, []string{"Internal Server Error"}, []string{"invalid.value"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := New(newSet(), append(test.opts, WithErrorLog(quiet))...)
+			w := serve(r.Handler(test.template, data))
+			if w.Code != test.status {
+				t.Errorf("expected status %d, got %d", test.status, w.Code)
+			}
+			body := w.Body.String()
+			for _, s := range test.contains {
+				if !strings.Contains(body, s) {
+					t.Errorf("expected %q in the response:\n%s", s, body)
+				}
+			}
+			for _, s := range test.notContains {
+				if strings.Contains(body, s) {
+					t.Errorf("unexpected %q in the response:\n%s", s, body)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := New(newSet(), InDevelopmentMode(), WithErrorLog(log.New(ioutil.Discard, "", 0)))
+	w := serve(r.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("something failed")
+	})))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "something failed") {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMiddlewareStartedResponse(t *testing.T) {
+	var logged bytes.Buffer
+	r := New(newSet(), InDevelopmentMode(), WithErrorLog(log.New(&logged, "", 0)))
+	w := serve(r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		panic("something failed")
+	})))
+	if w.Code != http.StatusAccepted || w.Body.String() != "partial" {
+		t.Errorf("expected the started response to be kept, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logged.String(), "something failed") {
+		t.Errorf("expected the panic to be logged, got %q", logged.String())
+	}
+}
+
+func TestErrorPageDump(t *testing.T) {
+	set := jet.NewSet(jet.NewInMemLoader(), jet.WithDelims("[[", "]]"), jet.WithSandbox(jet.Sandbox{}))
+	r := New(set, InDevelopmentMode(), WithErrorLog(log.New(ioutil.Discard, "", 0)))
+	w := httptest.NewRecorder()
+	r.Error(w, httptest.NewRequest("GET", "/", nil), errors.New("failed"), jet.VarMap{}.Set("title", "Users"), &user{Name: "Ann"})
+	body := w.Body.String()
+	for _, s := range []string{"title=&#34;Users&#34;", "*jethttp.user", "Ann"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("expected %q in the response:\n%s", s, body)
+		}
+	}
+}
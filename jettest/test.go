@@ -55,3 +55,16 @@ func RunWithTemplate(t *testing.T, tt *jet.Template, variables jet.VarMap, conte
 		t.Fail()
 	}
 }
+
+// Check checks the template at templatePath with set.Check and reports every problem found as a test error.
+func Check(t *testing.T, set *jet.Set, templatePath string, env jet.TypeEnv) {
+	t.Helper()
+	err := set.Check(templatePath, env)
+	if errs, ok := err.(jet.CheckErrors); ok {
+		for _, err := range errs {
+			t.Error(err)
+		}
+	} else if err != nil {
+		t.Errorf("Error checking template %s: %v", templatePath, err)
+	}
+}
@@ -89,6 +89,9 @@ const (
 	itemLeftLaxBrackets
 	itemRightBrackets
 	itemUnderscore
+	itemComment      // comment, only kept for the concrete syntax of templates
+	itemTrimMarker   // whitespace trim marker of a delimiter, only kept for the concrete syntax
+	itemTrimmedSpace // space removed by a trim marker, only kept for the concrete syntax
 	// Keywords appear after all the rest.
 	itemKeyword // used only to delimit the keywords
 	itemExtends
@@ -104,6 +107,9 @@ const (
 	itemTry
 	itemCatch
 	itemReturn
+	itemBreak
+	itemContinue
+	itemFlush
 	itemAnd
 	itemOr
 	itemNot
@@ -142,6 +148,14 @@ var key = map[string]itemKind{
 	"trans": itemTrans,
 }
 
+// statements are the keywords that are only keywords when they are the whole action, like {{ break }}, and
+// identifiers elsewhere, so that templates using variables of these names keep working.
+var statements = map[string]itemKind{
+	"break":    itemBreak,
+	"continue": itemContinue,
+	"flush":    itemFlush,
+}
+
 const eof = -1
 
 const (
@@ -173,6 +187,7 @@ type lexer struct {
 	leftDelim      string
 	rightDelim     string
 	trimRightDelim string
+	trivia         bool // whether to emit comments, trim markers and trimmed space, see skip
 }
 
 func (l *lexer) setDelimiters(leftDelim, rightDelim string) {
@@ -181,6 +196,7 @@ func (l *lexer) setDelimiters(leftDelim, rightDelim string) {
 	}
 	if rightDelim != "" {
 		l.rightDelim = rightDelim
+		l.trimRightDelim = rightTrimMarker + rightDelim
 	}
 }
 
@@ -215,8 +231,12 @@ func (l *lexer) emit(t itemKind) {
 	l.start = l.pos
 }
 
-// ignore skips over the pending input before this point.
-func (l *lexer) ignore() {
+// skip skips over the pending input before this point. When the lexer keeps trivia, the input is emitted
+// as an item of kind t, which the parser never sees.
+func (l *lexer) skip(t itemKind) {
+	if l.trivia && l.pos > l.start {
+		l.items = append(l.items, item{kind: t, pos: l.start, val: l.input[l.start:l.pos], row: l.rowNumber(), col: l.colNumber(), len: int(l.pos - l.start)})
+	}
 	l.start = l.pos
 }
 
@@ -261,10 +281,16 @@ func (l *lexer) errorf(format string, args ...interface{}) stateFn {
 // nextItem returns the next item from the input.
 // Called by the parser, not in the lexing goroutine.
 func (l *lexer) nextItem() item {
-	item := l.items[l.curItem]
-	l.curItem++
-	l.lastPos = item.pos
-	return item
+	for {
+		item := l.items[l.curItem]
+		l.curItem++
+		switch item.kind {
+		case itemComment, itemTrimMarker, itemTrimmedSpace:
+			continue
+		}
+		l.lastPos = item.pos
+		return item
+	}
 }
 
 // drain drains the output so the lexing goroutine will exit.
@@ -323,7 +349,7 @@ func lexText(l *lexer) stateFn {
 					l.emit(itemText)
 				}
 				l.pos += trimLength
-				l.ignore()
+				l.skip(itemTrimmedSpace)
 				return lexLeftDelim
 			}
 			if strings.HasPrefix(l.input[l.pos:], leftComment) {
@@ -351,7 +377,7 @@ func lexLeftDelim(l *lexer) stateFn {
 	trimSpace := strings.HasPrefix(l.input[l.pos:], leftTrimMarker)
 	if trimSpace {
 		l.pos += trimMarkerLen
-		l.ignore()
+		l.skip(itemTrimMarker)
 	}
 	l.parenDepth = 0
 	return lexInsideAction
@@ -365,7 +391,7 @@ func lexComment(l *lexer) stateFn {
 		return l.errorf("unclosed comment")
 	}
 	l.pos += Pos(i + len(rightComment))
-	l.ignore()
+	l.skip(itemComment)
 	return lexText
 }
 
@@ -374,13 +400,13 @@ func lexRightDelim(l *lexer) stateFn {
 	trimSpace := strings.HasPrefix(l.input[l.pos:], rightTrimMarker)
 	if trimSpace {
 		l.pos += trimMarkerLen
-		l.ignore()
+		l.skip(itemTrimMarker)
 	}
 	l.pos += Pos(len(l.rightDelim))
 	l.emit(itemRightDelim)
 	if trimSpace {
 		l.pos += leftTrimLength(l.input[l.pos:])
-		l.ignore()
+		l.skip(itemTrimmedSpace)
 	}
 	return lexText
 }
@@ -592,6 +618,8 @@ Loop:
 			switch {
 			case key[word] > itemKeyword:
 				l.emit(key[word])
+			case statements[word] > itemKeyword && l.atWholeAction():
+				l.emit(statements[word])
 			case word[0] == '.':
 				l.emit(itemField)
 			case word == "true", word == "false":
@@ -790,6 +818,24 @@ func leftTrimLength(s string) Pos {
 	return Pos(len(s) - len(strings.TrimLeftFunc(s, isSpace)))
 }
 
+// atWholeAction reports whether the pending input is all there is between the delimiters of the action,
+// apart from spaces and trim markers.
+func (l *lexer) atWholeAction() bool {
+	for i := len(l.items) - 1; i >= 0; i-- {
+		switch l.items[i].kind {
+		case itemSpace, itemTrimMarker:
+			continue
+		case itemLeftDelim:
+			rest := l.input[l.pos:]
+			trimmed := strings.TrimLeft(rest, " \t\r\n")
+			return strings.HasPrefix(trimmed, l.rightDelim) ||
+				len(trimmed) < len(rest) && strings.HasPrefix(trimmed, rightTrimMarker[1:]+l.rightDelim)
+		}
+		return false
+	}
+	return false
+}
+
 // atRightDelim reports whether the lexer is at a right delimiter, possibly preceded by a trim marker.
 func (l *lexer) atRightDelim() (delim, trimSpaces bool) {
 	if strings.HasPrefix(l.input[l.pos:], l.trimRightDelim) { // With trim marker.
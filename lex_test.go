@@ -88,6 +88,8 @@ func TestCustomDelimiters(t *testing.T) {
 	lexerTestCaseCustomDelimiters(t, "[[", "]]", `[[.Ex!1]]`, itemLeftDelim, itemField, itemNot, itemNumber, itemRightDelim)
 	lexerTestCaseCustomDelimiters(t, "[[", "]]", `[[.Ex==1]]`, itemLeftDelim, itemField, itemEquals, itemNumber, itemRightDelim)
 	lexerTestCaseCustomDelimiters(t, "[[", "]]", `[[.Ex&&1]]`, itemLeftDelim, itemField, itemAnd, itemNumber, itemRightDelim)
+	lexerTestCaseCustomDelimiters(t, "[[", "]]", ` [[- line -]] `, itemLeftDelim, itemIdentifier, itemRightDelim)
+	lexerTestCaseCustomDelimiters(t, "[[", "]]", `[[ a - -1 -]]`, itemLeftDelim, itemIdentifier, itemMinus, itemNumber, itemRightDelim)
 }
 
 func TestLexNegatives(t *testing.T) {
@@ -99,6 +101,17 @@ func TestLexNegatives(t *testing.T) {
 	lexerTestCase(t, `{{ 5 == -1000 }}`, itemLeftDelim, itemNumber, itemEquals, itemNumber, itemRightDelim)
 }
 
+func TestLexStatements(t *testing.T) {
+	lexerTestCase(t, `{{break}}`, itemLeftDelim, itemBreak, itemRightDelim)
+	lexerTestCase(t, `{{- continue -}}`, itemLeftDelim, itemContinue, itemRightDelim)
+	lexerTestCase(t, `{{ break := 1 }}`, itemLeftDelim, itemIdentifier, itemAssign, itemNumber, itemRightDelim)
+	lexerTestCase(t, `{{ continue + 1 }}`, itemLeftDelim, itemIdentifier, itemAdd, itemNumber, itemRightDelim)
+	lexerTestCase(t, `{{ f(break) }}`, itemLeftDelim, itemIdentifier, itemLeftParen, itemIdentifier, itemRightParen, itemRightDelim)
+	lexerTestCase(t, `{{ flush }}`, itemLeftDelim, itemFlush, itemRightDelim)
+	lexerTestCase(t, `{{ flush(w) }}`, itemLeftDelim, itemIdentifier, itemLeftParen, itemIdentifier, itemRightParen, itemRightDelim)
+	lexerTestCaseCustomDelimiters(t, "[[", "]]", `[[ break -]]`, itemLeftDelim, itemBreak, itemRightDelim)
+}
+
 func TestLexer_Bug35(t *testing.T) {
 	lexerTestCase(t, `{{if x>y}}blahblah...{{end}}`, itemLeftDelim, itemIf, itemIdentifier, itemGreat, itemIdentifier, itemRightDelim, itemText, itemLeftDelim, itemEnd, itemRightDelim)
 	lexerTestCaseCustomDelimiters(t, "[[", "]]", `[[if x>y]]blahblah...[[end]]`, itemLeftDelim, itemIf, itemIdentifier, itemGreat, itemIdentifier, itemRightDelim, itemText, itemLeftDelim, itemEnd, itemRightDelim)
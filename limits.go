@@ -0,0 +1,251 @@
+package jet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+// Limits restricts the resources a single template execution may use. A zero value means no limit.
+type Limits struct {
+	// MaxIterations is the maximum number of range loop iterations, counted across all loops of the execution.
+	MaxIterations int64
+	// MaxDepth is the maximum nesting depth of yielded blocks, includes and exec() calls.
+	MaxDepth int
+	// MaxOutputBytes is the maximum number of bytes written to the output.
+	MaxOutputBytes int64
+	// MaxSteps is the maximum number of statements executed and functions called, a measure of the CPU time used.
+	MaxSteps int64
+	// MaxMemoryBytes is the maximum number of bytes of the strings, slices and maps created by the execution,
+	// as estimated from the values returned by functions and string concatenations. The estimate is
+	// checked after a function returned, so it can't stop a single function from allocating more, except
+	// for the built-ins repeat, replace and split, whose results are estimated from their arguments before
+	// they're called.
+	MaxMemoryBytes int64
+}
+
+// WithLimits returns an option function that sets the limits that apply to every execution
+// of templates of the Set. By default, executions are unlimited. Limits given more than once,
+// with WithLimits or with the Limits of WithSandbox, are merged, keeping the stricter value
+// of every limit regardless of the order of the options.
+func WithLimits(l Limits) Option {
+	return func(s *Set) {
+		s.limits = s.limits.merge(l)
+	}
+}
+
+// merge returns the stricter of the limits l and o, limit by limit, where zero means no limit.
+func (l Limits) merge(o Limits) Limits {
+	return Limits{
+		MaxIterations:  stricterLimit(l.MaxIterations, o.MaxIterations),
+		MaxDepth:       int(stricterLimit(int64(l.MaxDepth), int64(o.MaxDepth))),
+		MaxOutputBytes: stricterLimit(l.MaxOutputBytes, o.MaxOutputBytes),
+		MaxSteps:       stricterLimit(l.MaxSteps, o.MaxSteps),
+		MaxMemoryBytes: stricterLimit(l.MaxMemoryBytes, o.MaxMemoryBytes),
+	}
+}
+
+func stricterLimit(a, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// limitWriter stops writing when the maximum number of bytes was written. Instead of failing, it
+// discards everything beyond the limit and flags the execution, which is then stopped by the runtime.
+type limitWriter struct {
+	w        io.Writer
+	n        int64
+	max      int64
+	exceeded bool
+}
+
+func (w *limitWriter) Write(b []byte) (int, error) {
+	if w.exceeded {
+		return len(b), nil
+	}
+	p := b
+	if w.n+int64(len(p)) > w.max {
+		w.exceeded = true
+		p = p[:w.max-w.n]
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return len(b), nil
+}
+
+// Flush flushes the underlying writer, so that {{ flush }} works with limited output.
+func (w *limitWriter) Flush() error {
+	return flushWriter(w.w)
+}
+
+// Ctx returns the context.Context of the current execution.
+// It's context.Background() for executions not started with ExecuteContext().
+func (rt *Runtime) Ctx() context.Context {
+	return rt.ctx
+}
+
+// interrupted reports an error if the execution was cancelled or exceeded the output limit.
+// Once interrupted, every later call returns the same error.
+func (rt *Runtime) interrupted(node Node) errors.Error {
+	if rt.halt != nil {
+		return rt.halt
+	}
+	if rt.output != nil && rt.output.exceeded {
+		rt.halt = node.error(errors.OutputLimitReason, fmt.Sprintf("output exceeds the limit of %d bytes", rt.output.max))
+		return rt.halt
+	}
+	if rt.done != nil {
+		select {
+		case <-rt.done:
+			rt.halt = node.error(errors.CancelledReason, fmt.Sprintf("execution cancelled: %v", rt.ctx.Err()))
+		default:
+		}
+	}
+	return rt.halt
+}
+
+// iterate counts a range loop iteration.
+func (rt *Runtime) iterate(node Node) errors.Error {
+	if err := rt.interrupted(node); err != nil {
+		return err
+	}
+	rt.iterations++
+	if max := rt.set.limits.MaxIterations; max > 0 && rt.iterations > max {
+		rt.halt = node.error(errors.IterationLimitReason, fmt.Sprintf("execution exceeds the limit of %d loop iterations", max))
+	}
+	return rt.halt
+}
+
+// frame is a statement yielding a block or including a template, see errors.Frame.
+type frame struct {
+	kind string
+	name string
+	at   *NodeBase
+}
+
+// enter pushes a frame when node yields the block or includes the template name, increasing the nesting
+// depth; leave has to be called when done.
+func (rt *Runtime) enter(node Node, kind, name string) errors.Error {
+	if err := rt.interrupted(node); err != nil {
+		return err
+	}
+	rt.frames = append(rt.frames, frame{kind: kind, name: name, at: node.base()})
+	if max := rt.set.limits.MaxDepth; max > 0 && len(rt.frames) > max {
+		rt.halt = node.error(errors.DepthLimitReason, fmt.Sprintf("execution exceeds the maximum depth of %d nested yields and includes", max))
+		rt.leave(rt.halt)
+	}
+	return rt.halt
+}
+
+// leave pops the frame pushed last. An error leaving the frame gets the stack of frames, unless it has one.
+func (rt *Runtime) leave(err error) {
+	if err != nil {
+		rt.stackError(err)
+	}
+	rt.frames = rt.frames[:len(rt.frames)-1]
+}
+
+// unwindFrames leaves the frames entered after the first n, when recovering from the panic recovered.
+func (rt *Runtime) unwindFrames(n int, recovered interface{}) {
+	rt.stackError(recovered)
+	rt.frames = rt.frames[:n]
+}
+
+// stackError sets the stack of err to the frames entered, unless it has one or no template position.
+func (rt *Runtime) stackError(err interface{}) {
+	jetErr, ok := err.(errors.Error)
+	if !ok || jetErr.Template() == "" || len(jetErr.Stack()) > 0 || len(rt.frames) == 0 {
+		return
+	}
+	stack := make([]errors.Frame, len(rt.frames))
+	for i, f := range rt.frames {
+		stack[len(stack)-1-i] = errors.Frame{
+			Kind:     f.kind,
+			Name:     f.name,
+			Template: f.at.TemplatePath,
+			Position: errors.Position{L: f.at.Line, C: f.at.Item.col},
+		}
+	}
+	jetErr.WithStack(stack)
+}
+
+// step counts a statement executed or a function called at the position at.
+func (rt *Runtime) step(at *NodeBase) errors.Error {
+	rt.steps++
+	if max := rt.set.limits.MaxSteps; max > 0 && rt.steps > max && rt.halt == nil {
+		rt.halt = at.error(errors.StepLimitReason, fmt.Sprintf("execution exceeds the limit of %d steps", max))
+	}
+	return rt.halt
+}
+
+// allocate counts the memory of v, a value created by the execution at the position at.
+func (rt *Runtime) allocate(v reflect.Value, at *NodeBase) errors.Error {
+	max := rt.set.limits.MaxMemoryBytes
+	if max <= 0 {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		rt.memory += int64(v.Len())
+	case reflect.Slice:
+		rt.memory += int64(v.Len()) * int64(v.Type().Elem().Size())
+	case reflect.Map:
+		rt.memory += int64(v.Len()) * int64(v.Type().Key().Size()+v.Type().Elem().Size())
+	}
+	if rt.memory > max && rt.halt == nil {
+		rt.halt = at.error(errors.MemoryLimitReason, fmt.Sprintf("execution exceeds the limit of %d bytes of memory", max))
+	}
+	return rt.halt
+}
+
+// code pointers of the built-ins whose results reserve estimates
+var (
+	repeatFunc  = reflect.ValueOf(strings.Repeat).Pointer()
+	replaceFunc = reflect.ValueOf(strings.Replace).Pointer()
+	splitFunc   = reflect.ValueOf(strings.Split).Pointer()
+)
+
+// reserve checks the memory of the result of calling fn with args at the position at before the call, for
+// the built-ins repeat, replace and split, so that a single call can't allocate more than the limit.
+func (rt *Runtime) reserve(fn reflect.Value, args []reflect.Value, at *NodeBase) errors.Error {
+	max := rt.set.limits.MaxMemoryBytes
+	if max <= 0 || len(args) != fn.Type().NumIn() || fn.Type().IsVariadic() {
+		return nil
+	}
+	var size int64
+	switch fn.Pointer() {
+	case repeatFunc:
+		s, count := args[0].String(), args[1].Int()
+		if count > 0 && len(s) > 0 {
+			if count > max/int64(len(s)) {
+				size = max + 1
+			} else {
+				size = int64(len(s)) * count
+			}
+		}
+	case replaceFunc:
+		s, old, with, n := args[0].String(), args[1].String(), args[2].String(), args[3].Int()
+		count := int64(strings.Count(s, old))
+		if n >= 0 && n < count {
+			count = n
+		}
+		size = int64(len(s)) + count*int64(len(with)-len(old))
+	case splitFunc:
+		size = int64(strings.Count(args[0].String(), args[1].String())+1) * int64(reflect.TypeOf("").Size())
+	default:
+		return nil
+	}
+	if rt.memory+size > max && rt.halt == nil {
+		rt.halt = at.error(errors.MemoryLimitReason, fmt.Sprintf("execution exceeds the limit of %d bytes of memory", max))
+	}
+	return rt.halt
+}
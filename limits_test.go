@@ -0,0 +1,106 @@
+package jet
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+func expectExecutionError(t *testing.T, tt *Template, ctx context.Context, vars VarMap, reason errors.Reason, line int) {
+	t.Helper()
+	var buf bytes.Buffer
+	err := tt.ExecuteContext(ctx, &buf, vars, nil)
+	if err == nil {
+		t.Errorf("%s: expected an error with reason %s", tt.Name, reason)
+		return
+	}
+	jetErr, ok := err.(errors.Error)
+	if !ok || jetErr.Reason() != reason || jetErr.Position().L != line {
+		t.Errorf("%s: expected an error with reason %s at line %d, got %v", tt.Name, reason, line, err)
+	}
+}
+
+func TestExecuteContextCancel(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l)
+	l.Set("range", "{{ range ints(0, 1000) }}\n{{ . }}{{ end }}")
+	l.Set("chan", "\n{{ range ch }}{{ . }}{{ end }}")
+	l.Set("recursion", "{{ block loop() }}\n{{ yield loop() }}{{ end }}")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tt, _ := set.GetTemplate("range")
+	expectExecutionError(t, tt, ctx, nil, errors.CancelledReason, 1)
+	tt, _ = set.GetTemplate("recursion")
+	expectExecutionError(t, tt, ctx, nil, errors.CancelledReason, 2)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	tt, _ = set.GetTemplate("chan")
+	expectExecutionError(t, tt, ctx, VarMap{}.Set("ch", make(chan int)), errors.CancelledReason, 2)
+
+	tt, _ = set.GetTemplate("range")
+	if err := tt.ExecuteContext(context.Background(), new(bytes.Buffer), nil, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l, WithLimits(Limits{MaxIterations: 10, MaxDepth: 5, MaxOutputBytes: 20}))
+	l.Set("iterations", "{{ range ints(0, 5) }}{{ end }}\n{{ range ints(0, 10) }}{{ end }}")
+	l.Set("depth", "{{ block loop(n=10) }}{{ if n > 0 }}\n{{ yield loop(n=n-1) }}{{ end }}{{ end }}")
+	l.Set("shallow", "{{ block loop(n=3) }}{{ if n > 0 }}{{ n }}{{ yield loop(n=n-1) }}{{ end }}{{ end }}")
+	l.Set("include", "{{ include \"/include\" }}")
+	l.Set("output", "{{ range ints(0, 5) }}\n{{ \"12345\" }}{{ end }}")
+	l.Set("try", "{{ try }}{{ range ints(0, 50) }}{{ end }}{{ catch }}caught{{ end }}")
+	l.Set("ok", "{{ range ints(0, 10) }}{{ . }}{{ end }}")
+
+	tt, _ := set.GetTemplate("iterations")
+	expectExecutionError(t, tt, context.Background(), nil, errors.IterationLimitReason, 2)
+	tt, _ = set.GetTemplate("depth")
+	expectExecutionError(t, tt, context.Background(), nil, errors.DepthLimitReason, 2)
+	tt, _ = set.GetTemplate("include")
+	expectExecutionError(t, tt, context.Background(), nil, errors.DepthLimitReason, 1)
+	tt, _ = set.GetTemplate("output")
+	expectExecutionError(t, tt, context.Background(), nil, errors.OutputLimitReason, 2)
+	tt, _ = set.GetTemplate("try")
+	expectExecutionError(t, tt, context.Background(), nil, errors.IterationLimitReason, 1)
+
+	RunJetTestWithSet(t, set, nil, nil, "ok", "0123456789")
+	RunJetTestWithSet(t, set, nil, nil, "shallow", "321")
+}
+
+func TestMemoryLimitBeforeCall(t *testing.T) {
+	l := NewInMemLoader()
+	set := NewSet(l, WithLimits(Limits{MaxMemoryBytes: 1 << 20}))
+	l.Set("repeat", "\n{{ repeat(\"x\", 300000000) }}")
+	l.Set("overflow", "\n{{ repeat(\"xx\", 4611686018427387904) }}")
+	l.Set("replace", "{{ s := repeat(\"x\", 1000) }}\n{{ replace(s, \"x\", repeat(\"y\", 2000), -1) }}")
+	l.Set("split", "{{ s := repeat(\",\", 100000) }}\n{{ len(split(s, \",\")) }}")
+	l.Set("ok", "{{ len(repeat(\"x\", 1000)) }} {{ replace(\"aaa\", \"a\", \"bb\", 2) }} {{ len(split(\"a,b\", \",\")) }}")
+
+	for _, name := range []string{"repeat", "overflow", "replace", "split"} {
+		tt, _ := set.GetTemplate(name)
+		expectExecutionError(t, tt, context.Background(), nil, errors.MemoryLimitReason, 2)
+	}
+	RunJetTestWithSet(t, set, nil, nil, "ok", "1000 bbbba 2")
+}
+
+func TestMergedLimits(t *testing.T) {
+	limits := Limits{MaxIterations: 10, MaxSteps: 1000}
+	sandbox := Sandbox{Funcs: SafeBuiltins, Limits: Limits{MaxIterations: 100, MaxDepth: 5}}
+	expected := Limits{MaxIterations: 10, MaxDepth: 5, MaxSteps: 1000}
+	for _, set := range []*Set{
+		NewSet(NewInMemLoader(), WithLimits(limits), WithSandbox(sandbox)),
+		NewSet(NewInMemLoader(), WithSandbox(sandbox), WithLimits(limits)),
+	} {
+		if set.limits != expected {
+			t.Errorf("expected limits %+v, got %+v", expected, set.limits)
+		}
+	}
+}
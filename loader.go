@@ -23,6 +23,7 @@ import (
 	"path"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 )
 
 // Loader is a minimal interface required for loading templates.
@@ -83,22 +84,39 @@ func (l *OSFileSystemLoader) Open(templatePath string) (io.ReadCloser, error) {
 	return os.Open(filepath.Join(l.dir, filepath.FromSlash(templatePath)))
 }
 
+// VersionedLoader is a Loader keeping track of changes to its templates. Before looking up a template, a Set
+// using it invalidates the templates changed since its last lookup, see Set.Invalidate.
+type VersionedLoader interface {
+	Loader
+
+	// Version returns a number increased by every change to a template.
+	Version() uint64
+
+	// ChangedSince returns the paths of the templates changed, added or removed after version.
+	ChangedSince(version uint64) []string
+}
+
 // InMemLoader is a simple in-memory loader storing template contents in a simple map.
 // InMemLoader normalizes paths passed to its methods by converting any input path to a slash-delimited path,
 // turning it into an absolute path by prepending a "/" if neccessary, and cleaning it (see path.Clean()).
 // It is safe for concurrent use.
+//
+// InMemLoader is a VersionedLoader: Sets using it drop cached templates when they're set again or deleted.
 type InMemLoader struct {
-	lock  sync.RWMutex
-	files map[string][]byte
+	version uint64 // first for 64-bit alignment
+	lock    sync.RWMutex
+	files   map[string][]byte
+	changed map[string]uint64 // version of the last change by template path
 }
 
-// compile time check that we implement Loader
-var _ Loader = (*InMemLoader)(nil)
+// compile time check that we implement VersionedLoader
+var _ VersionedLoader = (*InMemLoader)(nil)
 
 // NewInMemLoader return a new InMemLoader.
 func NewInMemLoader() *InMemLoader {
 	return &InMemLoader{
-		files: map[string][]byte{},
+		files:   map[string][]byte{},
+		changed: map[string]uint64{},
 	}
 }
 
@@ -135,6 +153,7 @@ func (l *InMemLoader) Set(templatePath, contents string) {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 	l.files[templatePath] = []byte(contents)
+	l.change(templatePath)
 }
 
 // Delete removes whatever contents are stored under the given path.
@@ -142,5 +161,32 @@ func (l *InMemLoader) Delete(templatePath string) {
 	templatePath = l.normalize(templatePath)
 	l.lock.Lock()
 	defer l.lock.Unlock()
-	delete(l.files, templatePath)
+	if _, ok := l.files[templatePath]; ok {
+		delete(l.files, templatePath)
+		l.change(templatePath)
+	}
+}
+
+// change records a change to the template at templatePath; l.lock must be held.
+func (l *InMemLoader) change(templatePath string) {
+	version := atomic.AddUint64(&l.version, 1)
+	l.changed[templatePath] = version
+}
+
+// Version returns a number increased by every call of Set and Delete.
+func (l *InMemLoader) Version() uint64 {
+	return atomic.LoadUint64(&l.version)
+}
+
+// ChangedSince returns the paths of the templates set or deleted after version.
+func (l *InMemLoader) ChangedSince(version uint64) []string {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	var changed []string
+	for templatePath, v := range l.changed {
+		if v > version {
+			changed = append(changed, templatePath)
+		}
+	}
+	return changed
 }
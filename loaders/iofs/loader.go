@@ -0,0 +1,94 @@
+//go:build go1.16
+// +build go1.16
+
+// Package iofs provides a jet.Loader for io/fs file systems, like embed.FS:
+//
+//	//go:embed views
+//	var views embed.FS
+//
+//	loader, err := iofs.NewSubLoader(views, "views")
+//	set := jet.NewSet(loader)
+package iofs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// Loader implements jet.Loader on top of an fs.FS.
+type Loader struct {
+	fsys fs.FS
+}
+
+// compile time check that we implement jet.Loader
+var _ jet.Loader = (*Loader)(nil)
+
+// NewLoader returns an initialized loader serving the templates in fsys.
+func NewLoader(fsys fs.FS) (*Loader, error) {
+	if fsys == nil {
+		return nil, errors.New("iofs: nil fs.FS passed to NewLoader")
+	}
+	return &Loader{fsys: fsys}, nil
+}
+
+// NewSubLoader returns an initialized loader serving the templates in the directory dir of fsys (see fs.Sub),
+// so that the template path "/index.jet" refers to the file dir/index.jet.
+func NewSubLoader(fsys fs.FS, dir string) (*Loader, error) {
+	if fsys == nil {
+		return nil, errors.New("iofs: nil fs.FS passed to NewSubLoader")
+	}
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Loader{fsys: sub}, nil
+}
+
+// name converts a template path, which is absolute and slash-delimited, into the unrooted path fs.FS expects.
+func name(templatePath string) string {
+	name := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(templatePath)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// Exists implements Loader.Exists() using fs.Stat.
+func (l *Loader) Exists(templatePath string) bool {
+	info, err := fs.Stat(l.fsys, name(templatePath))
+	return err == nil && !info.IsDir()
+}
+
+// Open implements Loader.Open() on top of an fs.FS.
+func (l *Loader) Open(templatePath string) (io.ReadCloser, error) {
+	return l.fsys.Open(name(templatePath))
+}
+
+// Templates returns the template paths of all files in the file system ending in one of the extensions,
+// like "/views/index.jet", in lexical order. Without extensions, it returns the paths of all files.
+func (l *Loader) Templates(extensions ...string) ([]string, error) {
+	var templates []string
+	err := fs.WalkDir(l.fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if len(extensions) == 0 {
+			templates = append(templates, "/"+file)
+			return nil
+		}
+		for _, extension := range extensions {
+			if strings.HasSuffix(file, extension) {
+				templates = append(templates, "/"+file)
+				break
+			}
+		}
+		return nil
+	})
+	return templates, err
+}
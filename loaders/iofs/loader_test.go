@@ -0,0 +1,66 @@
+//go:build go1.16
+// +build go1.16
+
+package iofs
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/jettest"
+)
+
+var testFS = fstest.MapFS{
+	"views/index.jet":             {Data: []byte(`{{ include "./partials/greeting" . }}`)},
+	"views/partials/greeting.jet": {Data: []byte(`Hello, {{ . }}!`)},
+	"views/README.md":             {Data: []byte(`not a template`)},
+}
+
+func TestNilFS(t *testing.T) {
+	if _, err := NewLoader(nil); err == nil {
+		t.Fatal("NewLoader with nil fs.FS should have returned an error but didn't.")
+	}
+}
+
+func TestLoader(t *testing.T) {
+	l, err := NewSubLoader(testFS, "views")
+	if err != nil {
+		t.Fatalf("unexpected error from NewSubLoader: %v", err)
+	}
+	for templatePath, exists := range map[string]bool{
+		"/index.jet":             true,
+		"index.jet":              true,
+		"/partials/../index.jet": true,
+		"/../index.jet":          true,
+		"/partials":              false,
+		"/":                      false,
+		"/missing.jet":           false,
+	} {
+		if l.Exists(templatePath) != exists {
+			t.Errorf("Exists(%q): expected %v", templatePath, exists)
+		}
+	}
+
+	set := jet.NewSet(l)
+	jettest.RunWithSet(t, set, nil, "World", "index", "Hello, World!")
+}
+
+func TestTemplates(t *testing.T) {
+	l, err := NewLoader(testFS)
+	if err != nil {
+		t.Fatalf("unexpected error from NewLoader: %v", err)
+	}
+	templates, err := l.Templates(".jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"/views/index.jet", "/views/partials/greeting.jet"}; !reflect.DeepEqual(templates, expected) {
+		t.Errorf("expected %v, got %v", expected, templates)
+	}
+	all, _ := l.Templates()
+	if len(all) != 3 {
+		t.Errorf("expected all 3 files, got %v", all)
+	}
+}
@@ -0,0 +1,179 @@
+package jet
+
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultLookupCacheSize is the number of resolved and missing template paths a Set caches by default.
+const defaultLookupCacheSize = 1024
+
+// WithLookupCacheSize returns an option function that bounds the number of template paths whose lookup in the
+// loader the Set caches: n paths resolved to the canonical path of a template, like "/index" to "/index.jet",
+// and n paths no template was found at. By default, 1024 of each are cached; with n <= 0, every lookup of a
+// template that isn't cached probes the loader for each extension.
+//
+// Paths no template was found at are only cached when the loader is a VersionedLoader, when the Set has a
+// Watcher, or with WithMissingLookupCache, so that templates added later are found. Cached lookups are
+// dropped together with the templates by Invalidate and Purge, when a VersionedLoader reports a change, and
+// when a Watcher reports a change to a file. They are not used in development mode.
+func WithLookupCacheSize(n int) Option {
+	return func(s *Set) {
+		s.lookups.size = n
+	}
+}
+
+// WithMissingLookupCache returns an option function that makes the Set cache the paths no template was found
+// at, like for includeIfExists() of templates that don't exist, even though its loader doesn't report
+// changes. A template added to the loader is then only found after calling Invalidate with its path.
+func WithMissingLookupCache() Option {
+	return func(s *Set) {
+		s.lookups.missingEnabled = true
+	}
+}
+
+// LookupStats are the statistics of the lookups of templates in the loader of a Set.
+type LookupStats struct {
+	Hits         uint64 // lookups resolved from the cached canonical paths
+	NegativeHits uint64 // lookups of paths cached as missing
+	Misses       uint64 // lookups probing the loader
+	Probes       uint64 // calls of Loader.Exists
+	Resolved     int    // number of cached canonical paths
+	Missing      int    // number of paths cached as missing
+}
+
+// LookupStats returns the statistics of the lookups of templates in the loader of the Set.
+func (s *Set) LookupStats() LookupStats {
+	return s.lookups.Stats()
+}
+
+// lookupCache caches the canonical paths templates were found at by resolveLoaderPath, and the paths no
+// template was found at. It's safe for concurrent use.
+type lookupCache struct {
+	mu             sync.Mutex
+	size           int
+	missingEnabled bool // whether paths no template was found at are cached
+	resolved       pathMap
+	missing        pathMap
+	generation     uint64 // increased by every forget and purge, so that lookups racing with them aren't cached
+	stats          LookupStats
+}
+
+// get returns the cached result of the lookup of templatePath; ok is false if there is none. The lookup in the
+// loader is then cached by passing generation to put.
+func (c *lookupCache) get(templatePath string) (canonicalPath string, found, ok bool, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if canonicalPath, found = c.resolved.get(templatePath); found {
+		c.stats.Hits++
+		return canonicalPath, true, true, c.generation
+	}
+	if _, missing := c.missing.get(templatePath); missing {
+		c.stats.NegativeHits++
+		return "", false, true, c.generation
+	}
+	c.stats.Misses++
+	return "", false, false, c.generation
+}
+
+// put caches the result of a lookup of templatePath in the loader started in generation, which took probes
+// calls of Exists. It isn't cached if lookups were dropped since.
+func (c *lookupCache) put(generation uint64, templatePath, canonicalPath string, found bool, probes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Probes += uint64(probes)
+	if c.size <= 0 || generation != c.generation {
+		return
+	}
+	if found {
+		c.resolved.put(templatePath, canonicalPath, c.size)
+	} else if c.missingEnabled {
+		c.missing.put(templatePath, "", c.size)
+	}
+}
+
+// forget drops the lookups the creation, change or removal of the template at templatePath may change the
+// result of: those of templatePath, of templatePath without one of extensions, and those resolved to it.
+func (c *lookupCache) forget(templatePath string, extensions []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, paths := range []*pathMap{&c.resolved, &c.missing} {
+		for path, e := range paths.m {
+			if e.Value.(*pathEntry).value == templatePath || isLookupOf(path, templatePath, extensions) {
+				paths.delete(path)
+			}
+		}
+	}
+}
+
+// isLookupOf reports whether a lookup of path probes the loader for templatePath.
+func isLookupOf(path, templatePath string, extensions []string) bool {
+	for _, extension := range extensions {
+		if path+extension == templatePath {
+			return true
+		}
+	}
+	return path == templatePath
+}
+
+// purge drops all lookups.
+func (c *lookupCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.resolved = pathMap{}
+	c.missing = pathMap{}
+}
+
+// Stats returns the statistics of the cache.
+func (c *lookupCache) Stats() LookupStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Resolved, stats.Missing = len(c.resolved.m), len(c.missing.m)
+	return stats
+}
+
+// pathMap is a map of template paths evicting the oldest paths when it's full.
+type pathMap struct {
+	m     map[string]*list.Element
+	order *list.List // entries in the order they were added, the oldest at the front
+}
+
+type pathEntry struct {
+	path, value string
+}
+
+// get returns the value of path.
+func (p *pathMap) get(path string) (string, bool) {
+	e, ok := p.m[path]
+	if !ok {
+		return "", false
+	}
+	return e.Value.(*pathEntry).value, true
+}
+
+// put sets path to value, evicting the oldest path if the map holds size paths.
+func (p *pathMap) put(path, value string, size int) {
+	if p.m == nil {
+		p.m = map[string]*list.Element{}
+		p.order = list.New()
+	}
+	if e, ok := p.m[path]; ok {
+		e.Value.(*pathEntry).value = value
+		return
+	}
+	for p.order.Len() >= size {
+		p.delete(p.order.Front().Value.(*pathEntry).path)
+	}
+	p.m[path] = p.order.PushBack(&pathEntry{path: path, value: value})
+}
+
+// delete removes path.
+func (p *pathMap) delete(path string) {
+	if e, ok := p.m[path]; ok {
+		p.order.Remove(e)
+		delete(p.m, path)
+	}
+}
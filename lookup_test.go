@@ -0,0 +1,133 @@
+package jet
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// probingLoader counts the calls of Exists.
+type probingLoader struct {
+	*InMemLoader
+	probes uint64
+}
+
+func (l *probingLoader) Exists(templatePath string) bool {
+	atomic.AddUint64(&l.probes, 1)
+	return l.InMemLoader.Exists(templatePath)
+}
+
+// noCache doesn't cache templates, so that every lookup reaches the loader.
+type noCache struct{}
+
+func (noCache) Get(string) *Template  { return nil }
+func (noCache) Put(string, *Template) {}
+
+func TestLookupCache(t *testing.T) {
+	l := &probingLoader{InMemLoader: NewInMemLoader()}
+	l.Set("/index.jet", `{{ includeIfExists("/missing") }}index`)
+	set := NewSet(l, WithCache(noCache{}))
+
+	for i := 0; i < 3; i++ {
+		if out := renderTemplate(t, set, "/index"); out != "index" {
+			t.Fatalf("unexpected output %q", out)
+		}
+	}
+	// "/index" is found with the second extension, "/missing" with none of the four
+	if probes := atomic.LoadUint64(&l.probes); probes != 2+4 {
+		t.Errorf("expected 6 probes, got %d", probes)
+	}
+	expected := LookupStats{Hits: 2, NegativeHits: 2, Misses: 2, Probes: 6, Resolved: 1, Missing: 1}
+	if stats := set.LookupStats(); stats != expected {
+		t.Errorf("expected stats %+v, got %+v", expected, stats)
+	}
+
+	l.Set("/missing.jet.html", "missing ")
+	if out := renderTemplate(t, set, "/index"); out != "missing index" {
+		t.Errorf("expected the added template to be found, got %q", out)
+	}
+
+	set.Purge()
+	if stats := set.LookupStats(); stats.Resolved != 0 || stats.Missing != 0 {
+		t.Errorf("expected Purge to drop the lookups, got %+v", stats)
+	}
+}
+
+func TestLookupCacheInvalidate(t *testing.T) {
+	l := NewInMemLoader()
+	l.Set("/page.jet", "jet")
+	// hide the versioning of InMemLoader, so that lookups are only dropped by Invalidate
+	set := NewSet(struct{ Loader }{l}, WithCache(noCache{}))
+
+	if out := renderTemplate(t, set, "/page"); out != "jet" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	l.Set("/page", "no extension")
+	if out := renderTemplate(t, set, "/page"); out != "jet" {
+		t.Errorf("expected the cached lookup of /page to be used, got %q", out)
+	}
+	set.Invalidate("/page")
+	if out := renderTemplate(t, set, "/page"); out != "no extension" {
+		t.Errorf("expected Invalidate to drop the lookup of /page, got %q", out)
+	}
+}
+
+func TestLookupCacheSize(t *testing.T) {
+	set := NewSet(NewInMemLoader(), WithLookupCacheSize(2))
+	for _, templatePath := range []string{"/a", "/b", "/c", "/a"} {
+		if _, err := set.GetTemplate(templatePath); err == nil {
+			t.Fatalf("expected %s not to be found", templatePath)
+		}
+	}
+	if stats := set.LookupStats(); stats.Missing != 2 || stats.NegativeHits != 0 || stats.Misses != 4 {
+		t.Errorf("expected the oldest lookup to be evicted, got %+v", stats)
+	}
+}
+
+func TestLookupCacheMissing(t *testing.T) {
+	l := NewInMemLoader()
+	// without versioning, templates added later are found unless missing paths are cached explicitly
+	set := NewSet(struct{ Loader }{l})
+	if _, err := set.GetTemplate("/late"); err == nil {
+		t.Fatal("expected /late not to be found")
+	}
+	l.Set("/late.jet", "late")
+	if out := renderTemplate(t, set, "/late"); out != "late" {
+		t.Errorf("expected the added template to be found, got %q", out)
+	}
+	if stats := set.LookupStats(); stats.Missing != 0 {
+		t.Errorf("expected no missing path to be cached, got %+v", stats)
+	}
+
+	l = NewInMemLoader()
+	set = NewSet(struct{ Loader }{l}, WithMissingLookupCache())
+	if _, err := set.GetTemplate("/late"); err == nil {
+		t.Fatal("expected /late not to be found")
+	}
+	l.Set("/late.jet", "late")
+	if _, err := set.GetTemplate("/late"); err == nil {
+		t.Error("expected the cached lookup of /late to be used")
+	}
+	set.Invalidate("/late.jet")
+	if out := renderTemplate(t, set, "/late"); out != "late" {
+		t.Errorf("expected Invalidate to drop the lookup of /late, got %q", out)
+	}
+}
+
+func TestLookupCacheForgottenPaths(t *testing.T) {
+	c := &lookupCache{size: 3}
+	c.put(c.generation, "/a", "/a.jet", true, 1)
+	c.forget("/a.jet", nil)
+	// re-adding a forgotten path must neither count it twice nor evict it early
+	for _, templatePath := range []string{"/a", "/b", "/c"} {
+		c.put(c.generation, templatePath, templatePath+".jet", true, 1)
+	}
+	for _, templatePath := range []string{"/a", "/b", "/c"} {
+		if canonicalPath, found, _, _ := c.get(templatePath); !found || canonicalPath != templatePath+".jet" {
+			t.Errorf("expected %s to be cached, got %q", templatePath, canonicalPath)
+		}
+	}
+	c.put(c.generation, "/d", "/d.jet", true, 1)
+	if _, found, _, _ := c.get("/a"); found {
+		t.Error("expected /a to be evicted as the oldest path")
+	}
+}
@@ -0,0 +1,39 @@
+package lsp
+
+type builtinDoc struct {
+	signature string
+	text      string
+}
+
+// builtinDocs documents the built-ins of jet.Builtins, following docs/builtins.md.
+var builtinDocs = map[string]builtinDoc{
+	"lower":     {"lower(s string) string", "Exposes Go's `strings.ToLower`."},
+	"upper":     {"upper(s string) string", "Exposes Go's `strings.ToUpper`."},
+	"hasPrefix": {"hasPrefix(s, prefix string) bool", "Exposes Go's `strings.HasPrefix`."},
+	"hasSuffix": {"hasSuffix(s, suffix string) bool", "Exposes Go's `strings.HasSuffix`."},
+	"repeat":    {"repeat(s string, count int) string", "Exposes Go's `strings.Repeat`."},
+	"replace":   {"replace(s, old, new string, n int) string", "Exposes Go's `strings.Replace`."},
+	"split":     {"split(s, sep string) []string", "Exposes Go's `strings.Split`."},
+	"trimSpace": {"trimSpace(s string) string", "Exposes Go's `strings.TrimSpace`."},
+	"html":      {"html(s string) string", "Exposes Go's `html.EscapeString`."},
+	"url":       {"url(s string) string", "Exposes Go's `url.QueryEscape`."},
+	"json":      {"json(v interface{}) ([]byte, error)", "Exposes Go's `json.Marshal`."},
+	"safeHtml":  {"safeHtml SafeWriter", "Escapes everything that could be interpreted as HTML, like the escaping applied to actions by default. An alias for Go's `template.HTMLEscape`."},
+	"safeJs":    {"safeJs SafeWriter", "Escapes data to be safe to use in a JavaScript context. An alias for Go's `template.JSEscape`."},
+	"raw":       {"raw SafeWriter", "Writes the value without escaping anything, circumventing Jet's default HTML escaping. Use with caution!"},
+	"unsafe":    {"unsafe SafeWriter", "An alias of `raw`: writes the value without escaping anything. Use with caution!"},
+	"writeJson": {"writeJson(v interface{}) Renderer", "Renders the JSON encoding of `v` to the output, escaping only \"<\", \">\" and \"&\" (just like the `json` function)."},
+	"map":       {"map(key1 string, value1 interface{}, ...) map[string]interface{}", "Returns a map of the key-value pairs passed as arguments."},
+	"slice":     {"slice(values ...interface{}) []interface{}", "Returns a slice of the arguments."},
+	"array":     {"array(values ...interface{}) []interface{}", "An alias of `slice`: returns a slice of the arguments."},
+	"isset":     {"isset(expressions ...) bool", "Returns true if all expressions, which have to be index, field, chain or identifier expressions, evaluate to non-nil values."},
+	"len":       {"len(v interface{}) int", "Returns the length of a string, array, slice or map, the number of fields in a struct, or the buffer size of a channel, indirecting through pointers and interfaces."},
+	"includeIfExists": {"includeIfExists(name string[, context interface{}]) bool",
+		"Includes the template at `name` like an include statement if it exists, and returns whether it did."},
+	"exec": {"exec(name string[, context interface{}]) interface{}",
+		"Executes the template at `name` with the current or the specified context and returns the last value returned with a `return` statement, or nil."},
+	"ints": {"ints(from, to int) Ranger",
+		"Returns a Ranger producing the integers from the lower limit `from` up to, excluding, the upper limit `to`."},
+	"dump": {"dump([levels int | names ...string]) string",
+		"Prints the context, variables, globals and blocks of the current scope, recursing over `levels` parents, or the variables and blocks with the given names in any scope. Meant to aid template development."},
+}
@@ -0,0 +1,300 @@
+package lsp
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+// errorDiagnostic returns the diagnostic for an error parsing text, which points at the token the parser
+// stopped at.
+func errorDiagnostic(text string, err error) diagnostic {
+	d := diagnostic{Severity: severityError, Source: "jet", Message: err.Error()}
+	e, ok := err.(errors.Error)
+	if !ok {
+		return d
+	}
+	d.Message = fmt.Sprintf("%s: %s", e.Reason(), e.Message())
+	if e.Position().L == 0 {
+		return d
+	}
+	start := lineOffset(text, e.Position().L, e.Position().C)
+	end := start
+	for end < len(text) && text[end] != '\n' && text[end] != ' ' && text[end] != '\t' {
+		end++
+	}
+	d.Range = rangeOf(text, start, end)
+	return d
+}
+
+// current returns the parsed template of the document, nil if the current text can't be parsed.
+func (s *Server) current(doc *document) *jet.Template {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if doc.parsed != doc.text {
+		return nil
+	}
+	return doc.template
+}
+
+// blockNameAt returns the block or yield whose name is at the byte offset of the template, nil if there is none.
+func blockNameAt(t *jet.Template, offset int) jet.Node {
+	var found jet.Node
+	jet.Inspect(t.Root, func(node jet.Node) {
+		switch node := node.(type) {
+		case *jet.BlockNode:
+			if int(node.Pos) <= offset && offset <= int(node.Pos)+len(node.Name) {
+				found = node
+			}
+		case *jet.YieldNode:
+			if !node.IsContent && int(node.Pos) <= offset && offset <= int(node.Pos)+len(node.Name) {
+				found = node
+			}
+		}
+	})
+	return found
+}
+
+// location returns the location of the length bytes at the byte offset of the template at templatePath.
+func (s *Server) location(templatePath string, offset, length int) location {
+	text, _ := s.source(templatePath)
+	if offset > len(text) {
+		offset = len(text)
+	}
+	if offset+length > len(text) {
+		length = len(text) - offset
+	}
+	return location{URI: s.uri(templatePath), Range: rangeOf(text, offset, offset+length)}
+}
+
+// definition returns the block a yield renders, or the template an extends, import or include statement
+// refers to.
+func (s *Server) definition(params textDocumentPositionParams) ([]location, error) {
+	doc, ok := s.document(params.TextDocument.URI)
+	if !ok {
+		return nil, nil
+	}
+	t := s.current(doc)
+	if t == nil {
+		return nil, nil
+	}
+	off := offset(doc.text, params.Position)
+
+	switch node := blockNameAt(t, off).(type) {
+	case *jet.YieldNode:
+		if block, ok := t.Blocks()[node.Name]; ok {
+			return []location{s.location(block.TemplatePath, int(block.Pos), len(block.Name))}, nil
+		}
+		return nil, nil
+	case *jet.BlockNode:
+		return []location{s.location(node.TemplatePath, int(node.Pos), len(node.Name))}, nil
+	}
+
+	dependencies, err := s.set.Dependencies(doc.path)
+	if err != nil {
+		return nil, nil
+	}
+	lineStart := offset(doc.text, position{Line: params.Position.Line})
+	lineEnd := strings.IndexByte(doc.text[lineStart:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(doc.text) - lineStart
+	}
+	line := doc.text[lineStart : lineStart+lineEnd]
+	for _, d := range dependencies {
+		if d.Line != params.Position.Line+1 || d.Path == "" {
+			continue
+		}
+		// the cursor has to be on the template name
+		if i := strings.Index(line, d.Name); i >= 0 && lineStart+i <= off && off <= lineStart+i+len(d.Name) {
+			return []location{s.location(d.Path, 0, 0)}, nil
+		}
+	}
+	return nil, nil
+}
+
+// references returns the blocks and yields with the name of the block or yield at the position, in all
+// templates of the directory of the server.
+func (s *Server) references(params referenceParams) ([]location, error) {
+	doc, ok := s.document(params.TextDocument.URI)
+	if !ok {
+		return nil, nil
+	}
+	t := s.current(doc)
+	if t == nil {
+		return nil, nil
+	}
+	var name string
+	switch node := blockNameAt(t, offset(doc.text, params.Position)).(type) {
+	case *jet.YieldNode:
+		name = node.Name
+	case *jet.BlockNode:
+		name = node.Name
+	default:
+		return nil, nil
+	}
+
+	locations := []location{}
+	for _, templatePath := range s.templatePaths() {
+		t, err := s.set.GetTemplate(templatePath)
+		if err != nil {
+			continue
+		}
+		jet.Inspect(t.Root, func(node jet.Node) {
+			switch node := node.(type) {
+			case *jet.BlockNode:
+				if node.Name == name && params.Context.IncludeDeclaration {
+					locations = append(locations, s.location(templatePath, int(node.Pos), len(node.Name)))
+				}
+			case *jet.YieldNode:
+				if node.Name == name && !node.IsContent {
+					locations = append(locations, s.location(templatePath, int(node.Pos), len(node.Name)))
+				}
+			}
+		})
+	}
+	sort.SliceStable(locations, func(i, j int) bool { return locations[i].URI < locations[j].URI })
+	return locations, nil
+}
+
+// hover returns the documentation of the built-in or global at the position.
+func (s *Server) hover(params textDocumentPositionParams) (*hover, error) {
+	doc, ok := s.document(params.TextDocument.URI)
+	if !ok {
+		return nil, nil
+	}
+	t := s.current(doc)
+	if t == nil {
+		return nil, nil
+	}
+	off := offset(doc.text, params.Position)
+	var ident *jet.IdentifierNode
+	jet.Inspect(t.Root, func(node jet.Node) {
+		if node, ok := node.(*jet.IdentifierNode); ok && int(node.Pos) <= off && off <= int(node.Pos)+len(node.Ident) {
+			ident = node
+		}
+	})
+	if ident == nil {
+		return nil, nil
+	}
+
+	// globals shadow built-ins
+	var value string
+	if global, ok := s.set.LookupGlobal(ident.Ident); ok {
+		value = fmt.Sprintf("```go\n%s %s\n```\n\nGlobal added to the Set.", ident.Ident, globalType(global))
+	} else if doc, ok := builtinDocs[ident.Ident]; ok {
+		value = fmt.Sprintf("```go\n%s\n```\n\n%s", doc.signature, doc.text)
+	} else {
+		return nil, nil
+	}
+	r := rangeOf(doc.text, int(ident.Pos), int(ident.Pos)+len(ident.Ident))
+	return &hover{Contents: markupContent{Kind: "markdown", Value: value}, Range: &r}, nil
+}
+
+func globalType(global interface{}) reflect.Type {
+	if v, ok := global.(reflect.Value); ok {
+		if !v.IsValid() {
+			return nil
+		}
+		return v.Type()
+	}
+	return reflect.TypeOf(global)
+}
+
+var yieldPrefix = regexp.MustCompile(`\byield\s+\w*$`)
+
+// completion returns the names of blocks after yield, and the parameters of the enclosing blocks, the
+// globals and the built-ins anywhere else inside actions.
+func (s *Server) completion(params textDocumentPositionParams) ([]completionItem, error) {
+	doc, ok := s.document(params.TextDocument.URI)
+	if !ok {
+		return nil, nil
+	}
+	off := offset(doc.text, params.Position)
+	before := doc.text[:off]
+	leftDelim, rightDelim := s.set.Delims()
+	if strings.LastIndex(before, leftDelim) <= strings.LastIndex(before, rightDelim) {
+		return nil, nil // not inside an action
+	}
+
+	// while typing, the document often can't be parsed: use the last version that could
+	s.mu.Lock()
+	t, parsed := doc.template, doc.parsed
+	s.mu.Unlock()
+
+	items := []completionItem{}
+	if yieldPrefix.MatchString(before) {
+		if t == nil {
+			return items, nil
+		}
+		for name, block := range t.Blocks() {
+			items = append(items, completionItem{Label: name, Kind: completionModule, Detail: "block in " + block.TemplatePath})
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+		return items, nil
+	}
+
+	if t != nil {
+		// text inserted since the last parse shifts the end of the blocks around the cursor
+		shift := len(doc.text) - len(parsed)
+		for _, block := range enclosingBlocks(t, off, shift) {
+			if block.Parameters == nil {
+				continue
+			}
+			for _, p := range block.Parameters.List {
+				items = append(items, completionItem{Label: p.Identifier, Kind: completionVariable, Detail: "parameter of block " + block.Name})
+			}
+		}
+	}
+	for _, name := range s.set.Globals() {
+		global, _ := s.set.LookupGlobal(name)
+		typ := globalType(global)
+		kind := completionVariable
+		if typ != nil && (typ.Kind() == reflect.Func) {
+			kind = completionFunction
+		}
+		items = append(items, completionItem{Label: name, Kind: kind, Detail: fmt.Sprint(typ)})
+	}
+	for _, name := range jet.Builtins() {
+		if _, ok := s.set.LookupGlobal(name); ok {
+			continue
+		}
+		item := completionItem{Label: name, Kind: completionFunction}
+		if doc, ok := builtinDocs[name]; ok {
+			item.Detail = doc.signature
+			item.Documentation = &markupContent{Kind: "markdown", Value: doc.text}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// enclosingBlocks returns the blocks of t declared around the byte offset, from the outermost one.
+// The ends of the blocks are moved by shift bytes.
+func enclosingBlocks(t *jet.Template, offset, shift int) []*jet.BlockNode {
+	var blocks []*jet.BlockNode
+	jet.Inspect(t.Root, func(node jet.Node) {
+		block, ok := node.(*jet.BlockNode)
+		if !ok || int(block.Pos) > offset {
+			return
+		}
+		end := int(block.Pos)
+		jet.Inspect(block, func(node jet.Node) {
+			nodeEnd := int(node.Position())
+			if text, ok := node.(*jet.TextNode); ok {
+				nodeEnd += len(text.Text)
+			}
+			if nodeEnd > end {
+				end = nodeEnd
+			}
+		})
+		if offset <= end+shift {
+			blocks = append(blocks, block)
+		}
+	})
+	return blocks
+}
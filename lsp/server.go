@@ -0,0 +1,355 @@
+// Package lsp implements a Language Server Protocol server for Jet templates, for editors to show parse
+// errors as you type, jump from yields to the blocks they render, find the yields of blocks, show the
+// documentation of built-ins and complete globals and block parameters.
+//
+// The server communicates over stdio, and is usually started by the editor:
+//
+//	server := lsp.NewServer("./views")
+//	server.Set().AddGlobal("appName", "Example")
+//	err := server.Serve(os.Stdin, os.Stdout)
+//
+// The jet command runs a server without globals with `jet lsp`. To complete the globals of an application,
+// build a command adding them like above.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// Server is a language server for the templates in a directory.
+type Server struct {
+	dir    string
+	set    *jet.Set
+	loader jet.Loader // loader of the files in dir
+
+	mu   sync.Mutex
+	docs map[string]*document // documents open in the editor, by template path
+
+	out   io.Writer
+	outMu sync.Mutex
+}
+
+// document is a template open in the editor, whose text may not have been saved.
+type document struct {
+	uri  string
+	path string // template path
+	text string
+
+	// the last version of the document that could be parsed, for completion while typing
+	template *jet.Template
+	parsed   string
+}
+
+// NewServer returns a server for the templates in the directory dir, which is the root for absolute template
+// paths, like for an OSFileSystemLoader. Templates are parsed by a Set created with the options; templates
+// open in the editor are parsed with their unsaved changes.
+func NewServer(dir string, opts ...jet.Option) *Server {
+	s := &Server{
+		dir:    dir,
+		loader: jet.NewOSFileSystemLoader(dir),
+		docs:   map[string]*document{},
+	}
+	// parse templates on every lookup, to pick up changes to imported templates
+	s.set = jet.NewSet(overlayLoader{s}, append(opts, jet.InDevelopmentMode())...)
+	return s
+}
+
+// Set returns the Set templates are parsed with. Add the globals of the application to it to complete them.
+func (s *Server) Set() *jet.Set {
+	return s.set
+}
+
+// Serve reads requests from r and writes the responses to w until the client asks the server to exit
+// or r is closed.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.out = w
+	reader := textproto.NewReader(bufio.NewReader(r))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			return fmt.Errorf("lsp: invalid Content-Length header %q", header.Get("Content-Length"))
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(req)
+		if req.ID != nil {
+			s.reply(req.ID, result, rerr)
+		}
+	}
+}
+
+func (s *Server) handle(req request) (interface{}, *responseError) {
+	var params interface{}
+	var handler func() (interface{}, error)
+	switch req.Method {
+	case "initialize":
+		return s.initialize(), nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		p := &didOpenTextDocumentParams{}
+		params, handler = p, func() (interface{}, error) {
+			s.update(p.TextDocument.URI, p.TextDocument.Text)
+			return nil, nil
+		}
+	case "textDocument/didChange":
+		p := &didChangeTextDocumentParams{}
+		params, handler = p, func() (interface{}, error) {
+			if n := len(p.ContentChanges); n > 0 {
+				s.update(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+			}
+			return nil, nil
+		}
+	case "textDocument/didClose":
+		p := &didCloseTextDocumentParams{}
+		params, handler = p, func() (interface{}, error) {
+			s.close(p.TextDocument.URI)
+			return nil, nil
+		}
+	case "textDocument/definition":
+		p := &textDocumentPositionParams{}
+		params, handler = p, func() (interface{}, error) { return s.definition(*p) }
+	case "textDocument/references":
+		p := &referenceParams{}
+		params, handler = p, func() (interface{}, error) { return s.references(*p) }
+	case "textDocument/hover":
+		p := &textDocumentPositionParams{}
+		params, handler = p, func() (interface{}, error) { return s.hover(*p) }
+	case "textDocument/completion":
+		p := &textDocumentPositionParams{}
+		params, handler = p, func() (interface{}, error) { return s.completion(*p) }
+	default:
+		if req.ID == nil || strings.HasPrefix(req.Method, "$/") {
+			return nil, nil // notifications the server doesn't implement can be ignored
+		}
+		return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	result, err := handler()
+	if err != nil {
+		return nil, &responseError{Code: codeInternalError, Message: err.Error()}
+	}
+	return result, nil
+}
+
+func (s *Server) initialize() *initializeResult {
+	result := &initializeResult{}
+	result.Capabilities.TextDocumentSync = 1
+	result.Capabilities.DefinitionProvider = true
+	result.Capabilities.ReferencesProvider = true
+	result.Capabilities.HoverProvider = true
+	result.Capabilities.CompletionProvider.TriggerCharacters = []string{" ", "("}
+	result.ServerInfo.Name = "jet"
+	return result
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) {
+	res := response{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			res.Error = &responseError{Code: codeInternalError, Message: err.Error()}
+		} else {
+			raw := json.RawMessage(data)
+			res.Result = &raw
+		}
+	}
+	s.write(res)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) write(message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// templatePath returns the template path of the file uri refers to. Files outside the directory of the
+// server are treated as if they were in it.
+func (s *Server) templatePath(uri string) string {
+	path, ok := filePath(uri)
+	if !ok {
+		return "/" + filepath.Base(uri)
+	}
+	if dir, err := filepath.Abs(s.dir); err == nil {
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return "/" + filepath.ToSlash(rel)
+		}
+	}
+	return "/" + filepath.Base(path)
+}
+
+// uri returns the URI of the template at templatePath.
+func (s *Server) uri(templatePath string) string {
+	s.mu.Lock()
+	doc, ok := s.docs[templatePath]
+	s.mu.Unlock()
+	if ok {
+		return doc.uri
+	}
+	dir, err := filepath.Abs(s.dir)
+	if err != nil {
+		dir = s.dir
+	}
+	return fileURI(filepath.Join(dir, filepath.FromSlash(templatePath)))
+}
+
+// source returns the text of the template at templatePath.
+func (s *Server) source(templatePath string) (string, bool) {
+	s.mu.Lock()
+	doc, ok := s.docs[templatePath]
+	s.mu.Unlock()
+	if ok {
+		return doc.text, true
+	}
+	if !s.loader.Exists(templatePath) {
+		return "", false
+	}
+	f, err := s.loader.Open(templatePath)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	text, err := ioutil.ReadAll(f)
+	return string(text), err == nil
+}
+
+// document returns the open document uri refers to.
+func (s *Server) document(uri string) (*document, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.docs[s.templatePath(uri)]
+	return doc, ok
+}
+
+// update records the new text of the document and publishes its diagnostics.
+func (s *Server) update(uri, text string) {
+	templatePath := s.templatePath(uri)
+	s.mu.Lock()
+	doc, ok := s.docs[templatePath]
+	if !ok {
+		doc = &document{uri: uri, path: templatePath}
+		s.docs[templatePath] = doc
+	}
+	doc.text = text
+	s.mu.Unlock()
+
+	diagnostics := []diagnostic{}
+	t, err := s.set.Parse(templatePath, text)
+	if err != nil {
+		diagnostics = append(diagnostics, errorDiagnostic(text, err))
+	} else {
+		s.mu.Lock()
+		doc.template, doc.parsed = t, text
+		s.mu.Unlock()
+	}
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func (s *Server) close(uri string) {
+	s.mu.Lock()
+	delete(s.docs, s.templatePath(uri))
+	s.mu.Unlock()
+	// the diagnostics are those of the file now
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: []diagnostic{}})
+}
+
+// overlayLoader loads the documents open in the editor from memory and all other templates from the
+// directory of the server.
+type overlayLoader struct {
+	s *Server
+}
+
+func (l overlayLoader) Exists(templatePath string) bool {
+	l.s.mu.Lock()
+	_, ok := l.s.docs[templatePath]
+	l.s.mu.Unlock()
+	return ok || l.s.loader.Exists(templatePath)
+}
+
+func (l overlayLoader) Open(templatePath string) (io.ReadCloser, error) {
+	l.s.mu.Lock()
+	doc, ok := l.s.docs[templatePath]
+	l.s.mu.Unlock()
+	if ok {
+		return ioutil.NopCloser(strings.NewReader(doc.text)), nil
+	}
+	return l.s.loader.Open(templatePath)
+}
+
+// templateExtensions are the file extensions of the templates the server looks for references in.
+var templateExtensions = []string{".jet", ".html.jet", ".jet.html"}
+
+// templatePaths returns the paths of all templates in the directory of the server and of the open documents.
+func (s *Server) templatePaths() []string {
+	seen := map[string]bool{}
+	var paths []string
+	filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !isTemplate(path) {
+			return nil
+		}
+		if rel, err := filepath.Rel(s.dir, path); err == nil {
+			templatePath := "/" + filepath.ToSlash(rel)
+			seen[templatePath] = true
+			paths = append(paths, templatePath)
+		}
+		return nil
+	})
+	s.mu.Lock()
+	for templatePath := range s.docs {
+		if !seen[templatePath] {
+			paths = append(paths, templatePath)
+		}
+	}
+	s.mu.Unlock()
+	return paths
+}
+
+func isTemplate(name string) bool {
+	for _, ext := range templateExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
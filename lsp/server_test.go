@@ -0,0 +1,242 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+var testTemplates = map[string]string{
+	"layouts/main.jet": "<title>{{ block title() }}Site{{ end }}</title>\n{{ yield body() }}",
+	"macros.jet":       "{{ block card(title, body=\"\") }}\n<h2>{{ title }}</h2>\n{{ end }}",
+	"other.jet":        "{{ import \"macros\" }}{{ yield card(title=\"Other\") }}",
+}
+
+const index = `{{ extends "layouts/main" }}
+{{ import "macros" }}
+{{ block body() }}
+	{{ yield card(title=upper(appName)) }}
+{{ end }}`
+
+// testSession runs the server with the requests, returning the responses by id and the diagnostics by URI.
+func testSession(t *testing.T, server *Server, requests ...map[string]interface{}) (map[int]json.RawMessage, map[string][]diagnostic) {
+	var in bytes.Buffer
+	for i, req := range append(requests, map[string]interface{}{"method": "exit"}) {
+		req["jsonrpc"] = "2.0"
+		if !strings.HasPrefix(req["method"].(string), "textDocument/did") && req["method"] != "exit" {
+			req["id"] = i
+		}
+		data, _ := json.Marshal(req)
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+	var out bytes.Buffer
+	if err := server.Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	responses, diagnostics := map[int]json.RawMessage{}, map[string][]diagnostic{}
+	reader := textproto.NewReader(bufio.NewReader(&out))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		io.ReadFull(reader.R, body)
+		var message struct {
+			ID     *int
+			Method string
+			Params publishDiagnosticsParams
+			Result json.RawMessage
+			Error  *responseError
+		}
+		if err := json.Unmarshal(body, &message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Error != nil {
+			t.Errorf("request %d: %s", *message.ID, message.Error.Message)
+		} else if message.ID != nil {
+			responses[*message.ID] = message.Result
+		} else if message.Method == "textDocument/publishDiagnostics" {
+			diagnostics[message.Params.URI] = message.Params.Diagnostics
+		}
+	}
+	return responses, diagnostics
+}
+
+func testServer(t *testing.T) (*Server, string) {
+	dir, err := ioutil.TempDir("", "jet-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range testTemplates {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := NewServer(dir)
+	server.Set().AddGlobal("appName", "Example")
+	return server, dir
+}
+
+func open(uri, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"method": "textDocument/didOpen",
+		"params": map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri, "text": text}},
+	}
+}
+
+func at(method, uri string, line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"method": method,
+		"params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+			"position":     position{Line: line, Character: character},
+			"context":      map[string]interface{}{"includeDeclaration": true},
+		},
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	server, dir := testServer(t)
+	defer os.RemoveAll(dir)
+	indexURI, brokenURI := fileURI(filepath.Join(dir, "index.jet")), fileURI(filepath.Join(dir, "broken.jet"))
+
+	_, diagnostics := testSession(t, server, open(indexURI, index), open(brokenURI, "<p>\n  {{ if }}</p>"))
+	if d := diagnostics[indexURI]; len(d) != 0 {
+		t.Errorf("expected no diagnostics for index.jet, got %v", d)
+	}
+	d := diagnostics[brokenURI]
+	if len(d) != 1 {
+		t.Fatalf("expected a diagnostic for broken.jet, got %v", d)
+	}
+	if expected := (textRange{Start: position{1, 8}, End: position{1, 14}}); d[0].Range != expected || !strings.Contains(d[0].Message, "unexpected token '}}'") {
+		t.Errorf("unexpected diagnostic %+v", d[0])
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	server, dir := testServer(t)
+	defer os.RemoveAll(dir)
+	indexURI := fileURI(filepath.Join(dir, "index.jet"))
+	uri := func(name string) string { return fileURI(filepath.Join(dir, filepath.FromSlash(name))) }
+
+	responses, _ := testSession(t, server,
+		open(indexURI, index),
+		at("textDocument/definition", indexURI, 3, 12),  // 1: yield card
+		at("textDocument/definition", indexURI, 0, 16),  // 2: extends "layouts/main"
+		at("textDocument/references", indexURI, 2, 10),  // 3: block body
+		at("textDocument/references", indexURI, 3, 12),  // 4: yield card
+		at("textDocument/definition", indexURI, 4, 2),   // 5: nothing
+		at("textDocument/references", indexURI, 0, 100), // 6: nothing
+	)
+	for id, expected := range map[int][]location{
+		1: {{URI: uri("macros.jet"), Range: textRange{position{0, 9}, position{0, 13}}}},
+		2: {{URI: uri("layouts/main.jet")}},
+		3: {
+			{URI: indexURI, Range: textRange{position{2, 9}, position{2, 13}}},
+			{URI: uri("layouts/main.jet"), Range: textRange{position{1, 9}, position{1, 13}}},
+		},
+		4: {
+			{URI: indexURI, Range: textRange{position{3, 10}, position{3, 14}}},
+			{URI: uri("macros.jet"), Range: textRange{position{0, 9}, position{0, 13}}},
+			{URI: uri("other.jet"), Range: textRange{position{0, 30}, position{0, 34}}},
+		},
+		5: nil,
+		6: nil,
+	} {
+		var locations []location
+		if err := json.Unmarshal(responses[id], &locations); err != nil {
+			t.Fatalf("request %d: %v", id, err)
+		}
+		if fmt.Sprint(locations) != fmt.Sprint(expected) {
+			t.Errorf("request %d: expected %v, got %v", id, expected, locations)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	server, dir := testServer(t)
+	defer os.RemoveAll(dir)
+	indexURI := fileURI(filepath.Join(dir, "index.jet"))
+
+	responses, _ := testSession(t, server,
+		open(indexURI, index),
+		at("textDocument/hover", indexURI, 3, 21), // 1: upper
+		at("textDocument/hover", indexURI, 3, 28), // 2: appName
+		at("textDocument/hover", indexURI, 3, 16), // 3: title parameter
+	)
+	for id, expected := range map[int]string{1: "strings.ToUpper", 2: "appName string", 3: ""} {
+		var h *hover
+		if err := json.Unmarshal(responses[id], &h); err != nil {
+			t.Fatalf("request %d: %v", id, err)
+		}
+		if expected == "" {
+			if h != nil {
+				t.Errorf("request %d: expected no hover, got %v", id, h.Contents.Value)
+			}
+		} else if h == nil || !strings.Contains(h.Contents.Value, expected) {
+			t.Errorf("request %d: expected hover containing %q, got %+v", id, expected, h)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	server, dir := testServer(t)
+	defer os.RemoveAll(dir)
+	indexURI, macrosURI := fileURI(filepath.Join(dir, "index.jet")), fileURI(filepath.Join(dir, "macros.jet"))
+
+	typing := strings.Replace(testTemplates["macros.jet"], "</h2>", "{{ t</h2>", 1)
+	responses, _ := testSession(t, server,
+		open(indexURI, index),
+		open(macrosURI, testTemplates["macros.jet"]),
+		open(macrosURI, typing),
+		at("textDocument/completion", macrosURI, 1, 19), // 3: in the unfinished action
+		at("textDocument/completion", indexURI, 3, 10),  // 4: after yield
+		at("textDocument/completion", indexURI, 2, 0),   // 5: outside of actions
+	)
+	labels := func(id int) string {
+		var items []completionItem
+		if err := json.Unmarshal(responses[id], &items); err != nil {
+			t.Fatalf("request %d: %v", id, err)
+		}
+		var labels []string
+		for _, item := range items {
+			labels = append(labels, item.Label)
+		}
+		return strings.Join(labels, " ")
+	}
+	if l := labels(3); !strings.HasPrefix(l, "title body appName ") || !strings.Contains(l, " upper") {
+		t.Errorf("expected the block parameters, globals and built-ins, got %s", l)
+	}
+	if l := labels(4); l != "body card title" {
+		t.Errorf("expected the block names, got %s", l)
+	}
+	if l := labels(5); l != "" {
+		t.Errorf("expected no completion outside of actions, got %s", l)
+	}
+}
+
+func TestBuiltinDocs(t *testing.T) {
+	for _, name := range jet.Builtins() {
+		if _, ok := builtinDocs[name]; !ok {
+			t.Errorf("built-in %s is not documented", name)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// offset returns the byte offset of the position p in text.
+func offset(text string, p position) int {
+	i := 0
+	for line := 0; line < p.Line; line++ {
+		next := strings.IndexByte(text[i:], '\n')
+		if next < 0 {
+			return len(text)
+		}
+		i += next + 1
+	}
+	for character := 0; character < p.Character && i < len(text) && text[i] != '\n'; {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		character += len(utf16.Encode([]rune{r}))
+		i += size
+	}
+	return i
+}
+
+// positionOf returns the position of the byte offset in text.
+func positionOf(text string, offset int) position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+	p := position{Line: strings.Count(text[:offset], "\n")}
+	for _, r := range text[lineStart:offset] {
+		p.Character += len(utf16.Encode([]rune{r}))
+	}
+	return p
+}
+
+func rangeOf(text string, start, end int) textRange {
+	return textRange{Start: positionOf(text, start), End: positionOf(text, end)}
+}
+
+// lineOffset returns the byte offset of the 1-based column of the 1-based line in text, as reported by the parser.
+func lineOffset(text string, line, column int) int {
+	i := offset(text, position{Line: line - 1})
+	end := strings.IndexByte(text[i:], '\n')
+	if end < 0 {
+		end = len(text) - i
+	}
+	if column < 1 {
+		return i
+	}
+	if column-1 > end {
+		return i + end
+	}
+	return i + column - 1
+}
+
+// wordAt returns the identifier around the byte offset in text, and its start.
+func wordAt(text string, offset int) (string, int) {
+	start, end := offset, offset
+	for start > 0 && isIdentifierByte(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isIdentifierByte(text[end]) {
+		end++
+	}
+	return text[start:end], start
+}
+
+func isIdentifierByte(b byte) bool {
+	return b == '_' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// filePath returns the path of the file a file:// URI refers to.
+func filePath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	p := u.Path
+	if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+		p = p[1:] // Windows drive letter, like /C:/views
+	}
+	return filepath.FromSlash(p), true
+}
+
+// fileURI returns the file:// URI of the file at path.
+func fileURI(path string) string {
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
@@ -17,6 +17,8 @@ package jet
 import (
 	"bytes"
 	"fmt"
+	"strings"
+
 	"github.com/CloudyKit/jet/v6/errors"
 )
 
@@ -27,6 +29,7 @@ type Node interface {
 	String() string
 	Position() Pos
 	line() int
+	base() *NodeBase
 	error(errors.Reason, errors.Message) errors.Error
 }
 
@@ -57,15 +60,28 @@ func (n *NodeBase) line() int {
 	return n.Line
 }
 
+func (n *NodeBase) base() *NodeBase {
+	return n
+}
+
+func (n *NodeBase) column() int {
+	return n.Item.col
+}
+
 func (n *NodeBase) error(reason errors.Reason, message errors.Message) errors.Error {
 	if reason == "" {
 		reason = errors.RuntimeErrorReason
 	}
+	line := n.Line
+	if line == 0 {
+		// leaf nodes like fields and numbers only have the position of their token
+		line = n.Item.row
+	}
 	return errors.Build(
 		reason,
 		n.TemplatePath,
 		message,
-		errors.Position{L: n.Line, C: n.Item.col},
+		errors.Position{L: line, C: n.Item.col},
 	)
 }
 
@@ -113,7 +129,13 @@ const (
 	NodeTernaryExpr
 	NodeIndexExpr
 	NodeSliceExpr
+	nodeValue // An evaluated value passed by compiled templates. Not added to tree.
 	endExpressions
+	NodeTrans    // A trans statement.
+	NodeMsg      // A msg block.
+	NodeBreak    // A break action.
+	NodeContinue // A continue action.
+	NodeFlush    // A flush action.
 )
 
 // Nodes.
@@ -174,6 +196,8 @@ type ActionNode struct {
 	NodeBase
 	Set  *SetNode
 	Pipe *PipeNode
+
+	escapee SafeWriter // set by contextual escaping, overrides the Set's escapee
 }
 
 func (a *ActionNode) String() string {
@@ -267,6 +291,14 @@ func (i Idents) names() []string {
 	return names
 }
 
+// prefix returns the expression base followed by the first n identifiers, like ".User" or "$user.Profile".
+func (i Idents) prefix(base string, n int) string {
+	if n == 0 && base != "" {
+		return base
+	}
+	return base + "." + strings.Join(i.names()[:n], ".")
+}
+
 func (f *FieldNode) String() string {
 	s := ""
 	for _, id := range f.Idents {
@@ -568,6 +600,9 @@ type BlockNode struct {
 
 	List    *ListNode
 	Content *ListNode
+
+	escapeCtx escapeContext // context the block is rendered in, recorded by contextual escaping
+	escaped   bool
 }
 
 func (t *BlockNode) String() string {
@@ -756,6 +791,33 @@ func (n *ReturnNode) String() string {
 	return fmt.Sprintf("return %v", n.Value)
 }
 
+// BreakNode represents a {{break}} action, ending the innermost range loop.
+type BreakNode struct {
+	NodeBase
+}
+
+func (n *BreakNode) String() string {
+	return "{{break}}"
+}
+
+// ContinueNode represents a {{continue}} action, skipping to the next iteration of the innermost range loop.
+type ContinueNode struct {
+	NodeBase
+}
+
+func (n *ContinueNode) String() string {
+	return "{{continue}}"
+}
+
+// FlushNode represents a {{flush}} action, flushing the output written so far.
+type FlushNode struct {
+	NodeBase
+}
+
+func (n *FlushNode) String() string {
+	return "{{flush}}"
+}
+
 type TryNode struct {
 	NodeBase
 	List  *ListNode
@@ -778,3 +840,34 @@ type catchNode struct {
 func (n *catchNode) String() string {
 	return fmt.Sprintf("{{catch %s}}%s{{end}}", n.Err, n.List)
 }
+
+// TranslationNode represents a {{trans}} statement or a {{msg}}...{{end}} block.
+type TranslationNode struct {
+	NodeBase
+	Key        Expression
+	Count      Expression // optional, selects the plural form
+	Parameters []BlockParameter
+	List       *ListNode // fallback content of msg blocks, rendered when no translation is found
+
+	escapee SafeWriter // set by contextual escaping, overrides the Set's escapee
+}
+
+func (n *TranslationNode) String() string {
+	var buf bytes.Buffer
+	keyword := "trans"
+	if n.NodeType == NodeMsg {
+		keyword = "msg"
+	}
+	fmt.Fprintf(&buf, "{{%s %s", keyword, n.Key)
+	if n.Count != nil {
+		fmt.Fprintf(&buf, " %s", n.Count)
+	}
+	for _, p := range n.Parameters {
+		fmt.Fprintf(&buf, " %s=%s", p.Identifier, p.Expression)
+	}
+	buf.WriteString("}}")
+	if n.NodeType == NodeMsg {
+		fmt.Fprintf(&buf, "%s{{end}}", n.List)
+	}
+	return buf.String()
+}
@@ -42,11 +42,23 @@ type Template struct {
 
 	text string // text parsed to create the template (or its parent)
 
+	compiled RenderFunc // set for templates compiled to Go code, which have an empty Root
+	syntax   *Syntax    // set for templates parsed by a Set created WithSyntax
+
+	dependencies  []Dependency // references to other templates, without the paths of included templates
+	generation    uint64       // watchState generation the template was loaded in
+	invalidations uint64       // Set.invalidations when the template was loaded
+
 	// Parsing only; cleared after parse.
 	lex             *lexer
 	curToken        item
 	lookaheadTokens [3]item // three-token lookahead for parser.
 	peekCount       int
+	loopDepth       int     // number of range bodies enclosing the current position
+	flight          *flight // load of the template by the Set, nil for templates passed to Set.Parse
+
+	// Contextual escaping only; cleared after escaping.
+	escapeLoops []escapeContext // contexts the range bodies enclosing the current node start in
 }
 
 func (t *Template) String() (template string) {
@@ -76,6 +88,17 @@ func (t *Template) String() (template string) {
 	return
 }
 
+// Blocks returns the blocks a yield in the template can refer to by name: the blocks the template declares,
+// and those of the templates it imports and extends. Blocks of the template take precedence over imported
+// ones, which take precedence over those of the extended template.
+func (t *Template) Blocks() map[string]*BlockNode {
+	blocks := make(map[string]*BlockNode, len(t.processedBlocks))
+	for name, block := range t.processedBlocks {
+		blocks[name] = block
+	}
+	return blocks
+}
+
 func (t *Template) addBlocks(blocks map[string]*BlockNode) {
 	if len(blocks) == 0 {
 		return
@@ -244,22 +267,42 @@ func (t *Template) recover(errp *error) {
 }
 
 func (s *Set) parse(name, text string, cacheAfterParsing bool) (t *Template, err errors.Error) {
+	return s.parseIn(nil, name, text, cacheAfterParsing)
+}
+
+// parseIn parses text like parse, as part of the load f of the template.
+func (s *Set) parseIn(f *flight, name, text string, cacheAfterParsing bool) (t *Template, err errors.Error) {
 	t = &Template{
 		Name:         name,
 		ParseName:    name,
 		text:         text,
 		set:          s,
 		passedBlocks: make(map[string]*BlockNode),
+		flight:       f,
 	}
 
 	lexer := newLexer(name, text, false)
 	lexer.setDelimiters(s.leftDelim, s.rightDelim)
+	lexer.trivia = s.keepSyntax
 	lexer.lex()
 	t.startParse(lexer)
 	if _, err = t.parseTemplate(cacheAfterParsing); err != nil {
+		if err.Template() == name && len(err.Snippet()) == 0 && err.Position().L > 0 {
+			err.WithSnippet(errors.NewSnippet(text, err.Position().L, 2))
+		}
 		return nil, err
 	}
 	t.stopParse()
+	t.findIncludes(t.Root)
+	if s.keepSyntax {
+		t.syntax = newSyntax(lexer.items)
+	}
+
+	if s.contextualEscaping {
+		if err = t.escape(); err != nil {
+			return nil, err
+		}
+	}
 
 	if t.extends != nil {
 		t.addBlocks(t.extends.processedBlocks)
@@ -310,16 +353,18 @@ func (t *Template) parseTemplate(cacheAfterParsing bool) (next Node, err errors.
 						return nil, t.error(errors.UnexpectedClauseReason, "Unexpected extends clause: the 'extends' clause should come before all import clauses")
 					}
 					var err error
-					t.extends, err = t.set.getSiblingTemplate(s, t.Name, cacheAfterParsing)
+					t.extends, err = t.set.includeTemplate(t.flight, s, t.Name, cacheAfterParsing)
 					if err != nil {
-						return nil, t.error("", err.Error())
+						return nil, t.error(includeError(err))
 					}
+					t.addDependency(DependencyExtends, s, token.pos, false).Path = t.extends.Name
 				} else {
-					tt, err := t.set.getSiblingTemplate(s, t.Name, cacheAfterParsing)
+					tt, err := t.set.includeTemplate(t.flight, s, t.Name, cacheAfterParsing)
 					if err != nil {
-						return nil, t.error("", err.Error())
+						return nil, t.error(includeError(err))
 					}
 					t.imports = append(t.imports, tt)
+					t.addDependency(DependencyImport, s, token.pos, false).Path = tt.Name
 				}
 				if err = t.expect(itemRightDelim, "extends|import", "closing delimiter"); err != nil {
 					return nil, err
@@ -358,6 +403,7 @@ func (t *Template) startParse(lex *lexer) {
 // stopParse terminates parsing.
 func (t *Template) stopParse() {
 	t.lex = nil
+	t.flight = nil
 }
 
 // IsEmptyTree reports whether this tree (node) is empty of everything but space.
@@ -380,6 +426,10 @@ func IsEmptyTree(n Node) bool {
 		return len(bytes.TrimSpace(n.Text)) == 0
 	case *BlockNode:
 	case *YieldNode:
+	case *TranslationNode:
+	case *BreakNode:
+	case *ContinueNode:
+	case *FlushNode:
 	default:
 		panic("unknown node: " + n.String())
 	}
@@ -470,6 +520,11 @@ func (t *Template) parseBlock() (Node, errors.Error) {
 		return nil, err
 	}
 
+	// blocks can be yielded anywhere, so loops around them can't be controlled from inside
+	loopDepth := t.loopDepth
+	t.loopDepth = 0
+	defer func() { t.loopDepth = loopDepth }()
+
 	list, end, err := t.itemList(nodeContent, nodeEnd)
 	if err != nil {
 		return nil, err
@@ -548,7 +603,10 @@ func (t *Template) parseYield() (Node, errors.Error) {
 			if err := t.expectRightDelim(context); err != nil {
 				return nil, err
 			}
+			loopDepth := t.loopDepth
+			t.loopDepth = 0
 			content, _, err = t.itemList(nodeEnd)
+			t.loopDepth = loopDepth
 			if err != nil {
 				return nil, err
 			}
@@ -579,6 +637,17 @@ func (t *Template) parseInclude() (Node, errors.Error) {
 	return t.newInclude(name.Position(), t.lex.lineNumber(), name, context), nil
 }
 
+// parseLoopControl parses {{break}} and {{continue}} inside range bodies.
+func (t *Template) parseLoopControl(token item) (Node, errors.Error) {
+	if err := t.expectRightDelim(token.val); err != nil {
+		return nil, err
+	}
+	if token.kind == itemBreak {
+		return t.newBreak(token.pos, t.lex.lineNumber()), nil
+	}
+	return t.newContinue(token.pos, t.lex.lineNumber()), nil
+}
+
 func (t *Template) parseReturn() (Node, errors.Error) {
 	value, err := t.expression("return", "value")
 	if err != nil {
@@ -590,6 +659,58 @@ func (t *Template) parseReturn() (Node, errors.Error) {
 	return t.newReturn(value.Position(), t.lex.lineNumber(), value), nil
 }
 
+// parseTranslation parses {{trans key [count] [name=expr ...]}} and {{msg key [count] [name=expr ...]}}...{{end}}.
+func (t *Template) parseTranslation(keyword item) (Node, errors.Error) {
+	context := keyword.val + " clause"
+	nodeType := NodeTrans
+	if keyword.kind == itemMSG {
+		nodeType = NodeMsg
+	}
+
+	key, err := t.expression(context, "message key")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		count      Expression
+		parameters []BlockParameter
+	)
+	for t.peekNonSpace().kind != itemRightDelim {
+		if next := t.nextNonSpace(); next.kind == itemIdentifier {
+			if next2 := t.nextNonSpace(); next2.kind == itemAssign {
+				value, err := t.expression(context, "parameter value")
+				if err != nil {
+					return nil, err
+				}
+				parameters = append(parameters, BlockParameter{Identifier: next.val, Expression: value})
+				continue
+			}
+			t.backup2(next)
+		} else {
+			t.backup()
+		}
+		if count != nil || len(parameters) > 0 {
+			return nil, t.unexpected(t.nextNonSpace(), context, "named parameter or closing delimiter")
+		}
+		if count, err = t.expression(context, "count"); err != nil {
+			return nil, err
+		}
+	}
+	if err = t.expectRightDelim(context); err != nil {
+		return nil, err
+	}
+
+	var list *ListNode
+	if nodeType == NodeMsg {
+		if list, _, err = t.itemList(nodeEnd); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.newTranslation(keyword.pos, t.lex.lineNumber(), nodeType, key, count, parameters, list), nil
+}
+
 // itemList:
 //
 //	textOrAction*
@@ -651,6 +772,18 @@ func (t *Template) action() (n Node, err errors.Error) {
 		return t.parseCatch()
 	case itemReturn:
 		return t.parseReturn()
+	case itemTrans, itemMSG:
+		return t.parseTranslation(token)
+	case itemBreak, itemContinue:
+		if t.loopDepth > 0 {
+			return t.parseLoopControl(token)
+		}
+		// outside of range loops, {{ break }} and {{ continue }} print the variables of these names, see term
+	case itemFlush:
+		if err := t.expectRightDelim("flush"); err != nil {
+			return nil, err
+		}
+		return t.newFlush(token.pos, t.lex.lineNumber()), nil
 	}
 
 	t.backup()
@@ -1194,7 +1327,13 @@ func (t *Template) parseControl(allowElseIf bool, context string) (pos Pos, line
 	}
 	var next Node
 	var ifControl Node
+	if context == "range" {
+		t.loopDepth++
+	}
 	list, next, err = t.itemList(nodeElse, nodeEnd)
+	if context == "range" {
+		t.loopDepth--
+	}
 	if err != nil {
 		return
 	}
@@ -1377,6 +1516,9 @@ func (t *Template) term() (Node, errors.Error) {
 		return nil, t.error("item.error", fmt.Sprintf("%s", token.val))
 	case itemIdentifier:
 		return t.newIdentifier(token.val, token.pos, t.lex.lineNumber()), nil
+	case itemBreak, itemContinue:
+		// the lexer emits these only for whole actions, which action parses as loop control inside of range loops
+		return t.newIdentifier(token.val, token.pos, t.lex.lineNumber()), nil
 	case itemUnderscore:
 		return t.newUnderscore(token.pos, t.lex.lineNumber()), nil
 	case itemNil:
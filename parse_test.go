@@ -130,6 +130,16 @@ func TestKeywordsDisallowedAsBlockNames(t *testing.T) {
 	p.ExpectError(templateName, `{{ block if() }}bla{{ end }}`, expectedError.Error())
 }
 
+func TestBreakContinueIdentifiers(t *testing.T) {
+	p := ParserTestCase{T: t}
+
+	p.ExpectPrint(`{{range items}}{{if .Done}}{{continue}}{{end}}{{try}}{{break}}{{end}}{{end}}`, `{{range items}}{{if .Done}}{{continue}}{{end}}{{try}}{{break}}{{end}}{{end}}`)
+	// break and continue are only keywords when they are the whole action inside of a range loop
+	p.ExpectPrint(`{{ break := 1 }}{{ break }}{{ continue }}`, `{{break:=1}}{{break}}{{continue}}`)
+	p.ExpectPrint(`{{range items}}{{ break + 1 }}{{- break -}}{{ continue(1) }}{{end}}`, `{{range items}}{{break + 1}}{{break}}{{continue(1)}}{{end}}`)
+	p.ExpectPrint(`{{ range items }}{{ block b() }}{{ break }}{{ end }}{{ end }}`, `{{range items}}{{block b()}}{{break}}{{end}}{{end}}`)
+}
+
 func TestParseTemplateControl(t *testing.T) {
 	p := ParserTestCase{T: t}
 	p.TestPrintFile("if.jet")
@@ -159,6 +169,11 @@ func TestParseTemplateAssignment(t *testing.T) {
 	p.TestPrintFile("assignment.jet")
 }
 
+func TestParseTemplateTranslation(t *testing.T) {
+	p := ParserTestCase{T: t}
+	p.TestPrintFile("translation.jet")
+}
+
 func TestParseTemplateWithCustomDelimiters(t *testing.T) {
 	set := NewSet(
 		NewOSFileSystemLoader("./testData"),
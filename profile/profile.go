@@ -0,0 +1,285 @@
+// Package profile aggregates the traces of template executions into profiles, to find the blocks,
+// includes, loops and function calls that make templates slow. A Profiler is a jet.Tracer:
+//
+//	profiler := profile.New()
+//	views := jet.NewSet(loader, jet.WithTracer(profiler))
+//	// execute templates…
+//	profiler.WriteProfile(f)
+//
+// The profile is in the format of pprof, with the template paths as files and the template lines
+// as lines, so `go tool pprof -http=: profile.pb.gz` shows the time spent in each part of the
+// templates, as a graph, as a flame graph or next to the template source with the list command when run
+// in the templates directory. WriteFolded writes folded stacks for other flame graph tools.
+package profile
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// Profiler is a jet.Tracer aggregating the number of calls and the time spent in templates, blocks,
+// yields, includes, range loops and function calls by their stack. It's safe for concurrent use.
+type Profiler struct {
+	mx    sync.Mutex
+	root  *node
+	start time.Time
+}
+
+// frame is an event by its position.
+type frame struct {
+	kind jet.TraceKind
+	name string
+	path string
+	line int
+}
+
+func (f frame) String() string {
+	return f.kind.String() + " " + f.name
+}
+
+// node is a frame in the tree of stacks.
+type node struct {
+	frame    frame
+	parent   *node
+	children map[frame]*node
+	calls    int64
+	self     time.Duration
+}
+
+// New returns a new Profiler.
+func New() *Profiler {
+	p := &Profiler{}
+	p.Reset()
+	return p
+}
+
+// Reset discards the aggregated data, starting a new profile.
+func (p *Profiler) Reset() {
+	p.mx.Lock()
+	p.root = &node{children: map[frame]*node{}}
+	p.start = time.Now()
+	p.mx.Unlock()
+}
+
+// Enter implements jet.Tracer.
+func (p *Profiler) Enter(_ *jet.Runtime, ev *jet.TraceEvent) {
+	f := frame{kind: ev.Kind, name: ev.Name, path: ev.TemplatePath, line: ev.Line}
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	parent := p.root
+	if ev.Parent != nil {
+		if n, ok := ev.Parent.Data.(*node); ok {
+			parent = n
+		}
+	}
+	n, ok := parent.children[f]
+	if !ok {
+		n = &node{frame: f, parent: parent, children: map[frame]*node{}}
+		parent.children[f] = n
+	}
+	ev.Data = n
+}
+
+// Exit implements jet.Tracer.
+func (p *Profiler) Exit(_ *jet.Runtime, ev *jet.TraceEvent) {
+	n, ok := ev.Data.(*node)
+	if !ok {
+		return
+	}
+	p.mx.Lock()
+	n.calls++
+	n.self += ev.Self()
+	p.mx.Unlock()
+}
+
+// walk calls fn with every node and its stack, from the root to the node, in a stable order.
+func (p *Profiler) walk(fn func(n *node, stack []*node)) {
+	var visit func(n *node, stack []*node)
+	visit = func(n *node, stack []*node) {
+		stack = append(stack, n)
+		fn(n, stack)
+		frames := make([]frame, 0, len(n.children))
+		for f := range n.children {
+			frames = append(frames, f)
+		}
+		sort.Slice(frames, func(i, j int) bool {
+			a, b := frames[i], frames[j]
+			if a.path != b.path {
+				return a.path < b.path
+			}
+			if a.line != b.line {
+				return a.line < b.line
+			}
+			return a.String() < b.String()
+		})
+		for _, f := range frames {
+			visit(n.children[f], stack)
+		}
+	}
+	for _, n := range p.sortedRoots() {
+		visit(n, nil)
+	}
+}
+
+func (p *Profiler) sortedRoots() []*node {
+	roots := make([]*node, 0, len(p.root.children))
+	for _, n := range p.root.children {
+		roots = append(roots, n)
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].frame.String() < roots[j].frame.String() })
+	return roots
+}
+
+// WriteFolded writes the profile as folded stacks, one line for every stack with the frames from the
+// executed template to the innermost event separated by semicolons, followed by the time spent in the
+// innermost event in nanoseconds:
+//
+//	template /index.jet;yield body (/index.jet:3);func upper (/index.jet:4) 5120
+//
+// This is the input format of flamegraph.pl and speedscope, among other flame graph tools.
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	bw := bufio.NewWriter(w)
+	p.walk(func(n *node, stack []*node) {
+		if n.self <= 0 {
+			return
+		}
+		for i, n := range stack {
+			if i > 0 {
+				bw.WriteByte(';')
+			}
+			name := n.frame.String()
+			if n.frame.kind != jet.TraceTemplate {
+				name += fmt.Sprintf(" (%s:%d)", n.frame.path, n.frame.line)
+			}
+			bw.WriteString(strings.Replace(name, ";", ",", -1))
+		}
+		fmt.Fprintf(bw, " %d\n", n.self.Nanoseconds())
+	})
+	return bw.Flush()
+}
+
+// WriteProfile writes the profile in the gzipped protocol buffer format of pprof. Every sample is a
+// stack with two values, the number of calls and the time spent in the innermost event in nanoseconds.
+// The functions of the profile are the events by name, like "block card" or "include /footer.jet",
+// located at the template path and line of the statement.
+func (p *Profiler) WriteProfile(w io.Writer) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	var b protoBuffer
+	strs := map[string]int{"": 0}
+	table := []string{""}
+	str := func(s string) int64 {
+		i, ok := strs[s]
+		if !ok {
+			i = len(table)
+			strs[s] = i
+			table = append(table, s)
+		}
+		return int64(i)
+	}
+
+	valueType := func(typ, unit string) protoBuffer {
+		var v protoBuffer
+		v.int(1, str(typ))
+		v.int(2, str(unit))
+		return v
+	}
+	b.message(1, valueType("calls", "count"))
+	b.message(1, valueType("time", "nanoseconds"))
+
+	type function struct{ name, path string }
+	functions := map[function]uint64{}
+	locations := map[*node]uint64{}
+	var functionsBuf, locationsBuf protoBuffer
+	p.walk(func(n *node, stack []*node) {
+		f := function{n.frame.String(), n.frame.path}
+		fid, ok := functions[f]
+		if !ok {
+			fid = uint64(len(functions) + 1)
+			functions[f] = fid
+			var fn protoBuffer
+			fn.uint(1, fid)
+			fn.int(2, str(f.name))
+			fn.int(3, str(f.name))
+			fn.int(4, str(f.path))
+			functionsBuf.message(5, fn)
+		}
+		lid := uint64(len(locations) + 1)
+		locations[n] = lid
+		var line, loc protoBuffer
+		line.uint(1, fid)
+		line.int(2, int64(n.frame.line))
+		loc.uint(1, lid)
+		loc.message(4, line)
+		locationsBuf.message(4, loc)
+
+		if n.calls == 0 {
+			return
+		}
+		var sample, ids, values protoBuffer
+		for i := len(stack) - 1; i >= 0; i-- {
+			ids.varint(locations[stack[i]])
+		}
+		values.varint(uint64(n.calls))
+		values.varint(uint64(n.self.Nanoseconds()))
+		sample.bytes(1, ids)
+		sample.bytes(2, values)
+		b.message(2, sample)
+	})
+	b = append(b, locationsBuf...)
+	b = append(b, functionsBuf...)
+	b.int(9, p.start.UnixNano())
+	b.int(10, int64(time.Since(p.start)))
+	b.message(11, valueType("time", "nanoseconds"))
+	b.int(12, 1)
+	for _, s := range table {
+		b.bytes(6, []byte(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// protoBuffer encodes protocol buffer messages.
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		*b = append(*b, byte(x)|0x80)
+		x >>= 7
+	}
+	*b = append(*b, byte(x))
+}
+
+func (b *protoBuffer) uint(field int, x uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int(field int, x int64) {
+	b.uint(field, uint64(x))
+}
+
+func (b *protoBuffer) bytes(field int, p []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(p)))
+	*b = append(*b, p...)
+}
+
+func (b *protoBuffer) message(field int, m protoBuffer) {
+	b.bytes(field, m)
+}
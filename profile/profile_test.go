@@ -0,0 +1,78 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func profiledSet(t *testing.T) (*Profiler, *jet.Template) {
+	l := jet.NewInMemLoader()
+	l.Set("/footer.jet", "<footer></footer>")
+	l.Set("/index.jet", "{{ block body() }}{{ range items }}{{ upper(.) }}{{ end }}{{ end }}\n{{ include \"footer\" }}")
+	profiler := New()
+	tt, err := jet.NewSet(l, jet.WithTracer(profiler)).GetTemplate("/index.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := tt.Execute(ioutil.Discard, jet.VarMap{}.Set("items", []string{"a", "b"}), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return profiler, tt
+}
+
+func TestWriteFolded(t *testing.T) {
+	profiler, _ := profiledSet(t)
+	var buf bytes.Buffer
+	if err := profiler.WriteFolded(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var stacks []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		stacks = append(stacks, line[:strings.LastIndexByte(line, ' ')])
+	}
+	expected := []string{
+		"template /index.jet",
+		"template /index.jet;block body (/index.jet:1)",
+		"template /index.jet;block body (/index.jet:1);range items (/index.jet:1)",
+		"template /index.jet;block body (/index.jet:1);range items (/index.jet:1);func upper (/index.jet:1)",
+		"template /index.jet;include /footer.jet (/index.jet:2)",
+	}
+	if strings.Join(stacks, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected stacks\n%s\ngot\n%s", strings.Join(expected, "\n"), buf.String())
+	}
+
+	profiler.Reset()
+	buf.Reset()
+	profiler.WriteFolded(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("expected no stacks after Reset, got %s", buf.String())
+	}
+}
+
+func TestWriteProfile(t *testing.T) {
+	profiler, _ := profiledSet(t)
+	var buf bytes.Buffer
+	if err := profiler.WriteProfile(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"calls", "nanoseconds", "func upper", "include /footer.jet", "/index.jet"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("expected %q in the string table of the profile", s)
+		}
+	}
+}
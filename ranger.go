@@ -115,7 +115,8 @@ func (r *mapRanger) Range() (key, value reflect.Value, end bool) {
 func (r *mapRanger) ProvidesIndex() bool { return true }
 
 type chanRanger struct {
-	v reflect.Value
+	v    reflect.Value
+	done <-chan struct{} // ends the loop when closed, e.g. when the execution is cancelled
 }
 
 var (
@@ -125,11 +126,20 @@ var (
 
 func (r *chanRanger) Setup(v reflect.Value) {
 	r.v = v
+	r.done = nil
 }
 
 func (r *chanRanger) Range() (_, value reflect.Value, end bool) {
-	v, ok := r.v.Recv()
-	value, end = v, !ok
+	if r.done == nil {
+		v, ok := r.v.Recv()
+		value, end = v, !ok
+		return
+	}
+	chosen, v, ok := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: r.v},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(r.done)},
+	})
+	value, end = v, chosen != 0 || !ok
 	return
 }
 
@@ -0,0 +1,295 @@
+package jet
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+// Sandbox is a policy restricting what templates can do, for templates written by untrusted users, like
+// customers writing their own emails. See WithSandbox.
+type Sandbox struct {
+	// Types lists the struct types whose exported fields templates may read or print, with or without
+	// pointer. Values of other types can be compared, indexed and ranged over, but templates can't access
+	// their fields or print them, not even within slices and maps, unless they implement fmt.Stringer or
+	// error.
+	Types []reflect.Type
+	// Methods lists the methods templates may call by type and name, like "time.Time.Format", or all
+	// methods of a type, like "time.Time.*". Types are written as printed by reflect.Type's String
+	// method, without pointer; methods of pointer receivers are listed with the element type.
+	Methods []string
+	// DeniedMethods lists methods templates may never call, even when listed in Methods, by type and
+	// name or by name only for methods of any type, like "*.Delete".
+	DeniedMethods []string
+	// Funcs lists the names of the functions templates may call: globals, variables and built-ins, see
+	// SafeBuiltins. Functions have to be called by these names; functions stored in fields, maps, slices
+	// or channels and functions returned by functions can't be read or called.
+	Funcs []string
+	// Includes lists the patterns, as matched by path.Match, of the templates that may be extended,
+	// imported or included, with include, exec() or includeIfExists(). Paths are matched after resolving
+	// them relative to the including template, with and without extension.
+	Includes []string
+	// Limits are the limits of executions, merged with the limits passed with WithLimits: the stricter
+	// value of every limit applies.
+	Limits Limits
+}
+
+// SafeBuiltins are the built-ins sandboxed templates can use without access to other templates, to the
+// values of the execution or to the fields of values of types not allowed, and without bypassing the
+// escaping of the Set: all but exec, includeIfExists, dump, json, writeJson, raw, unsafe and safeHtml.
+var SafeBuiltins = []string{
+	"lower", "upper", "hasPrefix", "hasSuffix", "repeat", "replace", "split", "trimSpace",
+	"html", "url", "safeJs",
+	"map", "slice", "array", "isset", "len", "ints",
+}
+
+// WithSandbox returns an option function that makes the Set execute templates with the restrictions of
+// sandbox. Violations fail the execution, or the parsing of templates extending or importing other
+// templates, with errors.Error values with the reasons errors.SandboxTypeReason, errors.SandboxMethodReason,
+// errors.SandboxFuncReason and errors.SandboxIncludeReason. The Set doesn't use templates compiled to Go code.
+func WithSandbox(sandbox Sandbox) Option {
+	return func(s *Set) {
+		p := &sandboxPolicy{
+			types:    map[reflect.Type]bool{},
+			methods:  map[string]bool{},
+			denied:   map[string]bool{},
+			funcs:    map[string]bool{},
+			includes: sandbox.Includes,
+		}
+		for _, typ := range sandbox.Types {
+			if typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+			p.types[typ] = true
+		}
+		for _, m := range sandbox.Methods {
+			p.methods[m] = true
+		}
+		for _, m := range sandbox.DeniedMethods {
+			p.denied[m] = true
+		}
+		for _, f := range sandbox.Funcs {
+			p.funcs[f] = true
+		}
+		s.sandbox = p
+		s.limits = s.limits.merge(sandbox.Limits)
+	}
+}
+
+type sandboxPolicy struct {
+	types    map[reflect.Type]bool
+	methods  map[string]bool
+	denied   map[string]bool
+	funcs    map[string]bool
+	includes []string
+}
+
+// checkMember checks the access to the field or method name of v.
+func (p *sandboxPolicy) checkMember(v reflect.Value, name string) errors.Error {
+	if !v.IsValid() || name == "" {
+		return nil
+	}
+	v, _ = indirect(v)
+	typ := v.Type()
+	methods := typ
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	} else if typ.Kind() != reflect.Interface {
+		methods = reflect.PtrTo(typ)
+	}
+	if _, ok := methods.MethodByName(name); ok {
+		typeName := typ.String()
+		if (p.methods[typeName+"."+name] || p.methods[typeName+".*"]) && !p.denied[typeName+"."+name] && !p.denied["*."+name] {
+			return nil
+		}
+		return errors.New().
+			WithReason(errors.SandboxMethodReason).
+			WithMessage(fmt.Sprintf("method %s of %s is not allowed", name, typeName))
+	}
+	if typ.Kind() == reflect.Struct && !p.types[typ] {
+		return errors.New().
+			WithReason(errors.SandboxTypeReason).
+			WithMessage(fmt.Sprintf("fields of %s are not allowed", typ))
+	}
+	return nil
+}
+
+// checkFunc checks the access to the function v resolved by name.
+func (p *sandboxPolicy) checkFunc(name string, v reflect.Value) errors.Error {
+	if v.Kind() != reflect.Func || p.funcs[name] {
+		return nil
+	}
+	return errors.New().
+		WithReason(errors.SandboxFuncReason).
+		WithMessage(fmt.Sprintf("function %s is not allowed", name))
+}
+
+// checkIndexed checks the value resolved by indexing v with the field, method or key name: functions
+// can only be read as methods.
+func (p *sandboxPolicy) checkIndexed(v reflect.Value, name string, resolved reflect.Value) errors.Error {
+	if !resolved.IsValid() || indirectEface(resolved).Kind() != reflect.Func {
+		return nil
+	}
+	if v, _ = indirect(v); v.IsValid() && name != "" {
+		if _, ok := v.Type().MethodByName(name); ok {
+			return nil
+		}
+		if v.Kind() != reflect.Interface && v.Kind() != reflect.Ptr {
+			if _, ok := reflect.PtrTo(v.Type()).MethodByName(name); ok {
+				return nil
+			}
+		}
+	}
+	return errors.New().
+		WithReason(errors.SandboxFuncReason).
+		WithMessage(fmt.Sprintf("reading functions from %s is not allowed: functions have to be called by name", getTypeString(v)))
+}
+
+// checkRanged checks a value ranged over: functions can't be read from collections.
+func (p *sandboxPolicy) checkRanged(v reflect.Value) errors.Error {
+	if !v.IsValid() || indirectEface(v).Kind() != reflect.Func {
+		return nil
+	}
+	return errors.New().
+		WithReason(errors.SandboxFuncReason).
+		WithMessage("ranging over functions is not allowed: functions have to be called by name")
+}
+
+// checkCallee checks the expression callee of a call: functions have to be called by name or as methods,
+// which are checked when they're resolved, not as the result of other expressions.
+func (p *sandboxPolicy) checkCallee(callee Expression) errors.Error {
+	switch callee.(type) {
+	case *IdentifierNode, *FieldNode, *ChainNode:
+		return nil
+	}
+	return errors.New().
+		WithReason(errors.SandboxFuncReason).
+		WithMessage(fmt.Sprintf("calling %s is not allowed: functions have to be called by name", callee))
+}
+
+// checkPrint checks printing v: the fields of struct types that aren't allowed can't be printed. Like
+// fmt, it only follows pointers to the value printed, and values implementing fmt.Stringer or error are
+// printed with their method.
+func (p *sandboxPolicy) checkPrint(v reflect.Value, top bool) errors.Error {
+	if v.IsValid() && v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	for i := 0; top && i < 3 && v.IsValid() && v.Kind() == reflect.Ptr && !v.IsNil() && !printsItself(v); i++ {
+		v = v.Elem()
+	}
+	if !v.IsValid() || printsItself(v) {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if !p.types[v.Type()] {
+			return errors.New().
+				WithReason(errors.SandboxTypeReason).
+				WithMessage(fmt.Sprintf("printing fields of %s is not allowed", v.Type()))
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if err := p.checkPrint(v.Field(i), false); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := p.checkPrint(v.Index(i), false); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := p.checkPrint(iter.Key(), false); err != nil {
+				return err
+			}
+			if err := p.checkPrint(iter.Value(), false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkPrint checks printing v at node against the sandbox, if any.
+func (rt *Runtime) checkPrint(v reflect.Value, node Node) errors.Error {
+	if p := rt.set.sandbox; p != nil {
+		if err := p.checkPrint(v, true); err != nil {
+			return node.error(err.Reason(), err.Message())
+		}
+	}
+	return nil
+}
+
+// printsItself reports whether v is printed by its String or Error method.
+func printsItself(v reflect.Value) bool {
+	return v.CanInterface() && (v.Type().Implements(stringerType) || v.Type().Implements(errorType))
+}
+
+// checkInclude checks the inclusion of the template at templatePath, an absolute path.
+func (s *Set) checkInclude(templatePath string) errors.Error {
+	if s.sandbox == nil {
+		return nil
+	}
+	for _, pattern := range s.sandbox.includes {
+		if ok, _ := path.Match(pattern, templatePath); ok {
+			return nil
+		}
+		for _, extension := range s.extensions {
+			if ok, _ := path.Match(pattern, templatePath+extension); ok {
+				return nil
+			}
+		}
+	}
+	return errors.New().
+		WithReason(errors.SandboxIncludeReason).
+		WithMessage(fmt.Sprintf("including template %s is not allowed", templatePath))
+}
+
+// includeTemplate returns the template at templatePath included by the template at siblingPath, which is
+// being loaded by from when it extends or imports the template.
+func (s *Set) includeTemplate(from *flight, templatePath, siblingPath string, cacheAfterParsing bool) (*Template, error) {
+	templatePath = resolveSibling(templatePath, siblingPath)
+	if err := s.checkInclude(templatePath); err != nil {
+		return nil, err
+	}
+	return s.getTemplate(from, templatePath, cacheAfterParsing)
+}
+
+// resolveIndex resolves the index of v like resolveIndex, checking field and method accesses against the sandbox.
+func (rt *Runtime) resolveIndex(v, index reflect.Value, indexAsStr string, lax bool) (reflect.Value, errors.Error) {
+	if p := rt.set.sandbox; p != nil {
+		name := indexAsStr
+		if name == "" && index.Kind() == reflect.String {
+			name = index.String()
+		}
+		if err := p.checkMember(v, name); err != nil {
+			return reflect.Value{}, err
+		}
+		resolved, err := resolveIndex(v, index, indexAsStr, lax)
+		if err == nil {
+			err = p.checkIndexed(v, name, resolved)
+		}
+		return resolved, err
+	}
+	return resolveIndex(v, index, indexAsStr, lax)
+}
+
+// isSandboxError reports whether err is a violation of the sandbox.
+func isSandboxError(err error) bool {
+	jetErr, ok := err.(errors.Error)
+	return ok && strings.HasPrefix(jetErr.Reason(), "sandbox.")
+}
+
+// includeError returns the reason and message of an error including a template, keeping the reason of
+// sandbox violations.
+func includeError(err error) (errors.Reason, errors.Message) {
+	if isSandboxError(err) {
+		return err.(errors.Error).Reason(), err.(errors.Error).Message()
+	}
+	return "", err.Error()
+}
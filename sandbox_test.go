@@ -0,0 +1,94 @@
+package jet
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+type sandboxUser struct {
+	Name string
+}
+
+func (u *sandboxUser) Greeting() string { return "Hello " + u.Name }
+
+func (u *sandboxUser) Delete() string { return "deleted" }
+
+type sandboxSecret struct {
+	Token string
+}
+
+func TestSandbox(t *testing.T) {
+	l := NewInMemLoader()
+	l.Set("/emails/footer.jet", "<footer>{{ upper(user.Name) }}</footer>")
+	l.Set("/secret.jet", "{{ secret.Token }}")
+	set := NewSet(l, WithSandbox(Sandbox{
+		Types:         []reflect.Type{reflect.TypeOf(sandboxUser{})},
+		Methods:       []string{"jet.sandboxUser.*"},
+		DeniedMethods: []string{"*.Delete"},
+		Funcs:         append([]string{"price"}, SafeBuiltins...),
+		Includes:      []string{"/emails/*"},
+		Limits:        Limits{MaxSteps: 100, MaxMemoryBytes: 1000},
+	}))
+	set.AddGlobal("price", func(cents int) string { return "$" + strings.Repeat("0", cents) })
+	vars := VarMap{}.
+		Set("user", &sandboxUser{Name: "Jane"}).
+		Set("secret", sandboxSecret{Token: "t0k3n"}).
+		Set("now", time.Now()).
+		Set("helpers", map[string]interface{}{"wipe": func() string { return "wiped" }}).
+		Set("funcs", []func() string{func() string { return "called" }})
+
+	for _, test := range []struct {
+		source, expected string
+		reason           errors.Reason
+	}{
+		{source: `{{ user.Name }}, {{ user.Greeting() }} {{ price(2) }}{{ include "/emails/footer" }}`, expected: "Jane, Hello Jane $00<footer>JANE</footer>"},
+		{source: `{{ m := map("a", 1) }}{{ m.a }} {{ len(slice(1, 2)) }}`, expected: "1 2"},
+		{source: "\n{{ user.Delete() }}", reason: errors.SandboxMethodReason},
+		{source: "\n{{ now.Unix() }}", reason: errors.SandboxMethodReason},
+		{source: "\n{{ secret.Token }}", reason: errors.SandboxTypeReason},
+		{source: "\n{{ exec(\"/emails/footer\") }}", reason: errors.SandboxFuncReason},
+		{source: "\n{{ f := dump }}", reason: errors.SandboxFuncReason},
+		{source: "\n{{ include \"/secret\" }}", reason: errors.SandboxIncludeReason},
+		{source: `{{ user }}`, expected: "{Jane}"},
+		{source: "\n{{ secret }}", reason: errors.SandboxTypeReason},
+		{source: "\n{{ slice(1, secret) }}", reason: errors.SandboxTypeReason},
+		{source: "\n{{ secret | safeJs }}", reason: errors.SandboxTypeReason},
+		{source: "\n{{ json(secret) }}", reason: errors.SandboxFuncReason},
+		{source: "\n{{ \"<b>\" | raw }}", reason: errors.SandboxFuncReason},
+		{source: "\n{{ helpers.wipe() }}", reason: errors.SandboxFuncReason},
+		{source: "\n{{ helpers[\"wipe\"]() }}", reason: errors.SandboxFuncReason},
+		{source: "\n{{ upper := helpers.wipe }}{{ upper() }}", reason: errors.SandboxFuncReason},
+		{source: "\n{{ funcs[0]() }}", reason: errors.SandboxFuncReason},
+		{source: "\n{{ range _, upper := helpers }}{{ upper() }}{{ end }}", reason: errors.SandboxFuncReason},
+		{source: "\n{{ range ints(0, 100) }}{{ . }}{{ end }}", reason: errors.StepLimitReason},
+		{source: "\n{{ try }}{{ price(2000) }}{{ end }}", reason: errors.MemoryLimitReason},
+		{source: "\n{{ s := \"\" }}{{ range ints(0, 20) }}{{ s = s + repeat(\"x\", 50) }}{{ end }}", reason: errors.MemoryLimitReason},
+	} {
+		tt, err := set.Parse("/emails/test.jet", test.source)
+		if err != nil {
+			t.Fatalf("%s: %v", test.source, err)
+		}
+		var buf bytes.Buffer
+		err = tt.Execute(&buf, vars, nil)
+		if test.reason == "" {
+			if err != nil || buf.String() != test.expected {
+				t.Errorf("%s: expected %q, got %q, %v", test.source, test.expected, buf.String(), err)
+			}
+			continue
+		}
+		jetErr, ok := err.(errors.Error)
+		if !ok || jetErr.Reason() != test.reason || jetErr.Position().L != 2 {
+			t.Errorf("%s: expected an error with reason %s at line 2, got %v", test.source, test.reason, err)
+		}
+	}
+
+	_, err := set.Parse("/emails/page.jet", `{{ extends "/secret" }}`)
+	if jetErr, ok := err.(errors.Error); !ok || jetErr.Reason() != errors.SandboxIncludeReason {
+		t.Errorf("expected extending a template to fail with reason %s, got %v", errors.SandboxIncludeReason, err)
+	}
+}
@@ -7,22 +7,42 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"text/template"
 )
 
 // Set is responsible to load, parse and cache templates.
 // Every Jet template is associated with a Set.
 type Set struct {
-	loader          Loader
-	cache           Cache
-	escapee         SafeWriter    // escapee to use at runtime
-	globals         VarMap        // global scope for this template set
-	gmx             *sync.RWMutex // global variables map mutex
-	extensions      []string
-	developmentMode bool
-	leftDelim       string
-	rightDelim      string
+	loaderVersion      uint64 // version of a VersionedLoader the cache is in sync with, first for 64-bit alignment
+	invalidations      uint64 // number of calls of invalidate and Purge
+	loader             Loader
+	cache              Cache
+	escapee            SafeWriter    // escapee to use at runtime
+	globals            VarMap        // global scope for this template set
+	gmx                *sync.RWMutex // global variables map mutex
+	extensions         []string
+	developmentMode    bool
+	contextualEscaping bool
+	translator         Translator
+	limits             Limits
+	autoFlush          bool
+	keepSyntax         bool
+	tracer             Tracer
+	sandbox            *sandboxPolicy
+	watch              *watchState
+	flights            map[string]*flight // loads in progress, by canonical path
+	flightMx           sync.Mutex
+	lookups            lookupCache // results of the lookups of templates in the loader
+	loaderMx           sync.Mutex
+	graph              map[string]*Template // templates loaded so far and not removed from the cache, for their dependencies
+	graphMx            sync.RWMutex
+	compiled           map[string]CompiledTemplate // templates compiled to Go code, by canonical path
+	types              map[string]reflect.Type     // types for the declarations of templates, by name
+	leftDelim          string
+	rightDelim         string
 }
 
 // Option is the type of option functions that can be used in NewSet().
@@ -40,6 +60,7 @@ func NewSet(loader Loader, opts ...Option) *Set {
 		escapee: template.HTMLEscape,
 		globals: VarMap{},
 		gmx:     &sync.RWMutex{},
+		lookups: lookupCache{size: defaultLookupCacheSize},
 		extensions: []string{
 			"", // in case the path is given with the correct extension already
 			".jet",
@@ -47,10 +68,24 @@ func NewSet(loader Loader, opts ...Option) *Set {
 			".jet.html",
 		},
 	}
+	l, versioned := loader.(VersionedLoader)
+	if versioned {
+		s.loaderVersion = l.Version()
+	}
 
 	for _, opt := range opts {
 		opt(s)
 	}
+	// without notifications of changes, templates added after a lookup would never be found
+	if versioned || s.watch != nil {
+		s.lookups.missingEnabled = true
+	}
+	if c, ok := s.cache.(CacheNotifier); ok {
+		c.NotifyRemoved(func(_ string, t *Template) {
+			s.removeDependencies(t)
+		})
+	}
+	s.watchChanges()
 
 	return s
 }
@@ -75,6 +110,17 @@ func WithSafeWriter(w SafeWriter) Option {
 	}
 }
 
+// WithContextualEscaping returns an option function that turns on contextual escaping: while parsing, Jet
+// tracks where in the HTML document each action is placed and escapes its output accordingly, for example as
+// a JavaScript string inside <script> elements or as a URL in href attributes. Templates whose actions can't be
+// assigned a single context (e.g. an if statement opening a tag in only one branch) fail to parse.
+// Contextual escaping replaces the SafeWriter set by WithSafeWriter for all actions printing values.
+func WithContextualEscaping() Option {
+	return func(s *Set) {
+		s.contextualEscaping = true
+	}
+}
+
 // WithDelims returns an option function that sets the delimiters to the specified strings.
 // Parsed templates will inherit the settings. Not setting them leaves them at the default: `{{` and `}}`.
 func WithDelims(left, right string) Option {
@@ -84,6 +130,18 @@ func WithDelims(left, right string) Option {
 	}
 }
 
+// Delims returns the delimiters of actions in the templates of the Set, see WithDelims.
+func (s *Set) Delims() (left, right string) {
+	left, right = s.leftDelim, s.rightDelim
+	if left == "" {
+		left = defaultLeftDelim
+	}
+	if right == "" {
+		right = defaultRightDelim
+	}
+	return left, right
+}
+
 // WithTemplateNameExtensions returns an option function that sets the extensions to try when looking
 // up template names in the cache or loader. Default extensions are `""` (no extension), `".jet"`,
 // `".html.jet"`, `".jet.html"`. Extensions will be tried in the order they are defined in the slice.
@@ -98,7 +156,8 @@ func WithTemplateNameExtensions(extensions []string) Option {
 }
 
 // InDevelopmentMode returns an option function that toggles development mode on, meaning the cache will
-// always be bypassed and every template lookup will go to the loader.
+// always be bypassed and every template lookup will go to the loader. See WithWatcher for reloading only
+// templates that changed.
 func InDevelopmentMode() Option {
 	return func(s *Set) {
 		s.developmentMode = true
@@ -120,26 +179,36 @@ func (s *Set) GetTemplate(templatePath string) (t *Template, err error) {
 }
 
 func (s *Set) getSiblingTemplate(templatePath, siblingPath string, cacheAfterParsing bool) (t *Template, err error) {
+	return s.getTemplate(nil, resolveSibling(templatePath, siblingPath), cacheAfterParsing)
+}
+
+// resolveSibling resolves templatePath relative to the directory of siblingPath, unless it's absolute.
+func resolveSibling(templatePath, siblingPath string) string {
 	templatePath = filepath.ToSlash(templatePath)
 	siblingPath = filepath.ToSlash(siblingPath)
 	if !path.IsAbs(templatePath) {
 		siblingDir := path.Dir(siblingPath)
 		templatePath = path.Join(siblingDir, templatePath)
 	}
-	return s.getTemplate(templatePath, cacheAfterParsing)
+	return templatePath
 }
 
-// same as GetTemplate, but doesn't cache a template when found through the loader.
-func (s *Set) getTemplate(templatePath string, cacheAfterParsing bool) (t *Template, err error) {
+// same as GetTemplate, but doesn't cache a template when found through the loader. from is the load of the
+// template extending or importing the template, if any.
+func (s *Set) getTemplate(from *flight, templatePath string, cacheAfterParsing bool) (t *Template, err error) {
 	if !s.developmentMode {
+		s.syncLoader()
 		t, found := s.getTemplateFromCache(templatePath)
-		if found {
+		if found && !s.watch.stale(t) {
 			return t, nil
 		}
 	}
 
-	t, err = s.getTemplateFromLoader(templatePath, cacheAfterParsing)
-	if err == nil && cacheAfterParsing && !s.developmentMode {
+	t, found := s.getTemplateFromCompiled(templatePath)
+	if !found {
+		t, err = s.getTemplateFromLoader(from, templatePath, cacheAfterParsing)
+	}
+	if err == nil && cacheAfterParsing && !s.developmentMode && !s.invalidatedSince(t) {
 		s.cache.Put(templatePath, t)
 	}
 	return t, err
@@ -156,18 +225,60 @@ func (s *Set) getTemplateFromCache(templatePath string) (t *Template, ok bool) {
 	return nil, false
 }
 
-func (s *Set) getTemplateFromLoader(templatePath string, cacheAfterParsing bool) (t *Template, err error) {
+func (s *Set) getTemplateFromLoader(from *flight, templatePath string, cacheAfterParsing bool) (t *Template, err error) {
+	if canonicalPath, found := s.resolveLoaderPath(templatePath); found {
+		return s.load(from, canonicalPath, cacheAfterParsing)
+	}
+	return nil, fmt.Errorf("template %s could not be found", templatePath)
+}
+
+// resolveLoaderPath returns templatePath with the first extension the loader has a template for.
+func (s *Set) resolveLoaderPath(templatePath string) (string, bool) {
+	if s.developmentMode {
+		canonicalPath, found, _ := s.probeLoader(templatePath)
+		return canonicalPath, found
+	}
+	canonicalPath, found, ok, generation := s.lookups.get(templatePath)
+	if !ok {
+		var probes int
+		canonicalPath, found, probes = s.probeLoader(templatePath)
+		s.lookups.put(generation, templatePath, canonicalPath, found, probes)
+	}
+	return canonicalPath, found
+}
+
+// probeLoader returns templatePath with the first extension the loader has a template for, and the number of
+// extensions probed.
+func (s *Set) probeLoader(templatePath string) (canonicalPath string, found bool, probes int) {
 	// check path with all possible extensions in loader
 	for _, extension := range s.extensions {
 		canonicalPath := templatePath + extension
+		probes++
 		if found := s.loader.Exists(canonicalPath); found {
-			return s.loadFromFile(canonicalPath, cacheAfterParsing)
+			return canonicalPath, true, probes
 		}
 	}
-	return nil, fmt.Errorf("template %s could not be found", templatePath)
+	return "", false, probes
+}
+
+// resolveTemplatePath returns the path, including the extension, of the template getTemplate finds at templatePath.
+func (s *Set) resolveTemplatePath(templatePath string) (string, bool) {
+	if !s.developmentMode {
+		if t, found := s.getTemplateFromCache(templatePath); found {
+			return t.Name, true
+		}
+		for _, extension := range s.extensions {
+			if _, found := s.compiled[templatePath+extension]; found && s.sandbox == nil {
+				return templatePath + extension, true
+			}
+		}
+	}
+	return s.resolveLoaderPath(templatePath)
 }
 
-func (s *Set) loadFromFile(templatePath string, cacheAfterParsing bool) (template *Template, err error) {
+func (s *Set) loadFromFile(fl *flight, templatePath string, cacheAfterParsing bool) (template *Template, err error) {
+	generation := s.watch.current()
+	invalidations := atomic.LoadUint64(&s.invalidations)
 	f, err := s.loader.Open(templatePath)
 	if err != nil {
 		return nil, err
@@ -177,7 +288,14 @@ func (s *Set) loadFromFile(templatePath string, cacheAfterParsing bool) (templat
 	if err != nil {
 		return nil, err
 	}
-	return s.parse(templatePath, string(content), cacheAfterParsing)
+	t, err := s.parseIn(fl, templatePath, string(content), cacheAfterParsing)
+	if err != nil {
+		return nil, err
+	}
+	t.generation = generation
+	t.invalidations = invalidations
+	s.addDependencies(t)
+	return t, nil
 }
 
 // Parse parses `contents` as if it were located at `templatePath`, but won't put the result into the cache.
@@ -214,6 +332,18 @@ func (s *Set) LookupGlobal(key string) (val interface{}, found bool) {
 	return
 }
 
+// Globals returns the names of the global variables and functions added to the Set, sorted.
+func (s *Set) Globals() []string {
+	s.gmx.RLock()
+	defer s.gmx.RUnlock()
+	names := make([]string, 0, len(s.globals))
+	for name := range s.globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // AddGlobalFunc adds a global function into the Set,
 // overriding any function previously set under the specified key.
 // It returns the Set it was called on to allow for method chaining.
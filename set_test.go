@@ -15,8 +15,11 @@
 package jet
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -74,3 +77,120 @@ func TestGetTemplateConcurrency(t *testing.T) {
 		})
 	}
 }
+
+func TestSetInvalidate(t *testing.T) {
+	l := NewInMemLoader()
+	l.Set("/base.jet", "base {{ block body() }}{{ end }}")
+	l.Set("/page.jet", `{{ extends "base.jet" }}{{ block body() }}page{{ end }}`)
+	l.Set("/macros.jet", "{{ block macro() }}macro{{ end }}")
+	l.Set("/index.jet", `{{ import "macros" }}{{ include "page.jet" }}`)
+	l.Set("/other.jet", "other")
+	// hide the versioning of InMemLoader, so that the cache only changes when invalidated explicitly
+	set := NewSet(struct{ Loader }{l})
+
+	get := func(templatePath string) *Template {
+		tt, err := set.GetTemplate(templatePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tt
+	}
+	base, page, macros, index, other := get("/base.jet"), get("/page.jet"), get("/macros"), get("/index.jet"), get("/other.jet")
+
+	set.Invalidate("base")
+	if get("/base.jet") == base || get("/page.jet") == page {
+		t.Errorf("expected /base.jet and /page.jet extending it to be invalidated")
+	}
+	if get("/index.jet") != index || get("/macros") != macros || get("/other.jet") != other {
+		t.Errorf("expected templates not extending or importing /base.jet to stay cached")
+	}
+
+	set.Invalidate("/macros.jet")
+	if get("/macros") == macros || get("/index.jet") == index {
+		t.Errorf("expected /macros.jet and /index.jet importing it to be invalidated")
+	}
+
+	other = get("/other.jet")
+	set.Purge()
+	if get("/other.jet") == other {
+		t.Errorf("expected Purge to invalidate all templates")
+	}
+}
+
+func TestSetInMemLoaderChanges(t *testing.T) {
+	l := NewInMemLoader()
+	l.Set("/base.jet", "base")
+	l.Set("/page.jet", `{{ extends "/base.jet" }}`)
+	set := NewSet(l)
+
+	render := func(templatePath string) string {
+		tt, err := set.GetTemplate(templatePath)
+		if err != nil {
+			return err.Error()
+		}
+		var buf bytes.Buffer
+		if err := tt.Execute(&buf, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	if out := render("/page.jet"); out != "base" {
+		t.Fatalf("expected base, got %q", out)
+	}
+
+	l.Set("/base.jet", "changed")
+	if out := render("/page.jet"); out != "changed" {
+		t.Errorf("expected the change of /base.jet to be picked up, got %q", out)
+	}
+
+	l.Delete("/page.jet")
+	if out := render("/page.jet"); !strings.Contains(out, "could not be found") {
+		t.Errorf("expected the deleted /page.jet not to be found, got %q", out)
+	}
+}
+
+// slowLoader blocks opening the template at path, after reading it, until released.
+type slowLoader struct {
+	*InMemLoader
+	path    string
+	opened  chan struct{}
+	release chan struct{}
+}
+
+func (l *slowLoader) Open(templatePath string) (io.ReadCloser, error) {
+	f, err := l.InMemLoader.Open(templatePath)
+	if templatePath == l.path {
+		l.opened <- struct{}{}
+		<-l.release
+	}
+	return f, err
+}
+
+func TestSetInMemLoaderChangeDuringLoad(t *testing.T) {
+	l := &slowLoader{InMemLoader: NewInMemLoader(), path: "/page.jet", opened: make(chan struct{}, 1), release: make(chan struct{})}
+	l.Set("/page.jet", "old")
+	l.Set("/other.jet", "other")
+	set := NewSet(l)
+
+	done := make(chan string)
+	go func() {
+		tt, err := set.GetTemplate("/page.jet")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- tt.text
+	}()
+	<-l.opened // the load read the old content
+	l.Set("/page.jet", "new")
+	if _, err := set.GetTemplate("/other.jet"); err != nil {
+		t.Fatal(err)
+	}
+	close(l.release)
+	if text := <-done; text != "old" {
+		t.Fatalf("expected the running load to get the old content, got %q", text)
+	}
+
+	if out := renderTemplate(t, set, "/page.jet"); out != "new" {
+		t.Errorf("expected the template loaded before the change not to be cached, got %q", out)
+	}
+}
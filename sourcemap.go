@@ -0,0 +1,93 @@
+package jet
+
+import (
+	"io"
+	"sort"
+)
+
+// SourceMap maps the output of a template execution back to the templates that produced it, see
+// ExecSourceMap. It can be encoded as JSON.
+type SourceMap struct {
+	// Segments are the ranges of the output in the order they were written. Adjacent ranges
+	// written by the same node are merged.
+	Segments []SourceSegment `json:"segments"`
+}
+
+// SourceSegment is a range of the output written by one node of a template: text, an action or a
+// translation.
+type SourceSegment struct {
+	Start int `json:"start"` // byte offset of the range in the output
+	End   int `json:"end"`   // byte offset following the range
+
+	TemplatePath string `json:"template"` // path of the template the node belongs to
+	Line         int    `json:"line"`     // line of the node in the template
+	// Pos is the byte offset of the node in the template. It's 0 for templates compiled to Go code,
+	// whose output is mapped to the line of the statement executed last.
+	Pos Pos `json:"pos"`
+}
+
+// Lookup returns the segment containing the byte offset of the output.
+func (m *SourceMap) Lookup(offset int) (SourceSegment, bool) {
+	i := sort.Search(len(m.Segments), func(i int) bool { return m.Segments[i].End > offset })
+	if i < len(m.Segments) && m.Segments[i].Start <= offset {
+		return m.Segments[i], true
+	}
+	return SourceSegment{}, false
+}
+
+// sourceMapWriter records the position of the node writing for every write to w.
+type sourceMapWriter struct {
+	w        io.Writer
+	written  int
+	at       NodeBase // the node writing
+	segments []SourceSegment
+
+	// segments of the buffered output of a try statement that is written next, see executeTry
+	pending []SourceSegment
+}
+
+func (w *sourceMapWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if w.pending != nil {
+		for _, s := range w.pending {
+			s.Start += w.written
+			s.End += w.written
+			if s.Start >= w.written+n {
+				break
+			}
+			if s.End > w.written+n {
+				s.End = w.written + n
+			}
+			w.add(s)
+		}
+		w.pending = nil
+	} else if n > 0 {
+		w.add(SourceSegment{Start: w.written, End: w.written + n, TemplatePath: w.at.TemplatePath, Line: w.at.Line, Pos: w.at.Pos})
+	}
+	w.written += n
+	return n, err
+}
+
+// add appends s, merging it into the last segment if the same node wrote both.
+func (w *sourceMapWriter) add(s SourceSegment) {
+	if n := len(w.segments); n > 0 {
+		last := &w.segments[n-1]
+		if last.End == s.Start && last.TemplatePath == s.TemplatePath && last.Line == s.Line && last.Pos == s.Pos {
+			last.End = s.End
+			return
+		}
+	}
+	w.segments = append(w.segments, s)
+}
+
+// Flush flushes the underlying writer, see Flusher.
+func (w *sourceMapWriter) Flush() error {
+	return flushWriter(w.w)
+}
+
+// mapOutput attributes the output written next to node when executing with a source map.
+func (rt *Runtime) mapOutput(node *NodeBase) {
+	if rt.sourceMap != nil {
+		rt.sourceMap.at = *node
+	}
+}
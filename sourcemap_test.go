@@ -0,0 +1,94 @@
+package jet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSourceMap(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/layout.jet", "<html>\n{{ yield body() }}\n</html>")
+	loader.Set("/footer.jet", "<footer>{{ 2 }}</footer>")
+	loader.Set("/page.jet", `{{ extends "./layout" }}
+{{ block body() }}
+<p>{{ .Name }}</p>
+{{- include "./footer" }}
+{{ try }}<i>{{ "ok" }}</i>{{ end }}
+{{ end }}`)
+	set := NewSet(loader)
+	tt, err := set.GetTemplate("/page.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	m := &SourceMap{}
+	err = tt.ExecuteWith(context.Background(), &buf, nil, struct{ Name string }{"World"}, ExecSourceMap(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, expected := range []SourceSegment{
+		{TemplatePath: "/layout.jet", Line: 1}, // <html>
+		{TemplatePath: "/page.jet", Line: 2},   // <p>
+		{TemplatePath: "/page.jet", Line: 3},   // World
+		{TemplatePath: "/page.jet", Line: 3},   // </p>
+		{TemplatePath: "/footer.jet", Line: 1}, // <footer>
+		{TemplatePath: "/footer.jet", Line: 1}, // 2
+		{TemplatePath: "/footer.jet", Line: 1}, // </footer>
+		{TemplatePath: "/page.jet", Line: 4},   // newline
+		{TemplatePath: "/page.jet", Line: 5},   // <i>
+		{TemplatePath: "/page.jet", Line: 5},   // ok
+		{TemplatePath: "/page.jet", Line: 5},   // </i>
+		{TemplatePath: "/page.jet", Line: 5},   // newline
+		{TemplatePath: "/layout.jet", Line: 2}, // </html>
+	} {
+		if len(m.Segments) == 0 {
+			t.Fatalf("missing segment of %s:%d", expected.TemplatePath, expected.Line)
+		}
+		s := m.Segments[0]
+		m.Segments = m.Segments[1:]
+		if s.TemplatePath != expected.TemplatePath || s.Line != expected.Line {
+			t.Errorf("expected %q to be written by %s:%d, got %s:%d", out[s.Start:s.End], expected.TemplatePath, expected.Line, s.TemplatePath, s.Line)
+		}
+	}
+	if len(m.Segments) > 0 {
+		t.Errorf("unexpected segments %+v", m.Segments)
+	}
+}
+
+func TestSourceMapLookup(t *testing.T) {
+	loader := NewInMemLoader()
+	loader.Set("/index.jet", "Hello, {{ . }}!\n{{ try }}partial {{ fail() }}{{ catch }}failed{{ end }}")
+	set := NewSet(loader)
+	tt, _ := set.GetTemplate("/index.jet")
+	var buf bytes.Buffer
+	vars := VarMap{}.SetFunc("fail", func(Arguments) reflect.Value { panic("fail") })
+	m := &SourceMap{}
+	err := tt.ExecuteWith(context.Background(), &buf, vars, "World", ExecSourceMap(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if s, ok := m.Lookup(strings.Index(out, "World")); !ok || out[s.Start:s.End] != "World" || s.Pos != 10 {
+		t.Errorf("unexpected segment of the action %+v", s)
+	}
+	if s, ok := m.Lookup(strings.Index(out, "failed")); !ok || out[s.Start:s.End] != "failed" || s.Line != 2 {
+		t.Errorf("unexpected segment of the catch %+v", s)
+	}
+	if _, ok := m.Lookup(len(out)); ok {
+		t.Error("expected no segment after the output")
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), `{"segments":[{"start":0,"end":7,"template":"/index.jet","line":1,"pos":0}`) {
+		t.Errorf("unexpected JSON %s", data)
+	}
+}
@@ -0,0 +1,194 @@
+package jet
+
+import (
+	"sort"
+	"strings"
+)
+
+// WithSyntax returns an option function that makes the Set keep the concrete syntax of the templates it parses,
+// available from Template.Syntax. The concrete syntax holds every token of the source, including comments and
+// whitespace trim markers, which the parse tree doesn't, so that tools can rewrite templates without losing
+// any detail. It costs memory for every cached template, so it's meant for tools rather than applications.
+func WithSyntax() Option {
+	return func(s *Set) {
+		s.keepSyntax = true
+	}
+}
+
+// Syntax returns the concrete syntax of the template, nil if the Set wasn't created with WithSyntax.
+func (t *Template) Syntax() *Syntax {
+	return t.syntax
+}
+
+// TokenKind is the kind of a Token.
+type TokenKind int
+
+const (
+	TokenText         TokenKind = iota // text outside of actions
+	TokenTrimmedSpace                  // space next to an action with a trim marker, which isn't rendered
+	TokenComment                       // comment, including the {* and *} markers
+	TokenLeftDelim                     // left delimiter of an action
+	TokenRightDelim                    // right delimiter of an action
+	TokenTrimMarker                    // whitespace trim marker of an action, like "- " in {{- x }}
+	TokenSpace                         // space inside an action
+	TokenKeyword                       // keyword, like if, range or and
+	TokenIdentifier                    // identifier, like a variable name or _
+	TokenField                         // field access, like .Name or ?.Name
+	TokenString                        // string literal, including the quotes
+	TokenNumber                        // number or character literal
+	TokenBool                          // true or false
+	TokenOperator                      // operator, like +, ==, :=, |, ? or :
+	TokenPunctuation                   // parenthesis, bracket, comma or semicolon
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokenText:
+		return "text"
+	case TokenTrimmedSpace:
+		return "trimmed space"
+	case TokenComment:
+		return "comment"
+	case TokenLeftDelim:
+		return "left delimiter"
+	case TokenRightDelim:
+		return "right delimiter"
+	case TokenTrimMarker:
+		return "trim marker"
+	case TokenSpace:
+		return "space"
+	case TokenKeyword:
+		return "keyword"
+	case TokenIdentifier:
+		return "identifier"
+	case TokenField:
+		return "field"
+	case TokenString:
+		return "string"
+	case TokenNumber:
+		return "number"
+	case TokenBool:
+		return "bool"
+	case TokenOperator:
+		return "operator"
+	case TokenPunctuation:
+		return "punctuation"
+	}
+	return "unknown"
+}
+
+// Token is a token of the source of a template.
+type Token struct {
+	Kind TokenKind
+	Text string // the source of the token
+	Pos  Pos    // byte offset of the token in the source
+	Line int    // line of the start of the token, starting at 1
+}
+
+// End returns the byte offset following the token in the source.
+func (t Token) End() Pos {
+	return t.Pos + Pos(len(t.Text))
+}
+
+// Action is an action in the source of a template, from the left to the right delimiter.
+type Action struct {
+	Tokens []Token // the tokens of the action, including the delimiters and trim markers
+
+	// LeftTrim and RightTrim are set if the action has a whitespace trim marker at the left or the
+	// right delimiter.
+	LeftTrim, RightTrim bool
+}
+
+// Pos returns the byte offset of the left delimiter of the action.
+func (a Action) Pos() Pos {
+	return a.Tokens[0].Pos
+}
+
+// End returns the byte offset following the right delimiter of the action.
+func (a Action) End() Pos {
+	return a.Tokens[len(a.Tokens)-1].End()
+}
+
+// Syntax is the concrete syntax of a template. Its tokens cover the source without gaps or overlaps,
+// so concatenating their texts gives the source.
+type Syntax struct {
+	Tokens  []Token
+	Actions []Action // the actions of the template in the order they appear; their tokens are part of Tokens
+}
+
+// String returns the source of the template.
+func (s *Syntax) String() string {
+	var b strings.Builder
+	for _, t := range s.Tokens {
+		b.WriteString(t.Text)
+	}
+	return b.String()
+}
+
+// ActionAt returns the action containing the byte offset pos. Every node of the parse tree but text
+// nodes lies inside an action, so ActionAt(node.Position()) returns the action a node was parsed from.
+func (s *Syntax) ActionAt(pos Pos) (Action, bool) {
+	i := sort.Search(len(s.Actions), func(i int) bool { return s.Actions[i].End() > pos })
+	if i < len(s.Actions) && s.Actions[i].Pos() <= pos {
+		return s.Actions[i], true
+	}
+	return Action{}, false
+}
+
+// newSyntax returns the concrete syntax made of the items of a lexer keeping trivia.
+func newSyntax(items []item) *Syntax {
+	s := &Syntax{Tokens: make([]Token, 0, len(items))}
+	start := -1
+	for _, item := range items {
+		if item.kind == itemEOF {
+			break
+		}
+		kind := tokenKind(item.kind)
+		s.Tokens = append(s.Tokens, Token{Kind: kind, Text: item.val, Pos: item.pos, Line: item.row})
+		switch kind {
+		case TokenLeftDelim:
+			start = len(s.Tokens) - 1
+		case TokenRightDelim:
+			a := Action{Tokens: s.Tokens[start:len(s.Tokens):len(s.Tokens)]}
+			a.LeftTrim = len(a.Tokens) > 1 && a.Tokens[1].Kind == TokenTrimMarker
+			a.RightTrim = len(a.Tokens) > 2 && a.Tokens[len(a.Tokens)-2].Kind == TokenTrimMarker
+			s.Actions = append(s.Actions, a)
+		}
+	}
+	return s
+}
+
+func tokenKind(kind itemKind) TokenKind {
+	switch kind {
+	case itemText:
+		return TokenText
+	case itemTrimmedSpace:
+		return TokenTrimmedSpace
+	case itemComment:
+		return TokenComment
+	case itemLeftDelim:
+		return TokenLeftDelim
+	case itemRightDelim:
+		return TokenRightDelim
+	case itemTrimMarker:
+		return TokenTrimMarker
+	case itemSpace:
+		return TokenSpace
+	case itemIdentifier, itemUnderscore:
+		return TokenIdentifier
+	case itemField, itemLaxField:
+		return TokenField
+	case itemString, itemRawString:
+		return TokenString
+	case itemNumber, itemComplex, itemCharConstant:
+		return TokenNumber
+	case itemBool:
+		return TokenBool
+	case itemLeftParen, itemRightParen, itemLeftBrackets, itemLeftLaxBrackets, itemRightBrackets, itemComma, itemSemicolon, itemChar:
+		return TokenPunctuation
+	}
+	if kind > itemKeyword {
+		return TokenKeyword
+	}
+	return TokenOperator
+}
@@ -0,0 +1,91 @@
+package jet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSyntax(t *testing.T) {
+	set := NewSet(NewInMemLoader(), WithSyntax())
+	src := "<ul>{* items *}\n  {{- range i, v := items -}}\n  <li>{{ v.Name }}</li>\n{{ end }}</ul>"
+	tt, err := set.Parse("/syntax.jet", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := tt.Syntax()
+	if s.String() != src {
+		t.Fatalf("expected the source, got %q", s.String())
+	}
+
+	var kinds []string
+	for _, token := range s.Tokens[:8] {
+		kinds = append(kinds, token.Kind.String()+" "+token.Text)
+	}
+	expected := []string{"text <ul>", "comment {* items *}", "trimmed space \n  ", "left delimiter {{", "trim marker - ", "keyword range", "space  ", "identifier i"}
+	if strings.Join(kinds, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected tokens\n%q, got\n%q", expected, kinds)
+	}
+
+	if len(s.Actions) != 3 {
+		t.Fatalf("expected 3 actions, got %d", len(s.Actions))
+	}
+	a := s.Actions[0]
+	if !a.LeftTrim || !a.RightTrim || src[a.Pos():a.End()] != "{{- range i, v := items -}}" {
+		t.Errorf("unexpected first action %+v", a)
+	}
+	if a := s.Actions[1]; a.LeftTrim || a.RightTrim || a.Tokens[2].Line != 3 {
+		t.Errorf("unexpected second action %+v", a)
+	}
+
+	// nodes of the parse tree can be found in the actions they were parsed from
+	Inspect(tt.Root, func(node Node) {
+		if field, ok := node.(*FieldNode); ok {
+			a, ok := s.ActionAt(field.Position())
+			if !ok || a.Pos() != s.Actions[1].Pos() {
+				t.Errorf("expected field %s in the second action, got %+v", field, a)
+			}
+		}
+	})
+	if _, ok := s.ActionAt(0); ok {
+		t.Error("expected no action at the start of the template")
+	}
+
+	if tt, _ := NewSet(NewInMemLoader()).Parse("/syntax.jet", src); tt.Syntax() != nil {
+		t.Error("expected no concrete syntax without WithSyntax")
+	}
+}
+
+func TestSyntaxRoundTrip(t *testing.T) {
+	set := NewSet(NewOSFileSystemLoader("./testData"), WithSyntax())
+	err := filepath.Walk("./testData", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".jet") {
+			return err
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel("./testData", path)
+		tt, err := set.Parse(filepath.ToSlash(rel), string(src))
+		if err != nil {
+			return nil // fixtures holding several templates
+		}
+		s := tt.Syntax()
+		if s.String() != string(src) {
+			t.Errorf("%s: the tokens don't reproduce the source", path)
+		}
+		for i := 1; i < len(s.Tokens); i++ {
+			if s.Tokens[i].Pos != s.Tokens[i-1].End() {
+				t.Errorf("%s: token %d doesn't follow token %d", path, i, i-1)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,166 @@
+package jet
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"time"
+)
+
+// Tracer is notified when the execution of a template enters and leaves templates, blocks, yields,
+// includes, range loops and function calls. Enter and Exit are called from the goroutine executing the
+// template; a Tracer used by concurrent executions has to be safe for concurrent use.
+type Tracer interface {
+	// Enter is called when the execution enters ev.
+	Enter(rt *Runtime, ev *TraceEvent)
+	// Exit is called when the execution leaves ev, with its Duration and Err set. Events are left
+	// in the reverse order they were entered, also when the execution panics.
+	Exit(rt *Runtime, ev *TraceEvent)
+}
+
+// WithTracer returns an option function that sets the Tracer notified by every execution of templates of the Set.
+// A tracer passed with ContextWithTracer to ExecuteContext takes precedence.
+func WithTracer(tracer Tracer) Option {
+	return func(s *Set) {
+		s.tracer = tracer
+	}
+}
+
+type tracerKey struct{}
+
+// ContextWithTracer returns a copy of ctx that makes ExecuteContext notify tracer, to trace single executions.
+func ContextWithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// TraceKind is the kind of a TraceEvent.
+type TraceKind int
+
+const (
+	TraceTemplate TraceKind = iota // execution of the template passed to Execute
+	TraceBlock                     // block statement, rendering a block in place
+	TraceYield                     // yield statement
+	TraceInclude                   // include statement, includeIfExists() or exec()
+	TraceRange                     // range loop
+	TraceFunc                      // call of a Func or any other Go function
+)
+
+func (k TraceKind) String() string {
+	switch k {
+	case TraceTemplate:
+		return "template"
+	case TraceBlock:
+		return "block"
+	case TraceYield:
+		return "yield"
+	case TraceInclude:
+		return "include"
+	case TraceRange:
+		return "range"
+	case TraceFunc:
+		return "func"
+	}
+	return "unknown"
+}
+
+// TraceEvent is a part of a template execution passed to a Tracer.
+type TraceEvent struct {
+	Kind TraceKind
+	// Name is the path of the executed or included template, the name of the block, the range
+	// expression or the called function. Ranges and functions of templates compiled to Go code are
+	// named by the Go function, ranges not at all.
+	Name string
+
+	// TemplatePath, Line and Pos are the position of the statement or call. The position of templates
+	// included by includeIfExists() and exec() is the start of the included template.
+	TemplatePath string
+	Line         int
+	Pos          Pos // byte offset, 0 in templates compiled to Go code
+
+	Parent *TraceEvent // the enclosing event, nil for the executed template
+
+	Start    time.Time
+	Duration time.Duration // set when leaving the event
+	Err      error         // error leaving the event, set when leaving the event
+
+	// Data is left to the Tracer, to keep state from Enter to Exit.
+	Data interface{}
+
+	children time.Duration
+}
+
+// Self returns the duration of the event without the durations of the events it enclosed.
+func (ev *TraceEvent) Self() time.Duration {
+	return ev.Duration - ev.children
+}
+
+// traceEnter notifies the tracer that node is entered, naming the event name. It returns nil when
+// not tracing.
+func (rt *Runtime) traceEnter(kind TraceKind, node Node, name string) *TraceEvent {
+	if rt.tracer == nil {
+		return nil
+	}
+	if name == "" {
+		name = traceName(node)
+	}
+	base := node.base()
+	ev := &TraceEvent{Kind: kind, Name: name, TemplatePath: base.TemplatePath, Line: base.Line, Pos: base.Pos, Parent: rt.trace, Start: time.Now()}
+	rt.trace = ev
+	rt.tracer.Enter(rt, ev)
+	return ev
+}
+
+// traceExit notifies the tracer that ev is left with err.
+func (rt *Runtime) traceExit(ev *TraceEvent, err error) {
+	if ev == nil {
+		return
+	}
+	ev.Duration = time.Since(ev.Start)
+	if err != nil {
+		ev.Err = err
+	}
+	if ev.Parent != nil {
+		ev.Parent.children += ev.Duration
+	}
+	rt.trace = ev.Parent
+	rt.tracer.Exit(rt, ev)
+}
+
+// unwindTrace leaves the events entered after to, when recovering from the panic recovered.
+func (rt *Runtime) unwindTrace(to *TraceEvent, recovered interface{}) {
+	for rt.trace != nil && rt.trace != to {
+		ev := rt.trace
+		ev.Duration = time.Since(ev.Start)
+		if err, ok := recovered.(error); ok {
+			ev.Err = err
+		} else {
+			ev.Err = fmt.Errorf("panic: %v", recovered)
+		}
+		if ev.Parent != nil {
+			ev.Parent.children += ev.Duration
+		}
+		rt.trace = ev.Parent
+		rt.tracer.Exit(rt, ev)
+	}
+}
+
+func traceName(node Node) string {
+	switch node := node.(type) {
+	case *RangeNode:
+		if node.Set != nil {
+			return node.Set.String()
+		} else if node.Expression != nil {
+			return node.Expression.String()
+		}
+	case *valueNode:
+		if node.value.Kind() == reflect.Func {
+			if fn := runtime.FuncForPC(node.value.Pointer()); fn != nil {
+				return fn.Name()
+			}
+		}
+	default:
+		return node.String()
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package jet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type recordingTracer struct {
+	events []string
+}
+
+func (r *recordingTracer) Enter(_ *Runtime, ev *TraceEvent) {
+	r.events = append(r.events, fmt.Sprintf("enter %s %s %s:%d", ev.Kind, ev.Name, ev.TemplatePath, ev.Line))
+}
+
+func (r *recordingTracer) Exit(_ *Runtime, ev *TraceEvent) {
+	e := fmt.Sprintf("exit %s %s", ev.Kind, ev.Name)
+	if ev.Err != nil {
+		e += " with error"
+	}
+	if ev.Self() < 0 || ev.Self() > ev.Duration {
+		e += fmt.Sprintf(" with self time %s of %s", ev.Self(), ev.Duration)
+	}
+	r.events = append(r.events, e)
+}
+
+func TestTracer(t *testing.T) {
+	l := NewInMemLoader()
+	l.Set("/layout.jet", "<title>{{ block title() }}Site{{ end }}</title>\n{{ yield body() }}")
+	l.Set("/footer.jet", "<footer></footer>")
+	l.Set("/page.jet", `{{ extends "layout" }}
+{{ block body() }}
+{{ range items }}{{ upper(.) }}{{ end }}
+{{ include "footer" }}
+{{ try }}{{ fail() }}{{ catch }}failed{{ end }}
+{{ end }}`)
+	setTracer, ctxTracer := &recordingTracer{}, &recordingTracer{}
+	set := NewSet(l, WithTracer(setTracer))
+	tt, err := set.GetTemplate("/page.jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := VarMap{}.Set("items", []string{"a", "b"}).SetFunc("fail", func(Arguments) reflect.Value { panic("failed") })
+
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, vars, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"enter template /page.jet /page.jet:0",
+		"enter block title /layout.jet:1",
+		"exit block title",
+		"enter yield body /layout.jet:2",
+		"enter range items /page.jet:3",
+		"enter func upper /page.jet:3",
+		"exit func upper",
+		"enter func upper /page.jet:3",
+		"exit func upper",
+		"exit range items",
+		"enter include /footer.jet /page.jet:4",
+		"exit include /footer.jet",
+		"enter func fail /page.jet:5",
+		"exit func fail with error",
+		"exit yield body",
+		"exit template /page.jet",
+	}
+	if got := strings.Join(setTracer.events, "\n"); got != strings.Join(expected, "\n") {
+		t.Errorf("expected events\n%s\ngot\n%s", strings.Join(expected, "\n"), got)
+	}
+
+	// a tracer passed with the context takes precedence
+	setTracer.events = nil
+	buf.Reset()
+	if err := tt.ExecuteContext(ContextWithTracer(context.Background(), ctxTracer), &buf, vars, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(setTracer.events) != 0 || len(ctxTracer.events) != len(expected) {
+		t.Errorf("expected %d events of the context tracer only, got %d and %d", len(expected), len(ctxTracer.events), len(setTracer.events))
+	}
+}
@@ -0,0 +1,241 @@
+// Package tracing records OpenTelemetry-style spans of template executions, without depending on
+// OpenTelemetry. A Tracer is a jet.Tracer recording a span for every execution and for every template
+// included by include, exec() or includeIfExists(), and optionally for every yield:
+//
+//	exporter := tracing.NewInMemExporter()
+//	views := jet.NewSet(loader, jet.WithTracer(tracing.NewTracer(exporter, tracing.WithYields())))
+//
+// The spans of an execution are passed to the Exporter when the execution is done. Exporters
+// forward them to a tracing system, for example by converting them to OpenTelemetry spans; the
+// InMemExporter keeps them in memory for tests. Executions started with ExecuteContext and a context
+// from ContextWithParent become children of a span of the application, so that they show up in the
+// trace of the request rendering the template.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+// TraceID identifies a trace, the spans of a request.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies a span in a trace.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext identifies a span.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+// IsValid reports whether the span context has a trace and a span ID.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+type parentKey struct{}
+
+// ContextWithParent returns a copy of ctx making parent the parent span of the executions started
+// with ExecuteContext.
+func ContextWithParent(ctx context.Context, parent SpanContext) context.Context {
+	return context.WithValue(ctx, parentKey{}, parent)
+}
+
+// Attribute is a key-value pair describing a span. Values are strings or ints.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Keys of the span attributes.
+const (
+	TemplateKey    = "jet.template"     // path of the executed or included template
+	BlockKey       = "jet.block"        // name of the yielded block
+	ErrorReasonKey = "jet.error.reason" // reason of an errors.Error ending the span
+	FileKey        = "code.filepath"    // path of the template of the statement
+	LineKey        = "code.lineno"      // line of the statement
+)
+
+// Span is a timed part of a template execution.
+type Span struct {
+	// Name is "jet.execute" for executions, "jet.include", "jet.exec" or "jet.includeIfExists" for
+	// included templates and "jet.yield" or "jet.block" for blocks rendered by a yield or a block
+	// statement.
+	Name string
+	SpanContext
+	Parent     SpanID // zero for spans without parent
+	Start, End time.Time
+	Attributes []Attribute
+	Err        error // error ending the span, nil if it succeeded
+}
+
+// Attribute returns the value of the attribute key, nil if the span doesn't have it.
+func (s *Span) Attribute(key string) interface{} {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+// Exporter receives the spans of template executions. ExportSpans is called from the goroutine executing the
+// template once the execution is done, with the spans in the order they ended; an Exporter used by concurrent
+// executions has to be safe for concurrent use.
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []Span)
+}
+
+// InMemExporter is an Exporter keeping the spans in memory.
+type InMemExporter struct {
+	mx    sync.Mutex
+	spans []Span
+}
+
+// NewInMemExporter returns an empty InMemExporter.
+func NewInMemExporter() *InMemExporter {
+	return &InMemExporter{}
+}
+
+// ExportSpans implements Exporter.
+func (e *InMemExporter) ExportSpans(_ context.Context, spans []Span) {
+	e.mx.Lock()
+	e.spans = append(e.spans, spans...)
+	e.mx.Unlock()
+}
+
+// Spans returns the spans exported so far.
+func (e *InMemExporter) Spans() []Span {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	return append([]Span(nil), e.spans...)
+}
+
+// Reset discards the spans exported so far.
+func (e *InMemExporter) Reset() {
+	e.mx.Lock()
+	e.spans = nil
+	e.mx.Unlock()
+}
+
+// Tracer is a jet.Tracer recording spans. It's safe for concurrent use.
+type Tracer struct {
+	exporter Exporter
+	yields   bool
+
+	mx     sync.Mutex
+	random *rand.Rand
+}
+
+// Option is the type of option functions that can be used in NewTracer().
+type Option func(*Tracer)
+
+// WithYields returns an option function that makes the Tracer record a span for every block rendered
+// by a yield or a block statement.
+func WithYields() Option {
+	return func(t *Tracer) {
+		t.yields = true
+	}
+}
+
+// NewTracer returns a Tracer passing the spans to exporter.
+func NewTracer(exporter Exporter, opts ...Option) *Tracer {
+	t := &Tracer{exporter: exporter, random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// execution collects the spans of an execution.
+type execution struct {
+	spans []Span
+}
+
+// active is a span being recorded, kept in jet.TraceEvent.Data.
+type active struct {
+	span *Span
+	exec *execution
+}
+
+// Enter implements jet.Tracer.
+func (t *Tracer) Enter(rt *jet.Runtime, ev *jet.TraceEvent) {
+	var span *Span
+	switch ev.Kind {
+	case jet.TraceTemplate:
+		span = &Span{Name: "jet.execute", Attributes: []Attribute{{TemplateKey, ev.Name}}}
+	case jet.TraceInclude:
+		name, at := "jet.include", ev
+		if p := ev.Parent; p != nil && p.Kind == jet.TraceFunc && (p.Name == "exec" || p.Name == "includeIfExists") {
+			// located at the call rather than the included template
+			name, at = "jet."+p.Name, p
+		}
+		span = &Span{Name: name, Attributes: []Attribute{{TemplateKey, ev.Name}, {FileKey, at.TemplatePath}, {LineKey, at.Line}}}
+	case jet.TraceYield, jet.TraceBlock:
+		if !t.yields {
+			return
+		}
+		span = &Span{Name: "jet." + ev.Kind.String(), Attributes: []Attribute{{BlockKey, ev.Name}, {FileKey, ev.TemplatePath}, {LineKey, ev.Line}}}
+	default:
+		return
+	}
+	span.Start = ev.Start
+
+	var parent *active
+	for p := ev.Parent; p != nil && parent == nil; p = p.Parent {
+		parent, _ = p.Data.(*active)
+	}
+	a := &active{span: span}
+	if parent != nil {
+		a.exec = parent.exec
+		span.TraceID, span.Parent = parent.span.TraceID, parent.span.SpanID
+	} else {
+		a.exec = &execution{}
+		if sc, ok := rt.Ctx().Value(parentKey{}).(SpanContext); ok && sc.IsValid() {
+			span.TraceID, span.Parent = sc.TraceID, sc.SpanID
+		}
+	}
+
+	t.mx.Lock()
+	if span.TraceID == (TraceID{}) {
+		t.random.Read(span.TraceID[:])
+	}
+	t.random.Read(span.SpanID[:])
+	t.mx.Unlock()
+	ev.Data = a
+}
+
+// Exit implements jet.Tracer.
+func (t *Tracer) Exit(rt *jet.Runtime, ev *jet.TraceEvent) {
+	a, ok := ev.Data.(*active)
+	if !ok {
+		return
+	}
+	span := a.span
+	span.End = span.Start.Add(ev.Duration)
+	if ev.Err != nil {
+		span.Err = ev.Err
+		if err, ok := ev.Err.(errors.Error); ok && err.Reason() != "" {
+			span.Attributes = append(span.Attributes, Attribute{ErrorReasonKey, err.Reason()})
+		}
+	}
+	a.exec.spans = append(a.exec.spans, *span)
+	if ev.Kind == jet.TraceTemplate && t.exporter != nil {
+		t.exporter.ExportSpans(rt.Ctx(), a.exec.spans)
+	}
+}
@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func testSet(opts ...Option) (*jet.Set, *InMemExporter) {
+	l := jet.NewInMemLoader()
+	l.Set("/layout.jet", "<main>{{ yield body() }}</main>")
+	l.Set("/footer.jet", "<footer>{{ exec(\"/year.jet\") }}</footer>")
+	l.Set("/year.jet", "{{ return 2020 }}")
+	l.Set("/broken.jet", "{{ missing }}")
+	l.Set("/index.jet", "{{ extends \"layout\" }}\n{{ block body() }}\n{{ include \"footer\" }}{{ includeIfExists(\"/nav.jet\") }}\n{{ end }}")
+	l.Set("/error.jet", "{{ include \"broken\" }}")
+	exporter := NewInMemExporter()
+	return jet.NewSet(l, jet.WithTracer(NewTracer(exporter, opts...))), exporter
+}
+
+// describe returns the spans by name, with their attributes and the name of the parent span.
+func describe(spans []Span) []string {
+	names := map[SpanID]string{}
+	for _, s := range spans {
+		names[s.SpanID] = s.Name
+	}
+	var descriptions []string
+	for _, s := range spans {
+		d := s.Name
+		for _, a := range s.Attributes {
+			d += fmt.Sprintf(" %s=%v", a.Key, a.Value)
+		}
+		if s.Parent != (SpanID{}) {
+			d += " in " + names[s.Parent]
+		}
+		if s.Err != nil {
+			d += " failed"
+		}
+		descriptions = append(descriptions, d)
+	}
+	return descriptions
+}
+
+func TestTracer(t *testing.T) {
+	set, exporter := testSet(WithYields())
+	tt, _ := set.GetTemplate("/index.jet")
+	if err := tt.Execute(&bytes.Buffer{}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.Spans()
+	expected := []string{
+		"jet.exec jet.template=/year.jet code.filepath=/footer.jet code.lineno=1 in jet.include",
+		"jet.include jet.template=/footer.jet code.filepath=/index.jet code.lineno=3 in jet.yield",
+		"jet.yield jet.block=body code.filepath=/layout.jet code.lineno=1 in jet.execute",
+		"jet.execute jet.template=/index.jet",
+	}
+	if got := describe(spans); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected spans\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	for _, s := range spans {
+		if s.TraceID != spans[3].TraceID || !s.IsValid() || s.End.Before(s.Start) {
+			t.Errorf("unexpected span %+v", s)
+		}
+	}
+
+	// without WithYields, includes are children of the execution
+	set, exporter = testSet()
+	tt, _ = set.GetTemplate("/index.jet")
+	tt.Execute(&bytes.Buffer{}, nil, nil)
+	if got := describe(exporter.Spans()); len(got) != 3 || !strings.HasSuffix(got[1], "in jet.execute") {
+		t.Errorf("expected spans without yields, got %v", got)
+	}
+}
+
+func TestTracerError(t *testing.T) {
+	set, exporter := testSet()
+	tt, _ := set.GetTemplate("/error.jet")
+	parent := SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}}
+	if err := tt.ExecuteContext(ContextWithParent(context.Background(), parent), &bytes.Buffer{}, nil, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %v", describe(spans))
+	}
+	for _, s := range spans {
+		if s.Err == nil || s.Attribute(ErrorReasonKey) != "not_available.identifier" {
+			t.Errorf("expected the span %s to fail with the error reason, got %v", s.Name, s.Attributes)
+		}
+		if s.TraceID != parent.TraceID {
+			t.Errorf("expected the span %s in the trace of the parent", s.Name)
+		}
+	}
+	if spans[1].Parent != parent.SpanID {
+		t.Errorf("expected the execution to be a child of the parent span")
+	}
+}
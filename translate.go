@@ -0,0 +1,234 @@
+package jet
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/CloudyKit/jet/v6/errors"
+)
+
+// Translator resolves the messages used in {{trans}} statements and {{msg}} blocks.
+//
+// Messages may contain placeholders in the form {name}, which Jet replaces with the named parameters
+// passed in the template; {count} is replaced with the count, if one was passed.
+type Translator interface {
+	// Translate returns the message stored under key for the given locale.
+	// It returns false if no such message exists.
+	Translate(locale, key string) (message string, ok bool)
+	// TranslatePlural returns the form of the message stored under key that matches count
+	// in the given locale. It returns false if no such message exists.
+	TranslatePlural(locale, key string, count int64) (message string, ok bool)
+}
+
+// WithTranslator returns an option function that sets the Translator used to resolve
+// {{trans}} statements and {{msg}} blocks. Without a translator, trans statements render
+// their key and msg blocks render their content.
+func WithTranslator(t Translator) Option {
+	return func(s *Set) {
+		s.translator = t
+	}
+}
+
+// PluralRule returns the index of the plural form to use for count.
+type PluralRule func(count int64) int
+
+// DefaultPluralRule selects the first form for a count of 1 and the second form for all other counts,
+// which fits English and many other languages.
+func DefaultPluralRule(count int64) int {
+	if count == 1 {
+		return 0
+	}
+	return 1
+}
+
+// MapTranslator is a concurrency-safe Translator backed by in-memory message catalogs.
+//
+// Messages for a locale like "de-CH" are looked up in "de-CH", then in "de", then in the fallback locale.
+type MapTranslator struct {
+	mx       sync.RWMutex
+	fallback string
+	catalogs map[string]map[string][]string
+	rules    map[string]PluralRule
+}
+
+// NewMapTranslator returns a new, empty MapTranslator using fallbackLocale for messages missing in the
+// requested locale and for executions without a locale.
+func NewMapTranslator(fallbackLocale string) *MapTranslator {
+	return &MapTranslator{
+		fallback: fallbackLocale,
+		catalogs: map[string]map[string][]string{},
+		rules:    map[string]PluralRule{},
+	}
+}
+
+// Add stores a message under key for locale, overriding any message previously stored under the same key.
+// Pass more than one form for messages with plural forms; the form used is chosen by the locale's PluralRule.
+// It returns the MapTranslator it was called on to allow for method chaining.
+func (t *MapTranslator) Add(locale, key string, forms ...string) *MapTranslator {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	catalog, ok := t.catalogs[locale]
+	if !ok {
+		catalog = map[string][]string{}
+		t.catalogs[locale] = catalog
+	}
+	catalog[key] = forms
+	return t
+}
+
+// SetPluralRule sets the PluralRule for locale. Locales without a rule use DefaultPluralRule.
+// It returns the MapTranslator it was called on to allow for method chaining.
+func (t *MapTranslator) SetPluralRule(locale string, rule PluralRule) *MapTranslator {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.rules[locale] = rule
+	return t
+}
+
+// Translate implements Translator. For messages with plural forms, it returns the first form.
+func (t *MapTranslator) Translate(locale, key string) (string, bool) {
+	_, forms, ok := t.lookup(locale, key)
+	if !ok || len(forms) == 0 {
+		return "", false
+	}
+	return forms[0], true
+}
+
+// TranslatePlural implements Translator.
+func (t *MapTranslator) TranslatePlural(locale, key string, count int64) (string, bool) {
+	locale, forms, ok := t.lookup(locale, key)
+	if !ok || len(forms) == 0 {
+		return "", false
+	}
+	t.mx.RLock()
+	rule, ok := t.rules[locale]
+	t.mx.RUnlock()
+	if !ok {
+		rule = DefaultPluralRule
+	}
+	i := rule(count)
+	if i < 0 || i >= len(forms) {
+		i = len(forms) - 1
+	}
+	return forms[i], true
+}
+
+// lookup returns the locale the message was found in and its forms.
+func (t *MapTranslator) lookup(locale, key string) (string, []string, bool) {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	for _, l := range []string{locale, baseLocale(locale), t.fallback} {
+		if forms, ok := t.catalogs[l][key]; ok {
+			return l, forms, true
+		}
+	}
+	return "", nil, false
+}
+
+// baseLocale returns the language part of locale, e.g. "de" for "de-CH" or "pt_BR".
+func baseLocale(locale string) string {
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		return locale[:i]
+	}
+	return locale
+}
+
+// Locale returns the locale of the current execution.
+func (rt *Runtime) Locale() string {
+	return rt.locale
+}
+
+func (rt *Runtime) executeTranslation(node *TranslationNode) errors.Error {
+	key, err := rt.evalPrimaryExpressionGroup(node.Key)
+	if err != nil {
+		return err
+	}
+	if !key.IsValid() || (key.Kind() != reflect.String && !key.Type().Implements(stringerType)) {
+		return node.error(errors.UnexpectedExpressionTypeReason, fmt.Sprintf("evaluating message key: unexpected expression type %q", getTypeString(key)))
+	}
+	keyString := key.String()
+	if key.Kind() != reflect.String {
+		keyString = key.Interface().(fmt.Stringer).String()
+	}
+
+	params := make(map[string]reflect.Value, len(node.Parameters)+1)
+	for _, p := range node.Parameters {
+		v, err := rt.evalPrimaryExpressionGroup(p.Expression)
+		if err != nil {
+			return err
+		}
+		params[p.Identifier] = v
+	}
+
+	var (
+		message string
+		found   bool
+	)
+	if node.Count != nil {
+		count, err := rt.evalPrimaryExpressionGroup(node.Count)
+		if err != nil {
+			return err
+		}
+		if !count.IsValid() || !(isInt(count.Kind()) || isUint(count.Kind()) || isFloat(count.Kind())) {
+			return node.error(errors.UnexpectedExpressionTypeReason, fmt.Sprintf("evaluating message count: unexpected expression type %q", getTypeString(count)))
+		}
+		params["count"] = count
+		if rt.set.translator != nil {
+			message, found = rt.set.translator.TranslatePlural(rt.locale, keyString, toInt(count))
+		}
+	} else if rt.set.translator != nil {
+		message, found = rt.set.translator.Translate(rt.locale, keyString)
+	}
+
+	if !found && node.NodeType == NodeMsg {
+		rt.newScope()
+		defer rt.releaseScope()
+		for name, v := range params {
+			rt.variables[name] = v
+		}
+		_, err := rt.executeList(node.List)
+		return err
+	}
+
+	rt.escapeeWriter.escapee = node.escapee
+	defer func() { rt.escapeeWriter.escapee = nil }()
+	if !found {
+		io.WriteString(rt.escapeeWriter, keyString)
+		return nil
+	}
+	return rt.writeMessage(node, message, params)
+}
+
+// writeMessage writes message to the output, replacing {name} placeholders with the escaped parameter values.
+// The message text itself is written as it is, just like template text.
+func (rt *Runtime) writeMessage(node *TranslationNode, message string, params map[string]reflect.Value) errors.Error {
+	for {
+		start := strings.IndexByte(message, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(message[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		v, ok := params[message[start+1:end]]
+		if !ok {
+			io.WriteString(rt.Writer, message[:end+1])
+			message = message[end+1:]
+			continue
+		}
+		io.WriteString(rt.Writer, message[:start])
+		if v.IsValid() {
+			if err := rt.escapeeWriter.printValue(v); err != nil {
+				return node.error("", err.Error())
+			}
+		}
+		message = message[end+1:]
+	}
+	io.WriteString(rt.Writer, message)
+	return nil
+}
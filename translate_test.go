@@ -0,0 +1,72 @@
+package jet
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestTranslation(t *testing.T) {
+	translator := NewMapTranslator("en").
+		Add("en", "cart.title", "Your cart").
+		Add("en", "cart.items", "{count} item", "{count} items").
+		Add("en", "greeting", "Hello, <b>{name}</b>!").
+		Add("de", "cart.title", "Ihr Warenkorb").
+		Add("de", "cart.items", "{count} Artikel").
+		Add("pl", "cart.items", "{count} produkt", "{count} produkty", "{count} produktów").
+		SetPluralRule("pl", func(n int64) int {
+			switch {
+			case n == 1:
+				return 0
+			case n%10 >= 2 && n%10 <= 4 && (n%100 < 10 || n%100 >= 20):
+				return 1
+			}
+			return 2
+		})
+
+	l := NewInMemLoader()
+	set := NewSet(l, WithTranslator(translator))
+	vars := VarMap{}
+	vars.Set("user", &User{Name: "<Mario>"})
+
+	l.Set("title", `{{ trans "cart.title" }}`)
+	l.Set("items", `{{ trans "cart.items" 1 }}, {{ trans "cart.items" n }}`)
+	l.Set("greeting", `{{ trans "greeting" name=user.Name }}`)
+	l.Set("missing", `{{ trans "<missing>" }}`)
+	l.Set("msg", `{{ msg "greeting" name=user.Name }}Hi {{ name }}{{ end }}|{{ msg "welcome" name=user.Name count=2 }}Welcome {{ name }} ({{ count }}){{ end }}`)
+	l.Set("msgCount", `{{ msg "unknown" 3 }}{{ count }} things{{ end }}`)
+
+	tests := []struct {
+		name, locale, expected string
+	}{
+		{"title", "", "Your cart"},
+		{"title", "de-CH", "Ihr Warenkorb"},
+		{"title", "fr", "Your cart"},
+		{"items", "en", "1 item, 5 items"},
+		{"items", "de", "1 Artikel, 5 Artikel"},
+		{"items", "pl_PL", "1 produkt, 5 produktów"},
+		{"greeting", "en", "Hello, <b>&lt;Mario&gt;</b>!"},
+		{"missing", "en", "&lt;missing&gt;"},
+		{"msg", "en", "Hello, <b>&lt;Mario&gt;</b>!|Welcome &lt;Mario&gt; (2)"},
+		{"msgCount", "en", "3 things"},
+	}
+	for _, test := range tests {
+		tt, err := set.GetTemplate(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vars.Set("n", 5)
+		var buf bytes.Buffer
+		if err = tt.ExecuteWith(context.Background(), &buf, vars, nil, ExecLocale(test.locale)); err != nil {
+			t.Errorf("%s (%s): %v", test.name, test.locale, err)
+			continue
+		}
+		if buf.String() != test.expected {
+			t.Errorf("%s (%s): expected %q, got %q", test.name, test.locale, test.expected, buf.String())
+		}
+	}
+}
+
+func TestTranslationWithoutTranslator(t *testing.T) {
+	RunJetTest(t, nil, nil, "TranslationWithoutTranslator", `{{ trans "cart.title" }} {{ msg "cart.title" }}Cart{{ end }}`, "cart.title Cart")
+}
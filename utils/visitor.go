@@ -55,6 +55,8 @@ func (vc VisitorContext) Visit(node jet.Node) {
 		vc.visitIncludeNode(node)
 	case *jet.YieldNode:
 		vc.visitYieldNode(node)
+	case *jet.TranslationNode:
+		vc.visitTranslationNode(node)
 	case *jet.SetNode:
 		vc.visitSetNode(node)
 	case *jet.AdditiveExprNode:
@@ -78,6 +80,9 @@ func (vc VisitorContext) Visit(node jet.Node) {
 	case *jet.SliceExprNode:
 		vc.visitSliceExprNode(node)
 	case *jet.TextNode:
+	case *jet.BreakNode:
+	case *jet.ContinueNode:
+	case *jet.FlushNode:
 	case *jet.IdentifierNode:
 	case *jet.StringNode:
 	case *jet.NilNode:
@@ -155,6 +160,19 @@ func (vc VisitorContext) visitYieldNode(yieldNode *jet.YieldNode) {
 	}
 }
 
+func (vc VisitorContext) visitTranslationNode(translationNode *jet.TranslationNode) {
+	vc.visitNode(translationNode.Key)
+	if translationNode.Count != nil {
+		vc.visitNode(translationNode.Count)
+	}
+	for _, node := range translationNode.Parameters {
+		vc.visitNode(node.Expression)
+	}
+	if translationNode.List != nil {
+		vc.visitNode(translationNode.List)
+	}
+}
+
 func (vc VisitorContext) visitSetNode(setNode *jet.SetNode) {
 	for _, node := range setNode.Left {
 		vc.visitNode(node)
@@ -0,0 +1,203 @@
+package jet
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Watcher reports changes to the files of a loader, like fsnotify does for file systems.
+type Watcher interface {
+	// Changes returns the channel receiving the template path of every file that was created, modified
+	// or removed, like "/views/index.jet". The channel is closed when the watcher is closed.
+	Changes() <-chan string
+}
+
+// WithWatcher returns an option function that makes the Set reload cached templates when their files
+// change, as reported by w. A changed template is reloaded the next time it's requested, together with
+// every cached template that extends, imports or includes it, directly or through other templates.
+//
+// Unlike development mode, which parses every template again on every lookup, this only parses templates
+// whose files changed, so it's suited for dev servers. See NewPollingWatcher for a watcher of OSFileSystemLoader
+// directories.
+func WithWatcher(w Watcher) Option {
+	return func(s *Set) {
+		s.watch = &watchState{watcher: w, changed: map[string]uint64{}}
+	}
+}
+
+// watchChanges starts receiving the changes reported by the Watcher of the Set, if any. NewSet calls it
+// once all options are applied, as the changes are handled with the extensions of the Set.
+func (s *Set) watchChanges() {
+	if s.watch == nil {
+		return
+	}
+	go func() {
+		for templatePath := range s.watch.watcher.Changes() {
+			s.watch.change(templatePath)
+			s.lookups.forget(templatePath, s.extensions)
+		}
+	}()
+}
+
+// watchState tracks the file changes reported by a Watcher. Every change starts a new generation;
+// templates loaded in an earlier generation than the last change of their file are stale.
+type watchState struct {
+	watcher    Watcher
+	mu         sync.RWMutex
+	generation uint64
+	changed    map[string]uint64 // generation of the last change by template path
+}
+
+func (w *watchState) change(templatePath string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.generation++
+	w.changed[templatePath] = w.generation
+}
+
+// current returns the generation templates loaded now belong to; it's 0 without watcher.
+func (w *watchState) current() uint64 {
+	if w == nil {
+		return 0
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.generation
+}
+
+// stale reports whether the file of t or of a template it extends, imports or includes changed since t was loaded.
+func (w *watchState) stale(t *Template) bool {
+	if w == nil {
+		return false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.staleLocked(t, t.generation, t.set.extensions)
+}
+
+func (w *watchState) staleLocked(t *Template, generation uint64, extensions []string) bool {
+	if t.compiled != nil {
+		return false
+	}
+	if w.changed[t.Name] > generation {
+		return true
+	}
+	if t.extends != nil && w.staleLocked(t.extends, generation, extensions) {
+		return true
+	}
+	for _, _import := range t.imports {
+		if w.staleLocked(_import, generation, extensions) {
+			return true
+		}
+	}
+	// included templates are resolved at runtime: a changed file might be found with a different extension
+	for _, d := range t.dependencies {
+		if d.Kind != DependencyInclude || d.Dynamic {
+			continue
+		}
+		for _, extension := range extensions {
+			if w.changed[d.target+extension] > generation {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PollingWatcher is a Watcher detecting changes to the templates in a directory of the OS file system
+// by comparing the size and modification time of the files at a fixed interval.
+type PollingWatcher struct {
+	dir       string
+	interval  time.Duration
+	changes   chan string
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// compile time check that we implement Watcher
+var _ Watcher = (*PollingWatcher)(nil)
+
+// NewPollingWatcher returns a watcher of the files in dir, which should be the directory of an OSFileSystemLoader,
+// checking for changes every interval. Close it to stop watching.
+func NewPollingWatcher(dir string, interval time.Duration) *PollingWatcher {
+	w := &PollingWatcher{
+		dir:      filepath.FromSlash(dir),
+		interval: interval,
+		changes:  make(chan string),
+		done:     make(chan struct{}),
+	}
+	files := w.scan()
+	go w.poll(files)
+	return w
+}
+
+// Changes returns the channel receiving the template paths of changed files.
+func (w *PollingWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+// Close stops watching and closes the channel returned by Changes.
+func (w *PollingWatcher) Close() error {
+	w.closeOnce.Do(func() { close(w.done) })
+	return nil
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// scan returns the state of all files in the directory by template path. Files that can't be read are skipped.
+func (w *PollingWatcher) scan() map[string]fileState {
+	files := map[string]fileState{}
+	filepath.Walk(w.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(w.dir, path); err == nil {
+			files["/"+filepath.ToSlash(rel)] = fileState{size: info.Size(), modTime: info.ModTime()}
+		}
+		return nil
+	})
+	return files
+}
+
+func (w *PollingWatcher) poll(files map[string]fileState) {
+	defer close(w.changes)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+		current := w.scan()
+		for templatePath, state := range current {
+			if previous, ok := files[templatePath]; !ok || previous.size != state.size || !previous.modTime.Equal(state.modTime) {
+				if !w.send(templatePath) {
+					return
+				}
+			}
+		}
+		for templatePath := range files {
+			if _, ok := current[templatePath]; !ok {
+				if !w.send(templatePath) {
+					return
+				}
+			}
+		}
+		files = current
+	}
+}
+
+func (w *PollingWatcher) send(templatePath string) bool {
+	select {
+	case w.changes <- templatePath:
+		return true
+	case <-w.done:
+		return false
+	}
+}
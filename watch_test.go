@@ -0,0 +1,122 @@
+package jet
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func renderTemplate(t *testing.T, set *Set, templatePath string) string {
+	t.Helper()
+	tt, err := set.GetTemplate(templatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestWatcherDependents(t *testing.T) {
+	l := NewInMemLoader()
+	changes := make(chan string)
+	defer close(changes)
+	set := NewSet(l, WithWatcher(chanWatcher(changes)))
+	l.Set("/layout.jet", "<{{ yield body() }}>")
+	l.Set("/blocks.jet", "{{ block greeting() }}hi{{ end }}")
+	l.Set("/partial.jet", "partial")
+	l.Set("/page.jet", `{{ extends "layout" }}{{ import "blocks" }}{{ block body() }}{{ yield greeting() }} {{ include "./partial" }}{{ end }}`)
+	l.Set("/other.jet", "other")
+
+	if out := renderTemplate(t, set, "/page"); out != "<hi partial>" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	page, _ := set.GetTemplate("/page")
+
+	for _, change := range []struct {
+		file, content, expected string
+	}{
+		{"/other.jet", "changed", "<hi partial>"},
+		{"/layout.jet", "[{{ yield body() }}]", "[hi partial]"},
+		{"/blocks.jet", "{{ block greeting() }}hello{{ end }}", "[hello partial]"},
+		{"/partial.jet", "included", "[hello included]"},
+	} {
+		l.Set(change.file, change.content)
+		set.watch.change(change.file)
+		if out := renderTemplate(t, set, "/page"); out != change.expected {
+			t.Errorf("after changing %s: expected %q, got %q", change.file, change.expected, out)
+		}
+		reloaded, _ := set.GetTemplate("/page")
+		if (reloaded != page) != (change.file != "/other.jet") {
+			t.Errorf("after changing %s: page was reloaded: %v", change.file, reloaded != page)
+		}
+		page = reloaded
+	}
+}
+
+func TestWatcherExtensions(t *testing.T) {
+	l := NewInMemLoader()
+	changes := make(chan string, 1)
+	defer close(changes)
+	// the watcher is given before the extensions it handles changes with, and reports a change right away
+	changes <- "/index.tmpl"
+	set := NewSet(struct{ Loader }{l}, WithWatcher(chanWatcher(changes)), WithTemplateNameExtensions([]string{"", ".tmpl"}))
+	// let the first change be handled without synchronizing with the Set, for the race detector
+	time.Sleep(10 * time.Millisecond)
+	l.Set("/index.tmpl", `{{ includeIfExists("/late") }}index`)
+
+	if out := renderTemplate(t, set, "/index"); out != "index" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	l.Set("/late.tmpl", "late ")
+	changes <- "/late.tmpl"
+	deadline := time.Now().Add(time.Second)
+	for set.LookupStats().Missing != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	set.Invalidate("/index.tmpl")
+	if out := renderTemplate(t, set, "/index"); out != "late index" {
+		t.Errorf("expected the added template to be found, got %q", out)
+	}
+}
+
+type chanWatcher chan string
+
+func (w chanWatcher) Changes() <-chan string {
+	return w
+}
+
+func TestPollingWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "index.jet")
+	if err := ioutil.WriteFile(file, []byte("before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewPollingWatcher(dir, 10*time.Millisecond)
+	defer w.Close()
+	set := NewSet(NewOSFileSystemLoader(dir), WithWatcher(w))
+	if out := renderTemplate(t, set, "/index.jet"); out != "before" {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("after changing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for renderTemplate(t, set, "/index.jet") != "after changing" {
+		if time.Now().After(deadline) {
+			t.Fatal("change was not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}